@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+// runCommand runモード 投稿時刻atでテナントごとにExecutorを1回実行し、結果をJSONで出力する
+// dry runで実行すると、Twitterに投稿せずSpreadsheetに書き込まずに投稿予定を確認できる
+//
+//	./User596E9F4 -dry-run run -at 2024-01-05T09:00:00+09:00
+func runCommand(ctx context.Context, runners []*Runner, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	atFlag := fs.String("at", "", "投稿時刻（RFC3339） 指定がなければ現在時刻")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	at := time.Now()
+	if *atFlag != "" {
+		t, err := time.Parse(time.RFC3339, *atFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -at, must be RFC3339: %s", *atFlag)
+		}
+		at = t
+	}
+	// スケジュールは分単位で評価する
+	at = at.Truncate(time.Minute)
+
+	each(runners, func(r *Runner) { writeReport(r.Executor(ctx, at)) })
+	return nil
+}
+
+// planCommand planモード 期間内の投稿をテナントごとに模擬し、アカウントごとの予定を出力する
+// Twitterへの投稿・Spreadsheetへの書き込みは行わない
+//
+//	./User596E9F4 plan -from 2024-01-05T00:00:00+09:00 -for 24h -account user
+func planCommand(runners []*Runner, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		fromFlag = fs.String("from", "", "期間の開始（RFC3339） 指定がなければ現在時刻")
+		toFlag   = fs.String("to", "", "期間の終了（RFC3339） 指定がなければ-forから求める")
+		span     = fs.Duration("for", 24*time.Hour, "期間の長さ")
+		account  = fs.String("account", "", "模擬するアカウント（twitter_id） 指定がなければすべて")
+		tenant   = fs.String("tenant", "", "模擬するテナント 指定がなければすべて")
+		asJSON   = fs.Bool("json", false, "JSONで出力する")
+		seed     = fs.Int64("seed", 0, "乱数のseed 指定すると同じ模擬を再現する")
+	)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	from := time.Now()
+	if *fromFlag != "" {
+		t, err := time.Parse(time.RFC3339, *fromFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -from, must be RFC3339: %s", *fromFlag)
+		}
+		from = t
+	}
+	to := from.Add(*span)
+	if *toFlag != "" {
+		t, err := time.Parse(time.RFC3339, *toFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -to, must be RFC3339: %s", *toFlag)
+		}
+		to = t
+	}
+	if to.Before(from) {
+		return fmt.Errorf("-to must be after -from: %s - %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	found := false
+	for _, r := range runners {
+		if *tenant != "" && r.Tenant != *tenant {
+			continue
+		}
+		found = true
+		if *seed != 0 {
+			r.Rand = libs.NewRand(*seed)
+		}
+
+		steps, err := r.Simulate(from, to, *account)
+		if err != nil {
+			return libs.SetError(err, "failed to simulate "+r.Tenant)
+		}
+		if *asJSON {
+			writeReport(struct {
+				Tenant string     `json:"tenant,omitempty"`
+				From   time.Time  `json:"from"`
+				To     time.Time  `json:"to"`
+				Steps  []PlanStep `json:"steps"`
+			}{r.Tenant, from, to, steps})
+			continue
+		}
+		writeTimeline(os.Stdout, r.Tenant, steps)
+	}
+	if !found {
+		return fmt.Errorf("unknown tenant: %s", *tenant)
+	}
+	return nil
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 実行時の設定
+// 既定値 < 設定ファイル（-config・CONFIG） < 環境変数 < コマンドライン引数 の順に上書きする
+// テナントの設定は設定ファイルの一部として扱い、環境変数・コマンドライン引数で上書きする
+// why: 投稿の停止（dry run）やSheet名の変更を再ビルドなしで行うため
+type Config struct {
+	// プロダクションモード falseの場合はDebugログを出力し、dry runで実行する
+	Product bool `yaml:"product"`
+	// dry run 投稿の選択から書き込み内容の作成までを行い、Twitterへの投稿・Spreadsheetへの書き込みを行わずに投稿予定（JSON）を出力する
+	DryRun bool `yaml:"dry_run"`
+
+	// Google Cloudクレデンシャルファイル SheetDirを指定する場合は任意（Driveファイルの取得にのみ使用する）
+	Credential string `yaml:"credential"`
+	// AccountsListが記載されている管理者用SpreadsheetのID
+	SpreadsheetID string `yaml:"spreadsheet_id"`
+	// Google Spreadsheetの代わりに使用するCSVディレクトリ <SheetDir>/<SpreadID>/<SheetTitle>.csv
+	SheetDir string `yaml:"sheet_dir"`
+	Sheets   Sheets `yaml:"sheets"`
+
+	// Twitter account listの再取得間隔
+	Interval time.Duration `yaml:"interval"`
+	// 文字数での投稿先の分岐 超える場合はGUI、以下はAPI
+	// 日本語の文字数で指定する Xの重み付き文字数（英数字・記号は日本語の半分、URLは23）ではこの2倍
+	TweetCountJA int `yaml:"tweet_count_ja"`
+	// 投稿前のランダム待機時間の上限（秒）
+	MaxWaitSec int `yaml:"max_wait_sec"`
+	// 乱数のseed Tweetの選択・待機時間・GUI操作の間隔を再現する。0の場合は起動時刻で初期化する
+	Seed int64 `yaml:"seed"`
+	// GUI投稿でのファイルアップロードの待機時間の上限（秒）
+	MaxWaitForUpload int `yaml:"max_wait_for_upload"`
+	// 投稿の同時実行数
+	Workers int `yaml:"workers"`
+	// textのテンプレートの{{pool:name}}の候補 例: emoji: ["🌸", "☀️"]
+	Pools map[string][]string `yaml:"pools"`
+
+	// Driveファイルの一時保存先 毎日削除する
+	TemporaryDir string `yaml:"temporary_dir"`
+	// 投稿履歴ファイル
+	LedgerFile string `yaml:"ledger_file"`
+	// Spreadsheetへの書き込み待ちファイル
+	OutboxFile string `yaml:"outbox_file"`
+	// スケジュールの処理済み時刻ファイル
+	SchedulerFile string `yaml:"scheduler_file"`
+
+	Serve ServeConfig `yaml:"serve"`
+
+	// テナント（管理者用Spreadsheet）ごとの設定 指定がない場合は上記の設定で1つのテナントとして実行する
+	TenantOverrides []TenantOverride `yaml:"tenants"`
+
+	// override 環境変数・コマンドライン引数での上書き テナントの設定の後に再び適用する
+	override func(*Config) error
+}
+
+// Sheets Sheetのタイトルと取得範囲
+type Sheets struct {
+	Accounts string `yaml:"accounts"`
+	Tweets   string `yaml:"tweets"`
+	Search   string `yaml:"search"`
+	Range    string `yaml:"range"`
+}
+
+// DefaultConfig 設定の既定値
+func DefaultConfig() Config {
+	return Config{
+		Product: true,
+		Sheets: Sheets{
+			Accounts: "twitter_users",
+			Tweets:   "twitter_tweets",
+			Search:   "twitter_search",
+			Range:    "A1:Z",
+		},
+		Interval:         5 * time.Minute,
+		TweetCountJA:     140,
+		MaxWaitSec:       150,
+		MaxWaitForUpload: 120,
+		Workers:          2,
+		// 一時保存先（TemporaryDir）は毎日削除されるため、投稿履歴などは別に置く
+		TemporaryDir:  "./temp",
+		LedgerFile:    "./ledger/posts.jsonl",
+		OutboxFile:    "./ledger/outbox.json",
+		SchedulerFile: "./ledger/scheduler.json",
+		Serve: ServeConfig{
+			Port: "8080",
+		},
+	}
+}
+
+// Command 実行モードと、モードごとの引数
+// ‐ 引数なし: 常駐
+// ‐ serve: HTTP
+// ‐ run: 1回実行
+// ‐ plan: 期間内の投稿の模擬
+// ‐ explain: Tweetを選択できない理由の確認
+// ‐ validate: Sheetの設定の確認
+type Command struct {
+	Name string
+	Args []string
+}
+
+// commands 実行モード
+var commands = []string{"", "serve", "run", "plan", "explain", "validate"}
+
+// LoadConfig コマンドライン引数・環境変数・設定ファイルから設定を読み込み、検証する
+// 設定の引数の後に実行モードと、モードごとの引数を指定する
+func LoadConfig(args []string, getenv func(string) string) (Config, Command, error) {
+	cfg := DefaultConfig()
+
+	fs := flag.NewFlagSet("tweet-with-spread", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		path          = fs.String("config", "", "設定ファイル（YAML）")
+		dryRun        = fs.Bool("dry-run", false, "Twitterに投稿せず、Spreadsheetに書き込まずに投稿予定を出力する")
+		debug         = fs.Bool("debug", false, "Debugログを出力し、dry runで実行する")
+		spreadsheetID = fs.String("spreadsheet-id", "", "管理者用SpreadsheetのID")
+		sheetDir      = fs.String("sheet-dir", "", "Google Spreadsheetの代わりに使用するCSVディレクトリ")
+		interval      = fs.Duration("interval", 0, "Twitter account listの再取得間隔")
+		workers       = fs.Int("workers", 0, "投稿の同時実行数")
+		port          = fs.String("port", "", "serveモードの待ち受けポート")
+		seed          = fs.Int64("seed", 0, "乱数のseed")
+	)
+	if err := fs.Parse(args); err != nil {
+		return cfg, Command{}, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	if *path == "" {
+		*path = getenv("CONFIG")
+	}
+	if *path != "" {
+		if err := cfg.readFile(*path); err != nil {
+			return cfg, Command{}, err
+		}
+	}
+
+	// 環境変数で上書きし、指定されたコマンドライン引数のみ上書きする
+	override := func(c *Config) error {
+		if err := c.applyEnv(getenv); err != nil {
+			return err
+		}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "dry-run":
+				c.DryRun = *dryRun
+			case "debug":
+				c.Product = !*debug
+			case "spreadsheet-id":
+				c.SpreadsheetID = *spreadsheetID
+			case "sheet-dir":
+				c.SheetDir = *sheetDir
+			case "interval":
+				c.Interval = *interval
+			case "workers":
+				c.Workers = *workers
+			case "port":
+				c.Serve.Port = *port
+			case "seed":
+				c.Seed = *seed
+			}
+		})
+		return nil
+	}
+	if err := override(&cfg); err != nil {
+		return cfg, Command{}, err
+	}
+	// テナントの設定の後にも適用する
+	cfg.override = override
+
+	cmd := Command{Name: fs.Arg(0)}
+	if fs.NArg() > 1 {
+		cmd.Args = fs.Args()[1:]
+	}
+	if err := cfg.Validate(cmd.Name); err != nil {
+		return cfg, cmd, err
+	}
+	return cfg, cmd, nil
+}
+
+// readFile 設定ファイルを読み込む 未知の項目はエラーとする
+// why: 項目名の誤りで既定値のまま起動しないため
+func (c *Config) readFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// IsDryRun dry runで実行するか デバッグ（product: false）の場合もdry runで実行する
+func (c Config) IsDryRun() bool {
+	return c.DryRun || !c.Product
+}
+
+// WeightedLimit Xの重み付き文字数での上限 日本語は2文字として数えるためtweet_count_jaの2倍
+func (c Config) WeightedLimit() int {
+	return c.TweetCountJA * 2
+}
+
+// applyEnv 環境変数で上書きする
+func (c *Config) applyEnv(getenv func(string) string) error {
+	strs := []struct {
+		key string
+		p   *string
+	}{
+		{"CREDENTIAL", &c.Credential},
+		{"SPREADSHEET_ID", &c.SpreadsheetID},
+		{"SHEET_DIR", &c.SheetDir},
+		{"TEMPORARY_DIR", &c.TemporaryDir},
+		{"LEDGER_FILE", &c.LedgerFile},
+		{"OUTBOX_FILE", &c.OutboxFile},
+		{"SCHEDULER_FILE", &c.SchedulerFile},
+		{"PORT", &c.Serve.Port},
+		{"RUN_TOKEN", &c.Serve.RunToken},
+	}
+	for _, e := range strs {
+		if v := getenv(e.key); v != "" {
+			*e.p = v
+		}
+	}
+
+	var errs []error
+	ints := []struct {
+		key string
+		p   *int
+	}{
+		{"WORKERS", &c.Workers},
+		{"MAX_WAIT_SEC", &c.MaxWaitSec},
+	}
+	for _, e := range ints {
+		if v := getenv(e.key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number: %s", e.key, v))
+				continue
+			}
+			*e.p = n
+		}
+	}
+	bools := []struct {
+		key string
+		p   *bool
+	}{
+		{"PRODUCT", &c.Product},
+		{"DRY_RUN", &c.DryRun},
+	}
+	for _, e := range bools {
+		if v := getenv(e.key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be true or false: %s", e.key, v))
+				continue
+			}
+			*e.p = b
+		}
+	}
+	if v := getenv("SEED"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SEED must be a number: %s", v))
+		} else {
+			c.Seed = n
+		}
+	}
+	if v := getenv("INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("INTERVAL must be a duration (e.g. 5m): %s", v))
+		} else {
+			c.Interval = d
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate 設定を検証し、誤りをまとめて返す
+// テナントを指定した場合は、テナントごとの設定を検証する
+func (c Config) Validate(mode string) error {
+	var errs []error
+	check := func(ok bool, format string, a ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	check(slices.Contains(commands, mode), "unknown mode %q, must be one of %q", mode, commands)
+	if mode == "serve" {
+		check(c.Serve.Port != "", "serve.port (PORT) is required in serve mode")
+		check(c.Serve.RunToken != "", "serve.run_token (RUN_TOKEN) is required in serve mode")
+	}
+
+	tenants, err := c.Tenants()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, t := range tenants {
+		for _, err := range t.Config.validate() {
+			if t.Name != "" {
+				err = fmt.Errorf("tenants[%s]: %w", t.Name, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, validateIsolation(tenants)...)
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validate テナント1つ分の設定を検証する
+func (c Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, a ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	check(c.SpreadsheetID != "", "spreadsheet_id (SPREADSHEET_ID) is required")
+	check(c.Credential != "" || c.SheetDir != "", "credential (CREDENTIAL) is required without sheet_dir")
+	check(c.Sheets.Accounts != "", "sheets.accounts is required")
+	check(c.Sheets.Tweets != "", "sheets.tweets is required")
+	check(c.Sheets.Range != "", "sheets.range is required")
+	check(c.Interval > 0, "interval must be positive: %s", c.Interval)
+	check(c.TweetCountJA > 0, "tweet_count_ja must be positive: %d", c.TweetCountJA)
+	check(c.MaxWaitSec >= 0, "max_wait_sec must not be negative: %d", c.MaxWaitSec)
+	check(c.MaxWaitForUpload > 0, "max_wait_for_upload must be positive: %d", c.MaxWaitForUpload)
+	check(c.Workers > 0, "workers must be positive: %d", c.Workers)
+	check(c.TemporaryDir != "", "temporary_dir is required")
+	check(c.LedgerFile != "", "ledger_file is required")
+	check(c.OutboxFile != "", "outbox_file is required")
+	check(c.SchedulerFile != "", "scheduler_file is required")
+	return errs
+}
+
+// validateIsolation テナント間で管理者用Spreadsheet・投稿履歴などのファイルを共有しないことを検証する
+// why: 同じSpreadsheetを複数のテナントで処理すると重複投稿になり、ファイルを共有すると投稿履歴が混ざるため
+func validateIsolation(tenants []Tenant) []error {
+	var errs []error
+	seen := map[string]string{}
+	use := func(tenant, kind, v string) {
+		if v == "" {
+			return
+		}
+		key := kind + "\x00" + v
+		if other, ok := seen[key]; ok {
+			errs = append(errs, fmt.Errorf("tenants[%s]: %s %s is already used by tenants[%s]", tenant, kind, v, other))
+			return
+		}
+		seen[key] = tenant
+	}
+	for _, t := range tenants {
+		use(t.Name, "spreadsheet_id", t.Config.SpreadsheetID)
+		use(t.Name, "ledger_file", filepath.Clean(t.Config.LedgerFile))
+		use(t.Name, "outbox_file", filepath.Clean(t.Config.OutboxFile))
+		use(t.Name, "scheduler_file", filepath.Clean(t.Config.SchedulerFile))
+	}
+	return errs
+}
+
+// Tenant テナント（管理者用Spreadsheet）ごとの実行単位
+type Tenant struct {
+	// テナント名 ログに付与する。テナントの指定がない場合は空
+	Name   string
+	Config Config
+}
+
+// TenantOverride 設定ファイルのtenantsの1項目
+// nameと、共通の設定から上書きする項目を記述する
+type TenantOverride struct {
+	Name string
+	node yaml.Node
+}
+
+// UnmarshalYAML 上書きする項目は共通の設定が確定してから適用するため、そのまま保持する
+func (t *TenantOverride) UnmarshalYAML(n *yaml.Node) error {
+	var v struct {
+		Name string `yaml:"name"`
+	}
+	if err := n.Decode(&v); err != nil {
+		return err
+	}
+	t.Name = v.Name
+	t.node = *n
+	return nil
+}
+
+// テナント名 ファイルパスに使用するため英数字・_・-に限る
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Tenants テナントごとの設定を返す
+// ‐ テナントの指定がない場合は、共通の設定で名前のないテナント1つを返す
+// ‐ テナントの設定は共通の設定に上書きする
+// ‐ 投稿履歴・書き込み待ち・処理済み時刻・一時保存先は、指定がなければテナント名のディレクトリに分ける
+func (c Config) Tenants() ([]Tenant, error) {
+	if len(c.TenantOverrides) == 0 {
+		return []Tenant{{Config: c}}, nil
+	}
+
+	var errs []error
+	tenants := make([]Tenant, 0, len(c.TenantOverrides))
+	names := map[string]bool{}
+	for i, o := range c.TenantOverrides {
+		if !tenantNamePattern.MatchString(o.Name) {
+			errs = append(errs, fmt.Errorf("tenants[%d]: name must match %s: %q", i, tenantNamePattern, o.Name))
+			continue
+		}
+		if names[o.Name] {
+			errs = append(errs, fmt.Errorf("tenants[%s]: duplicate name", o.Name))
+			continue
+		}
+		names[o.Name] = true
+
+		tc, err := o.apply(c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenants[%s]: %w", o.Name, err))
+			continue
+		}
+		tenants = append(tenants, Tenant{Name: o.Name, Config: tc})
+	}
+	return tenants, errors.Join(errs...)
+}
+
+// apply 共通の設定baseにテナントの設定を上書きする
+// 環境変数・コマンドライン引数はテナントの設定より優先する
+// why: テナントの設定（dry_run: false・product: true）で、-dry-runを指定した実行が投稿しないため
+func (o TenantOverride) apply(base Config) (Config, error) {
+	c := base
+	c.TenantOverrides = nil
+
+	// nameを除いた項目を、未知の項目をエラーとして読み込む
+	m := yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(o.node.Content); i += 2 {
+		switch key := o.node.Content[i].Value; key {
+		case "name":
+			continue
+		case "serve", "tenants":
+			// serveモードの待ち受け・認証はプロセスで共通
+			return c, fmt.Errorf("%s can not be set per tenant", key)
+		}
+		m.Content = append(m.Content, o.node.Content[i], o.node.Content[i+1])
+	}
+	b, err := yaml.Marshal(&m)
+	if err != nil {
+		return c, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return c, err
+	}
+	if base.override != nil {
+		if err := base.override(&c); err != nil {
+			return c, err
+		}
+	}
+
+	// テナントで指定しなかったファイルは、テナント名のディレクトリに分ける
+	if c.TemporaryDir == base.TemporaryDir {
+		c.TemporaryDir = filepath.Join(base.TemporaryDir, o.Name)
+	}
+	for _, f := range []struct {
+		p    *string
+		base string
+	}{
+		{&c.LedgerFile, base.LedgerFile},
+		{&c.OutboxFile, base.OutboxFile},
+		{&c.SchedulerFile, base.SchedulerFile},
+	} {
+		if *f.p == f.base {
+			*f.p = tenantPath(f.base, o.Name)
+		}
+	}
+	return c, nil
+}
+
+// tenantPath ファイルパスのディレクトリにテナント名を加える ./ledger/posts.jsonl -> ./ledger/<name>/posts.jsonl
+func tenantPath(path, name string) string {
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), name, filepath.Base(path))
+}
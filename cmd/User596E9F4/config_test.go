@@ -0,0 +1,253 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadConfig 既定値 < 設定ファイル < 環境変数 < コマンドライン引数 の順に上書きされること
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+spreadsheet_id: file
+sheet_dir: ./sheets
+interval: 1m
+workers: 3
+sheets:
+  tweets: file_tweets
+serve:
+  port: "9000"
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"CONFIG":    path,
+		"WORKERS":   "4",
+		"RUN_TOKEN": "secret",
+	}
+
+	cfg, cmd, err := LoadConfig([]string{"-workers", "5", "-dry-run", "serve"}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Name != "serve" {
+		t.Fatalf("mode: %q", cmd.Name)
+	}
+
+	for _, c := range []struct {
+		name      string
+		got, want any
+	}{
+		{"spreadsheet_id from file", cfg.SpreadsheetID, "file"},
+		{"sheets.tweets from file", cfg.Sheets.Tweets, "file_tweets"},
+		{"sheets.accounts default", cfg.Sheets.Accounts, "twitter_users"},
+		{"interval from file", cfg.Interval, time.Minute},
+		{"workers from flag", cfg.Workers, 5},
+		{"dry_run from flag", cfg.DryRun, true},
+		{"product default", cfg.Product, true},
+		{"port from file", cfg.Serve.Port, "9000"},
+		{"run_token from env", cfg.Serve.RunToken, "secret"},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+// TestLoadConfigInvalid 誤りがある場合は起動せず、すべての誤りを返すこと
+func TestLoadConfigInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("spreadsheet_idd: typo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		{"unknown field", []string{"-config", path}, nil, []string{"field spreadsheet_idd not found"}},
+		{"missing file", []string{"-config", path + ".missing"}, nil, []string{"failed to read config"}},
+		{"unknown flag", []string{"-unknown"}, nil, []string{"invalid arguments"}},
+		{"invalid env", nil, map[string]string{"WORKERS": "two", "INTERVAL": "5"}, []string{"WORKERS must be a number", "INTERVAL must be a duration"}},
+		{
+			"invalid values",
+			[]string{"-workers", "0", "-interval", "0s", "unknown"},
+			nil,
+			[]string{"unknown mode", "spreadsheet_id (SPREADSHEET_ID) is required", "credential (CREDENTIAL) is required", "interval must be positive", "workers must be positive"},
+		},
+		{
+			"serve without token",
+			[]string{"-spreadsheet-id", "admin", "-sheet-dir", "./sheets", "serve"},
+			nil,
+			[]string{"serve.run_token (RUN_TOKEN) is required"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := LoadConfig(c.args, func(k string) string { return c.env[k] })
+			if err == nil {
+				t.Fatal("want error")
+			}
+			for _, w := range c.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error must contain %q: %s", w, err)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadConfigTenants テナントの設定は共通の設定に上書きされ、ファイルはテナントごとに分かれること
+func TestLoadConfigTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+sheet_dir: ./sheets
+workers: 3
+sheets:
+  tweets: shared_tweets
+tenants:
+  - name: acme
+    spreadsheet_id: acme_sheet
+    credential: ./acme.json
+    sheets:
+      accounts: acme_users
+  - name: globex
+    spreadsheet_id: globex_sheet
+    workers: 1
+    ledger_file: ./globex/posts.jsonl
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := LoadConfig([]string{"-config", path, "-dry-run"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := cfg.Tenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 2 {
+		t.Fatalf("tenants: %+v", tenants)
+	}
+	acme, globex := tenants[0], tenants[1]
+
+	for _, c := range []struct {
+		name      string
+		got, want any
+	}{
+		{"acme name", acme.Name, "acme"},
+		{"acme spreadsheet_id", acme.Config.SpreadsheetID, "acme_sheet"},
+		{"acme credential", acme.Config.Credential, "./acme.json"},
+		{"acme sheets.accounts", acme.Config.Sheets.Accounts, "acme_users"},
+		{"acme sheets.tweets from shared", acme.Config.Sheets.Tweets, "shared_tweets"},
+		{"acme workers from shared", acme.Config.Workers, 3},
+		{"acme dry_run from flag", acme.Config.DryRun, true},
+		{"acme ledger_file", acme.Config.LedgerFile, filepath.Join("ledger", "acme", "posts.jsonl")},
+		{"acme temporary_dir", acme.Config.TemporaryDir, filepath.Join("temp", "acme")},
+		{"globex workers", globex.Config.Workers, 1},
+		{"globex ledger_file", globex.Config.LedgerFile, "./globex/posts.jsonl"},
+		{"globex scheduler_file", globex.Config.SchedulerFile, filepath.Join("ledger", "globex", "scheduler.json")},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+// TestLoadConfigTenantsPrecedence 環境変数・コマンドライン引数はテナントの設定より優先すること
+func TestLoadConfigTenantsPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+sheet_dir: ./sheets
+tenants:
+  - name: acme
+    spreadsheet_id: acme_sheet
+    product: true
+    dry_run: false
+    workers: 1
+    ledger_file: ./acme/posts.jsonl
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"WORKERS": "5", "LEDGER_FILE": "./shared/posts.jsonl"}
+
+	for _, c := range []struct {
+		name       string
+		args       []string
+		getenv     func(string) string
+		wantDryRun bool
+		wantWorker int
+		wantLedger string
+	}{
+		{"tenant", []string{"-config", path}, func(string) string { return "" }, false, 1, "./acme/posts.jsonl"},
+		{"flag dry-run", []string{"-config", path, "-dry-run"}, func(string) string { return "" }, true, 1, "./acme/posts.jsonl"},
+		{"flag debug", []string{"-config", path, "-debug"}, func(string) string { return "" }, true, 1, "./acme/posts.jsonl"},
+		{"env", []string{"-config", path}, func(k string) string { return env[k] }, false, 5, filepath.Join("shared", "acme", "posts.jsonl")},
+		{"env and flag", []string{"-config", path, "-workers", "2"}, func(k string) string { return env[k] }, false, 2, filepath.Join("shared", "acme", "posts.jsonl")},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, _, err := LoadConfig(c.args, c.getenv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tenants, err := cfg.Tenants()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tenants[0].Config
+			if got.IsDryRun() != c.wantDryRun || got.Workers != c.wantWorker || got.LedgerFile != c.wantLedger {
+				t.Fatalf("dry run: %v, workers: %d, ledger_file: %s", got.IsDryRun(), got.Workers, got.LedgerFile)
+			}
+		})
+	}
+}
+
+// TestLoadConfigTenantsInvalid テナントの誤り・テナント間の共有を検出すること
+func TestLoadConfigTenantsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+sheet_dir: ./sheets
+tenants:
+  - name: acme
+    spreadsheet_id: same
+  - name: globex
+    spreadsheet_id: same
+    ledger_file: ./ledger/acme/posts.jsonl
+  - name: acme
+    spreadsheet_id: other
+  - name: ../x
+  - name: initech
+    serve:
+      port: "9000"
+  - name: hooli
+    workerz: 1
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := LoadConfig([]string{"-config", path}, func(string) string { return "" })
+	if err == nil {
+		t.Fatal("want error")
+	}
+	for _, w := range []string{
+		"tenants[globex]: spreadsheet_id same is already used by tenants[acme]",
+		"tenants[globex]: ledger_file ledger/acme/posts.jsonl is already used by tenants[acme]",
+		"tenants[acme]: duplicate name",
+		`tenants[3]: name must match`,
+		"tenants[initech]: serve can not be set per tenant",
+		"tenants[hooli]: yaml: unmarshal errors",
+	} {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("error must contain %q: %s", w, err)
+		}
+	}
+}
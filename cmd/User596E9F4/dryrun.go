@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"tweet-with-spread/cmd/User596E9F4/subsets"
+	"tweet-with-spread/libs"
+
+	mtypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/rs/zerolog/log"
+)
+
+// PostPlan dry runでの投稿予定
+// Twitterに投稿せず、Spreadsheetに書き込まずに、投稿する場合と同じ処理で作成する
+type PostPlan struct {
+	Text string `json:"text"`
+	// 投稿するファイル Driveファイルは一時保存先のパス
+	Files []string `json:"files,omitempty"`
+	// API投稿のリクエスト MediaIDはアップロード時に決まるため含まない
+	Request *mtypes.CreateInput `json:"request,omitempty"`
+	// スレッドの各Tweet
+	Thread []PlannedThreadPart `json:"thread,omitempty"`
+	// 投稿前に削除する同じ行の前回の投稿（delete_previous）
+	Delete []string `json:"delete,omitempty"`
+	// 投稿を削除する時刻（delete_after）
+	DeleteAt *time.Time `json:"delete_at,omitempty"`
+	// 投稿後に「Tweets list」に書き込む内容 TweetURLは投稿時に決まるため含まない
+	WriteBack PlannedWriteBack `json:"write_back"`
+}
+
+// PlannedThreadPart スレッドの1Tweet
+type PlannedThreadPart struct {
+	Text  string   `json:"text"`
+	Files []string `json:"files,omitempty"`
+}
+
+// PlannedWriteBack 投稿後のSpreadsheetへの書き込み内容
+type PlannedWriteBack struct {
+	libs.SheetRef
+	KeyColumn string                 `json:"key_column"`
+	Key       string                 `json:"key"`
+	Values    map[string]interface{} `json:"values"`
+}
+
+// planPost 投稿予定を作成する
+// entryは投稿する場合に投稿履歴に記録する内容
+func (r *Runner) planPost(tweet *subsets.TwitterTweet, files []string, entry libs.LedgerEntry) (*PostPlan, error) {
+	plan := &PostPlan{Text: tweet.Text, Files: files}
+	if !entry.DeleteAt.IsZero() {
+		plan.DeleteAt = &entry.DeleteAt
+	}
+	switch entry.Channel {
+	case libs.ChannelAPI:
+		plan.Request = subsets.NewCreateTweetInput(tweet, nil)
+	case libs.ChannelThread:
+		parts := subsets.SplitThread(tweet.Text, r.Config.WeightedLimit())
+		dist := subsets.DistributeFiles(files, len(parts))
+		for i := range parts {
+			plan.Thread = append(plan.Thread, PlannedThreadPart{Text: parts[i], Files: dist[i]})
+		}
+	}
+
+	u, err := r.writeBackUpdate(entry)
+	if err != nil {
+		return nil, err
+	}
+	plan.WriteBack = PlannedWriteBack{
+		SheetRef:  u.SheetRef,
+		KeyColumn: u.KeyColumn,
+		Key:       u.Key,
+		Values:    u.Values,
+	}
+	return plan, nil
+}
+
+var (
+	reportMu sync.Mutex
+	// 実行結果の出力先
+	reportOut io.Writer = os.Stdout
+)
+
+// writeReport 実行結果をJSONで標準出力に出力する
+// why: ログ（標準エラー出力）と分けて、投稿予定をjqなどで処理するため
+func writeReport(v any) {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+	enc := json.NewEncoder(reportOut)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Error().Err(err).Str("function", "writeReport").Msg("failed to write report")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+// TestExecutorDryRun dry runでは投稿予定を作成し、Twitterへの投稿・Spreadsheetへの書き込み・投稿履歴への記録を行わないこと
+func TestExecutorDryRun(t *testing.T) {
+	for _, c := range []struct {
+		name         string
+		tweetCountJA int
+		wantChannel  string
+	}{
+		{"api", 140, libs.ChannelAPI},
+		{"gui", 1, libs.ChannelGUI},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			poster := &fakePoster{}
+			at := time.Now().UTC().Truncate(time.Minute)
+			r, store := newTestRunner(t, poster, at)
+			r.Config.DryRun = true
+			r.Config.TweetCountJA = c.tweetCountJA
+
+			summary := r.Executor(context.Background(), at)
+			if !summary.DryRun || summary.Planned != 1 || len(summary.Results) != 1 {
+				t.Fatalf("summary: %+v", summary)
+			}
+			got := summary.Results[0]
+			if got.Status != PostPlanned || got.Channel != c.wantChannel || got.Plan == nil {
+				t.Fatalf("result: %+v", got)
+			}
+			if got.Plan.Text != "hello" {
+				t.Fatalf("text: %s", got.Plan.Text)
+			}
+			if c.wantChannel == libs.ChannelAPI && (got.Plan.Request == nil || *got.Plan.Request.Text != "hello") {
+				t.Fatalf("request: %+v", got.Plan.Request)
+			}
+			if c.wantChannel == libs.ChannelGUI && got.Plan.Request != nil {
+				t.Fatalf("gui must not create api request: %+v", got.Plan.Request)
+			}
+			wb := got.Plan.WriteBack
+			if wb.SheetTitle != r.Config.Sheets.Tweets || wb.Key != "1" || wb.Values["count"] != 1 {
+				t.Fatalf("write back: %+v", wb)
+			}
+
+			if len(poster.texts) != 0 {
+				t.Fatalf("dry run must not post: %v", poster.texts)
+			}
+			if rows := store.Sheet("admin", r.Config.Sheets.Tweets); !reflect.DeepEqual(rows, testTweetsRows) {
+				t.Fatalf("dry run must not write sheet: %v", rows)
+			}
+			if entries, err := r.Ledger.Entries(); err != nil || len(entries) != 0 {
+				t.Fatalf("dry run must not append ledger: %v, %v", entries, err)
+			}
+		})
+	}
+}
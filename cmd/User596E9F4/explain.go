@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"tweet-with-spread/cmd/User596E9F4/subsets"
+	"tweet-with-spread/libs"
+)
+
+// errAccountNotFound テナントのTwitter account listにアカウントがない
+var errAccountNotFound = errors.New("account not found")
+
+// explainCommand explainモード アカウントのTweetの選択を1回行い、選択段階ごとに候補を除外した理由を出力する
+// スケジュールにかかわらず選択する Twitterへの投稿・Spreadsheetへの書き込みは行わない
+//
+//	./User596E9F4 explain -account user -at 2024-01-05T09:00:00+09:00
+func explainCommand(runners []*Runner, args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		account = fs.String("account", "", "選択するアカウント（twitter_id） 必須")
+		atFlag  = fs.String("at", "", "選択する時刻（RFC3339） 指定がなければ現在時刻")
+		tenant  = fs.String("tenant", "", "アカウントのテナント 指定がなければすべて")
+		asJSON  = fs.Bool("json", false, "JSONで出力する")
+		seed    = fs.Int64("seed", 0, "乱数のseed 指定すると同じ選択を再現する")
+	)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	if *account == "" {
+		return errors.New("-account is required")
+	}
+
+	at := time.Now()
+	if *atFlag != "" {
+		t, err := time.Parse(time.RFC3339, *atFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -at, must be RFC3339: %s", *atFlag)
+		}
+		at = t
+	}
+
+	found := false
+	for _, r := range runners {
+		if *tenant != "" && r.Tenant != *tenant {
+			continue
+		}
+		if *seed != 0 {
+			r.Rand = libs.NewRand(*seed)
+		}
+
+		trace, tweets, err := r.Explain(at, *account)
+		if errors.Is(err, errAccountNotFound) {
+			continue
+		}
+		if err != nil {
+			return libs.SetError(err, "failed to explain "+r.Tenant)
+		}
+		found = true
+		if *asJSON {
+			writeReport(struct {
+				Tenant string `json:"tenant,omitempty"`
+				subsets.SelectTrace
+			}{r.Tenant, trace})
+			continue
+		}
+		writeExplain(os.Stdout, r.Tenant, trace, tweets)
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", errAccountNotFound, *account)
+	}
+	return nil
+}
+
+// Explain 時刻atにおけるアカウントのTweetの選択の経過と、選択の対象としたTweets
+// 選択できなかった場合もエラーではなく、選択の経過のErrorに理由を記録する
+func (r *Runner) Explain(at time.Time, account string) (subsets.SelectTrace, []subsets.TwitterTweet, error) {
+	accounts, err := r.loadAccounts()
+	if err != nil {
+		return subsets.SelectTrace{}, nil, libs.SetError(err, "failed to get account list")
+	}
+	var target *subsets.TwitterAccount
+	for i := range accounts {
+		if accounts[i].TwitterID == account {
+			target = &accounts[i]
+			break
+		}
+	}
+	if target == nil {
+		return subsets.SelectTrace{}, nil, errAccountNotFound
+	}
+
+	history, err := r.Ledger.Entries()
+	if err != nil {
+		return subsets.SelectTrace{}, nil, libs.SetError(err, "failed to read ledger")
+	}
+	ref, _, tweets, err := r.readTweets(*target)
+	if err != nil {
+		return subsets.SelectTrace{}, nil, err
+	}
+
+	_, trace, _ := subsets.SelectTweet(at, r.Rand, *target, ref, append([]subsets.TwitterTweet(nil), tweets...), history)
+	return trace, tweets, nil
+}
+
+// writeExplain 選択段階ごとの候補数と、除外したTweetの理由を出力する
+func writeExplain(w io.Writer, tenant string, trace subsets.SelectTrace, tweets []subsets.TwitterTweet) {
+	texts := make(map[int]string, len(tweets))
+	for _, t := range tweets {
+		if t.TwitterID == trace.Account {
+			texts[t.Index] = t.Text
+		}
+	}
+
+	if tenant != "" {
+		fmt.Fprintf(w, "tenant: %s\n", tenant)
+	}
+	fmt.Fprintf(w, "%s  %s  candidates: %d\n", trace.Account, trace.At.Format("2006-01-02 15:04 MST"), trace.Candidates)
+	for _, s := range trace.Stages {
+		fmt.Fprintf(w, "  %-10s %d -> %d\n", s.Stage, s.In, s.Out)
+		// 別アカウントのTweetは件数のみ
+		if s.Stage == "account" {
+			continue
+		}
+		for _, d := range s.Dropped {
+			fmt.Fprintf(w, "    #%d  %s  %s\n", d.Index, d.Reason, summarizeText(texts[d.Index], 30))
+		}
+	}
+	if trace.Error != "" {
+		fmt.Fprintf(w, "no tweet selected: %s\n", trace.Error)
+		return
+	}
+	fmt.Fprintf(w, "selected: #%d  %s\n", trace.Selected, summarizeText(texts[trace.Selected], 40))
+}
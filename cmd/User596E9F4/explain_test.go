@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExplain 選択できない理由を段階ごとに出力すること
+func TestExplain(t *testing.T) {
+	at := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	r, store := newTestRunner(t, &fakePoster{}, at)
+	store.SetSheet("admin", r.Config.Sheets.Tweets, [][]string{
+		{"index", "twitter_id", "text", "checked", "count", "tweet_url", "last_date"},
+		{"1", "user", "unchecked tweet", "0", "0", "", "2024/01/01 00:00:00"},
+		{"2", "user", "recent tweet", "1", "0", "", "2024/02/01 08:00:00"},
+		{"3", "other", "other tweet", "1", "0", "", "2024/01/01 00:00:00"},
+	})
+
+	trace, tweets, err := r.Explain(at, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Error == "" || trace.Selected != 0 {
+		t.Fatalf("trace: %+v", trace)
+	}
+
+	var b strings.Builder
+	writeExplain(&b, "", trace, tweets)
+	for _, want := range []string{
+		"account    3 -> 2",
+		"#2  posted too recently: last_date 2024/02/01 08:00:00, term_days 1  recent tweet",
+		"#1  unchecked  unchecked tweet",
+		"no tweet selected: stage checked",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("output must contain %q:\n%s", want, b.String())
+		}
+	}
+
+	if _, _, err := r.Explain(at, "unknown"); !errors.Is(err, errAccountNotFound) {
+		t.Fatalf("err: %v", err)
+	}
+}
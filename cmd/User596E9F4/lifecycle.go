@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"tweet-with-spread/cmd/User596E9F4/subsets"
+	"tweet-with-spread/libs"
+)
+
+// 投稿の削除
+// ‐ delete_after: 投稿から指定時間後に削除する 投稿履歴のdelete_atを過ぎた投稿を、スケジューラの待機中・Executorの実行時に削除する
+// ‐ delete_previous: 同じ行の前回の投稿を削除してから投稿する 前回の投稿は投稿履歴、なければ「Tweets list」のtweet_urlで特定する
+// 削除は投稿履歴（Event: deleted）と「Tweets list」のdeleted_dateに記録する
+// 削除済み（存在しない）Tweetは削除したものとする
+
+// postTweetIDs 投稿のTweetのID スレッドの場合は全てのTweet
+func postTweetIDs(post libs.LedgerEntry) []string {
+	if len(post.ThreadIDs) > 0 {
+		return post.ThreadIDs
+	}
+	if post.TweetID == "" {
+		return nil
+	}
+	return []string{post.TweetID}
+}
+
+// deleteTweets Tweetを後ろから削除する 削除済みのTweetは削除したものとする
+// 停止の指示で中断しない why: スレッドの途中までを削除した状態で残さないため
+func (r *Runner) deleteTweets(ctx context.Context, account libs.Box, ids []string) error {
+	ctx = context.WithoutCancel(ctx)
+	var errs []error
+	for i := len(ids) - 1; i >= 0; i-- {
+		err := r.Twitter.Delete(ctx, account, ids[i])
+		switch {
+		case errors.Is(err, libs.ErrTweetNotFound):
+			r.logger().Info().Str("function", "deleteTweets").Msgf("tweet already deleted: %s", ids[i])
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", ids[i], err))
+		default:
+			r.logger().Info().Str("function", "deleteTweets").Msgf("deleted tweet: %s", ids[i])
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deletePost 投稿を削除し、削除を投稿履歴・「Tweets list」に記録する
+// 同じ投稿を同時に削除しないよう排他し、削除済みの投稿は削除しない
+func (r *Runner) deletePost(ctx context.Context, account subsets.TwitterAccount, post libs.LedgerEntry) error {
+	r.deleteMu.Lock()
+	defer r.deleteMu.Unlock()
+
+	if post.ID != "" {
+		entries, err := r.Ledger.Entries()
+		if err != nil {
+			return err
+		}
+		if libs.Deleted(entries)[post.ID] {
+			return nil
+		}
+	}
+
+	ids := postTweetIDs(post)
+	if len(ids) == 0 {
+		return fmt.Errorf("no tweet id to delete, channel: %s", post.Channel)
+	}
+	if err := r.deleteTweets(ctx, account, ids); err != nil {
+		return err
+	}
+
+	deleted, err := r.Ledger.Append(libs.LedgerEntry{
+		Event:     libs.LedgerDeleted,
+		SheetRef:  post.SheetRef,
+		Account:   post.Account,
+		Index:     post.Index,
+		Channel:   post.Channel,
+		TweetID:   post.TweetID,
+		ThreadIDs: post.ThreadIDs,
+		PostID:    post.ID,
+		DeletedAt: r.Clock.Now(),
+	})
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "deletePost").Msgf("failed to append ledger, %s: %d", post.Account, post.Index)
+	}
+
+	if err := r.writeBackTweet(deleted, nil); err != nil {
+		r.logger().Warn().Str("function", "deletePost").Msgf("failed to update cell, retry later: %s", err)
+		r.enqueueWriteBack(deleted, err)
+		return nil
+	}
+	if err := r.Ledger.MarkSynced(deleted); err != nil {
+		r.logger().Error().Err(err).Str("function", "deletePost").Msgf("failed to mark ledger synced, %s: %d", post.Account, post.Index)
+	}
+	return nil
+}
+
+// previousPost delete_previousで削除する同じ行の前回の投稿 なければfalse
+// 投稿履歴の最新の投稿、なければ「Tweets list」のtweet_url（投稿後に削除していない場合）
+func previousPost(ref libs.SheetRef, account subsets.TwitterAccount, tweet subsets.TwitterTweet, history []libs.LedgerEntry) (libs.LedgerEntry, bool) {
+	if post, ok := libs.LatestPost(history, ref, account.TwitterID, tweet.Index); ok {
+		return post, true
+	}
+	for _, e := range history {
+		if e.Event == libs.LedgerPosted && e.SheetRef.SameSheet(ref) && e.Account == account.TwitterID && e.Index == tweet.Index {
+			// 投稿履歴の最新の投稿は削除済み
+			return libs.LedgerEntry{}, false
+		}
+	}
+
+	// 形式が同じため、文字列で前後を比較できる
+	if tweet.TweetURL == "" || (tweet.DeletedDate != "" && tweet.DeletedDate >= tweet.LastDate) {
+		return libs.LedgerEntry{}, false
+	}
+	id, err := subsets.ParseTweetID(tweet.TweetURL)
+	if err != nil {
+		return libs.LedgerEntry{}, false
+	}
+	return libs.LedgerEntry{SheetRef: ref, Account: account.TwitterID, Index: tweet.Index, TweetID: id, TweetURL: tweet.TweetURL}, true
+}
+
+// deleteExpired delete_afterを過ぎた投稿を削除する
+// 失敗した投稿は次回に再試行する dry runでは削除せず、ログのみ出力する
+// accountsは呼び出し元で取得した「Twitter account list」
+// why: スケジューラの待機ごとに「Twitter account list」を取得すると、Sheets APIの上限を消費するため
+func (r *Runner) deleteExpired(ctx context.Context, accounts []subsets.TwitterAccount) {
+	entries, err := r.Ledger.Entries()
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "deleteExpired").Msg("failed to read ledger")
+		return
+	}
+	expired := libs.Expired(entries, r.Clock.Now())
+	if len(expired) == 0 {
+		return
+	}
+
+	byID := make(map[string]subsets.TwitterAccount, len(accounts))
+	for _, a := range accounts {
+		byID[a.TwitterID] = a
+	}
+
+	for _, post := range expired {
+		account, ok := byID[post.Account]
+		if !ok {
+			r.logger().Warn().Str("function", "deleteExpired").Msgf("no account to delete tweet, %s: %d", post.Account, post.Index)
+			continue
+		}
+		if r.Config.IsDryRun() {
+			r.logger().Info().Str("function", "deleteExpired").Msgf("dry run, delete expired tweet, %s: %d, %v, delete at: %s", post.Account, post.Index, postTweetIDs(post), post.DeleteAt.Format(time.RFC3339))
+			continue
+		}
+		if err := r.deletePost(ctx, account, post); err != nil {
+			r.logger().Error().Err(err).Str("function", "deleteExpired").Msgf("failed to delete expired tweet, %s: %d", post.Account, post.Index)
+			continue
+		}
+		r.logger().Info().Str("function", "deleteExpired").Msgf("deleted expired tweet, %s: %d", post.Account, post.Index)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+// lifecycleTweetsRows 削除の列を含む「Tweets list」
+func lifecycleTweetsRows(deleteAfter, deletePrevious, tweetURL string) [][]string {
+	return [][]string{
+		{"index", "twitter_id", "text", "checked", "count", "tweet_url", "last_date", "delete_after", "delete_previous", "deleted_date"},
+		{"1", "user", "hello", "1", "1", tweetURL, "2024/01/01 00:00:00", deleteAfter, deletePrevious, ""},
+	}
+}
+
+// TestDeleteExpired delete_afterを過ぎた投稿のみを削除し、削除済みのTweetも削除として記録すること
+func TestDeleteExpired(t *testing.T) {
+	poster := &fakePoster{deleteErr: map[string]error{"11": libs.ErrTweetNotFound}}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, poster, at)
+	store.SetSheet("admin", r.Config.Sheets.Tweets, lifecycleTweetsRows("1", "", ""))
+
+	ref := r.tweetsSheet()
+	expired, _ := r.Ledger.Append(libs.LedgerEntry{Event: libs.LedgerPosted, SheetRef: ref, Account: "user", Index: 1, TweetID: "10", ThreadIDs: []string{"10", "11"}, PostedAt: at.Add(-2 * time.Hour), DeleteAt: at.Add(-time.Hour)})
+	r.Ledger.Append(libs.LedgerEntry{Event: libs.LedgerPosted, SheetRef: ref, Account: "user", Index: 1, TweetID: "20", PostedAt: at, DeleteAt: at.Add(time.Hour)})
+	r.Ledger.Append(libs.LedgerEntry{Event: libs.LedgerPosted, SheetRef: ref, Account: "user", Index: 1, TweetID: "30", PostedAt: at})
+
+	accounts, err := r.loadAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.deleteExpired(context.Background(), accounts)
+	// スレッドは後ろから削除し、削除済みの11は削除したものとする
+	if !reflect.DeepEqual(poster.deleted, []string{"10"}) {
+		t.Fatalf("deleted: %v", poster.deleted)
+	}
+	entries, err := r.Ledger.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted := libs.Deleted(entries); len(deleted) != 1 || !deleted[expired.ID] {
+		t.Fatalf("ledger deleted: %v", deleted)
+	}
+	rows := store.Sheet("admin", r.Config.Sheets.Tweets)
+	if rows[1][9] == "" {
+		t.Fatalf("deleted_date not written: %v", rows[1])
+	}
+	if unsynced, err := r.Ledger.Unsynced(); err != nil || len(unsynced) != 1 || unsynced[0].Event != libs.LedgerPosted {
+		// 削除は書き込み済み 投稿は行の最新のみ書き込みの記録がない
+		t.Fatalf("unsynced: %+v, %v", unsynced, err)
+	}
+
+	// 削除済みの投稿は再度削除しない
+	r.deleteExpired(context.Background(), accounts)
+	if len(poster.deleted) != 1 {
+		t.Fatalf("deleted again: %v", poster.deleted)
+	}
+}
+
+// TestDeleteExpiredNoColumn deleted_dateの列がないSheetでは、削除日時を書き込まずに完了とすること
+func TestDeleteExpiredNoColumn(t *testing.T) {
+	poster := &fakePoster{}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, poster, at)
+	rows := lifecycleTweetsRows("1", "", "")
+	for i := range rows {
+		rows[i] = rows[i][:len(rows[i])-1]
+	}
+	store.SetSheet("admin", r.Config.Sheets.Tweets, rows)
+
+	posted, _ := r.Ledger.Append(libs.LedgerEntry{Event: libs.LedgerPosted, SheetRef: r.tweetsSheet(), Account: "user", Index: 1, TweetID: "10", PostedAt: at.Add(-2 * time.Hour), DeleteAt: at.Add(-time.Hour)})
+	r.Ledger.MarkSynced(posted)
+
+	accounts, err := r.loadAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.deleteExpired(context.Background(), accounts)
+	if !reflect.DeepEqual(poster.deleted, []string{"10"}) {
+		t.Fatalf("deleted: %v", poster.deleted)
+	}
+	// 削除の記録は書き込み済みとし、再試行しない
+	if unsynced, err := r.Ledger.Unsynced(); err != nil || len(unsynced) != 0 {
+		t.Fatalf("unsynced: %+v, %v", unsynced, err)
+	}
+	if n := r.Outbox.Len(); n != 0 {
+		t.Fatalf("outbox: %d", n)
+	}
+	if got := store.Sheet("admin", r.Config.Sheets.Tweets); !reflect.DeepEqual(got, rows) {
+		t.Fatalf("sheet changed: %v", got)
+	}
+}
+
+// TestExecutorDeletePrevious delete_previousで同じ行の前回の投稿を削除してから投稿すること
+func TestExecutorDeletePrevious(t *testing.T) {
+	cases := []struct {
+		name string
+		// 前回の投稿の投稿履歴のTweetのID 空の場合はtweet_urlから特定する
+		ledgerID  string
+		deleteErr error
+		wantPost  bool
+		wantIDs   []string
+	}{
+		{"tweet url", "", nil, true, []string{"5"}},
+		{"ledger", "7", nil, true, []string{"7"}},
+		{"already deleted", "", libs.ErrTweetNotFound, true, nil},
+		{"failed", "", errors.New("rate limit"), false, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			poster := &fakePoster{}
+			if c.deleteErr != nil {
+				poster.deleteErr = map[string]error{"5": c.deleteErr}
+			}
+			at := time.Now().UTC().Truncate(time.Minute)
+			r, store := newTestRunner(t, poster, at)
+			store.SetSheet("admin", r.Config.Sheets.Tweets, lifecycleTweetsRows("", "1", "https://twitter.com/i/web/status/5"))
+			if c.ledgerID != "" {
+				r.Ledger.Append(libs.LedgerEntry{Event: libs.LedgerPosted, SheetRef: r.tweetsSheet(), Account: "user", Index: 1, TweetID: c.ledgerID, PostedAt: at.AddDate(0, 0, -7)})
+			}
+
+			summary := r.Executor(context.Background(), at)
+			if (summary.Posted == 1) != c.wantPost || len(poster.texts) != summary.Posted {
+				t.Fatalf("summary: %+v", summary)
+			}
+			if !reflect.DeepEqual(poster.deleted, c.wantIDs) {
+				t.Fatalf("deleted: %v, want %v", poster.deleted, c.wantIDs)
+			}
+			if !c.wantPost {
+				return
+			}
+			rows := store.Sheet("admin", r.Config.Sheets.Tweets)
+			if rows[1][5] != libs.ID2TwitterURL("1") || rows[1][9] == "" {
+				t.Fatalf("row: %v", rows[1])
+			}
+		})
+	}
+}
+
+// TestPlanDelete dry runでは削除せず、投稿予定に削除するTweet・削除する時刻を含めること
+func TestPlanDelete(t *testing.T) {
+	poster := &fakePoster{}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, poster, at)
+	r.Config.DryRun = true
+	store.SetSheet("admin", r.Config.Sheets.Tweets, lifecycleTweetsRows("24", "1", "https://x.com/user/status/5"))
+
+	summary := r.Executor(context.Background(), at)
+	if summary.Planned != 1 || len(poster.deleted) != 0 {
+		t.Fatalf("summary: %+v, deleted: %v", summary, poster.deleted)
+	}
+	plan := summary.Results[0].Plan
+	if !reflect.DeepEqual(plan.Delete, []string{"5"}) || plan.DeleteAt == nil || plan.DeleteAt.Sub(at) < 24*time.Hour {
+		t.Fatalf("plan: %+v", plan)
+	}
+}
+
+// TestValidateSheetsLifecycle 削除の列の誤り・削除日時の列がないSheetを誤りとして返すこと
+func TestValidateSheetsLifecycle(t *testing.T) {
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, &fakePoster{}, at)
+	store.SetSheet("admin", r.Config.Sheets.Tweets, [][]string{
+		{"index", "twitter_id", "text", "checked", "delete_after", "delete_previous", "mode"},
+		{"1", "user", "hello", "1", "24", "", ""},
+		{"2", "user", "hello", "1", "-1", "2", ""},
+		{"3", "user", "hello", "1", "", "1", "gui"},
+	})
+
+	issues, err := r.ValidateSheets(at, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, i := range issues {
+		got = append(got, i.Index)
+	}
+	// 1: deleted_dateの列がない 2: 値の誤り 3: deleted_dateの列がない・GUI
+	if !reflect.DeepEqual(got, []int{1, 2, 3, 3}) {
+		t.Fatalf("issues: %+v", issues)
+	}
+}
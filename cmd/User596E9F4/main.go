@@ -2,6 +2,7 @@
 Rules:
 
 - プロジェクトにより変化するデータ構造や条件などは当ファイル内関数で設定することで汎化性を確保する
+- 実行環境により変化する設定（Sheet名・待機時間・ファイルパスなど）は設定ファイル・環境変数・コマンドライン引数で指定する -> config.go、再ビルドせずに変更する
 - Google Cloudクレデンシャルファイルを取得し指定ファイルパスに存在すること -> Google spreadsheetにアクセス権を得る
 - Google Spreadsheet APIが有効であること -> Google spreadsheetにアクセスする権限をアカウント及びクレデンシャルに付与する
 - Google spreadsheetはURL共有状態であること -> Google spreadsheetにアクセスされることを承認する
@@ -10,8 +11,11 @@ Rules:
 - Google spreadsheet各項目でYes/Noを表現する場合は半角数字0/1であること -> プログラムで文字列の0/1をBool型にし、1であればYes、その他数字はNoとする
 - Google spreadsheetで[files]はセル区切りで4つまで記述可能。文字列は半角英数字・Spaceなし -> プログラムでセル区切りの文字列を配列にする。重いファイルは無視される
 - Google spreadsheetでFile各項は同アカウント内Dirveに保存されたFileであり、FileID及びFileIDを含むURLであること -> プログラムで文字列を取得しダウンロード、Fileデータを生成する
+- Google spreadsheetでscheduleはcron式（分 時 日 月 曜日）で指定する -> 指定がない場合はhours, minutesを使用する
 - Google spreadsheetでhours, minutesは半角数字で、,区切りで指定する -> プログラムで文字列を数値の配列にする
-- Google spreadsheetでプログラムによって更新される列はかならず最後の列であること -> プログラムで最後の列を指定し更新する
+- Google spreadsheetでtimezoneはIANAタイムゾーン名（例: Asia/Tokyo）で指定する -> 指定がない場合はプロセスのタイムゾーン
+- Google spreadsheetでcatchupはskip/once/allのいずれか、catchup_graceは半角数字（分）で指定する -> 停止・遅延で過ぎた投稿時刻の扱い。指定がない場合はskip
+- Google spreadsheetでプログラムによって更新される列(count, tweet_url, last_date)は列名で特定する -> 列の位置は問わない。列名は変更しないこと
 - Google spreadsheetで年月日指定は半角数字記号でYYYY/MM/DD HH:MM:SSであること -> プログラムで年月日を指定し、日付を比較する
 
 
@@ -20,7 +24,14 @@ Rules:
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 	"tweet-with-spread/cmd/User596E9F4/subsets"
 	"tweet-with-spread/libs"
@@ -31,272 +42,882 @@ import (
 )
 
 const (
-	// Debug: プログラムの実行環境
-	IS_PRODUCT = true
-	// Debug: Twitter投稿を行うかどうか
-	IS_TWITTER_POST = true
-	// 起動間隔
-	INTERVAL time.Duration = 1 * time.Minute
-
-	// 文字数での投稿先の分岐 -> GUI/API
-	TWEETCOUNT_JA = 140
-
-	// Google Spreadsheet Accounts Sheet ID
-	ACCOUNTSHEETTITLE = "twitter_users"
-	// Google Spreadsheet Tweets Sheet ID
-	TWEETSSHEETTITLE = "twitter_tweets"
-	// Google Spreadsheet Search Sheet ID
-	SEARCHSHEETTITLE = "twitter_search"
-	// Google Spreadsheet Sheetの取得範囲
-	SHEET_RANGE = "A1:Z"
-
-	// ランダム待機時間（秒）
-	MAXWAITSEC = 150
+	// 投稿の実行待ちの上限
+	MAXQUEUE = 100
+	// 投稿の開始期限 投稿時刻からこの時間内に開始できない投稿は取り除く
+	// why: 前の投稿が長引いた場合に、大きく遅れた投稿を行わないため
+	JOBDEADLINE = 10 * time.Minute
+	// 停止の指示（SIGTERM・SIGINT）から、実行中の投稿の終了を待つ上限
+	// 実行環境の猶予（Cloud Runは既定10秒、GCEは既定90秒）に合わせて調整する
+	SHUTDOWNTIMEOUT = 30 * time.Second
 )
 
-var (
-	// Google Cloudクレデンシャルファイル
-	// 同階層に置いてください
-	CREDENTIALJSONFILE string
-
-	// Google Spreadsheet ID
-	// AccountsListが記載されている管理者用Spreadsheet
-	SPREADSHEET_ID string
-)
-
-func init() {
-	// ログの設定
-	// 出力レベルを変える
-	// 	- Debug: デバッグ用
-	// 	- Info: 通常のログ
-	// 	- Warn: 警告
-	// 	- Error: エラー
-	// 	- Fatal: 致命的なエラー
-	// 	- Panic: プログラムが続行できないエラー
-	if IS_PRODUCT {
+// setLogLevel ログの出力レベルを変える
+//   - Debug: デバッグ用
+//   - Info: 通常のログ
+//   - Warn: 警告
+//   - Error: エラー
+//   - Fatal: 致命的なエラー
+//   - Panic: プログラムが続行できないエラー
+func setLogLevel(product bool) {
+	if product {
 		zerolog.SetGlobalLevel(zerolog.WarnLevel)
 	} else {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
+}
 
-	// ファイル場所の指定
-	CREDENTIALJSONFILE = os.Getenv("CREDENTIAL")
-	if CREDENTIALJSONFILE == "" {
-		log.Fatal().Msg("CREDENTIAL is not set")
+// Runner Executorの実行に必要な依存を保持する
+// テナント（管理者用Spreadsheet）ごとに作成し、スケジュール・API Limit・投稿履歴を共有しない
+type Runner struct {
+	// テナント名 ログに付与する
+	Tenant string
+	// 実行時の設定
+	Config Config
+	// Google Driveファイルの取得に使用するクレデンシャル
+	Cred []byte
+	// Spreadsheetの読み書き先
+	Store libs.SheetStore
+	// Tweetの投稿先
+	Twitter Poster
+	// Tweetの選択・待機の基準時刻
+	Clock libs.Clock
+	// Tweetの選択・待機時間の乱数
+	Rand libs.Rand
+	// 投稿履歴
+	Ledger *libs.Ledger
+	// 失敗したSpreadsheetへの書き込みの再試行待ち
+	Outbox *libs.Outbox
+	// スケジュールの処理済み時刻
+	Checkpoint *libs.Checkpoint
+	// 投稿の実行 同時実行数を制限し、同じアカウントの投稿は同時に行わない
+	Pool *libs.WorkerPool
+
+	// 投稿の削除を排他する
+	deleteMu sync.Mutex
+}
+
+func main() {
+	// 設定を読み込む
+	// 誤りがある場合は起動せずFatalで終了する
+	cfg, cmd, err := LoadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load config")
+	}
+	setLogLevel(cfg.Product)
+	tenants, err := cfg.Tenants()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load tenants")
+	}
+	if cmd.Name == "plan" || cmd.Name == "explain" || cmd.Name == "validate" {
+		// plan・explain・validateは読み取りのみ 起動・終了時の書き込み待ちの書き込みも行わない
+		for i := range tenants {
+			tenants[i].Config.DryRun = true
+		}
 	}
 
-	// Google Spread IDの指定
-	SPREADSHEET_ID = os.Getenv("SPREADSHEET_ID")
-	if SPREADSHEET_ID == "" {
-		log.Fatal().Msg("SPREADSHEET_ID is not set")
+	// 停止の指示を受けるとctxを終了する
+	// ‐ 待機・ファイルのダウンロード・APIリクエスト・GUI操作を中断し、新しい投稿を始めない
+	// ‐ 投稿を始めた後の投稿履歴・Spreadsheetへの書き込みは中断しない
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	runners := make([]*Runner, 0, len(tenants))
+	for _, t := range tenants {
+		r, err := newRunner(t)
+		if err != nil {
+			log.Fatal().Err(err).Str("tenant", t.Name).Msg("failed to start tenant")
+		}
+		runners = append(runners, r)
 	}
+
+	log.Info().Msgf("Start Program, tenants: %d", len(runners))
+
+	// 実行モード
+	// ‐ 引数なし: 常駐し、テナントごと・アカウントごとのスケジュールに従って投稿する
+	// ‐ serve: HTTPリクエスト（POST /run）を受けてExecutorを実行する。Cloud Scheduler・Cloud Runなどでの実行用
+	// ‐ run: Executorを1回実行し、結果を出力する。dry runでの投稿予定の確認用
+	// ‐ plan: 期間内の投稿を模擬し、アカウントごとの予定を出力する
+	// ‐ explain: アカウントのTweetの選択を1回行い、候補を除外した理由を出力する
+	// ‐ validate: Sheetの設定（textのテンプレートなど）の誤りを行ごとに出力する
+	switch cmd.Name {
+	case "serve":
+		if err := Serve(ctx, cfg.Serve, runners...); err != nil {
+			log.Error().Err(err).Str("function", "main").Msg("failed to serve")
+		}
+	case "run":
+		if err := runCommand(ctx, runners, cmd.Args); err != nil {
+			log.Error().Err(err).Str("function", "main").Msg("failed to run")
+		}
+	case "plan":
+		if err := planCommand(runners, cmd.Args); err != nil {
+			log.Error().Err(err).Str("function", "main").Msg("failed to plan")
+		}
+	case "explain":
+		if err := explainCommand(runners, cmd.Args); err != nil {
+			log.Error().Err(err).Str("function", "main").Msg("failed to explain")
+		}
+	case "validate":
+		if err := validateCommand(runners, cmd.Args); err != nil {
+			log.Error().Err(err).Str("function", "main").Msg("failed to validate")
+		}
+	default:
+		each(runners, func(r *Runner) { r.runScheduler(ctx) })
+	}
+
+	// 停止の猶予内に終えるため、テナントごとに並行して終了する
+	each(runners, (*Runner).shutdown)
 }
 
-func main() {
-	// INTERVAL値による定期実行
-	t := time.NewTicker(INTERVAL)
-	defer t.Stop()
-
-	// 認証があるSpreadsheetを取得する場合はCREDENTIALJSONFILEを指定する
-	// ない場合は起動せずFatalで終了する
-	cred := libs.ReadCredentialToByte(CREDENTIALJSONFILE)
-
-	// TwitterAPIのHTTPリクエストをインターセプトする
-	// ‐ API Limitを取得し、残り回数でリクエストを制御する
-	li := libs.NewLoggingInterceptor()
-
-	// 分の開始0秒に開始するために、初回の実行を待つ
-	sub := time.Since(time.Now().Truncate(time.Minute))
-	time.Sleep(INTERVAL - sub)
-
-	log.Info().Msg("Start Program")
-
-	for t := range t.C {
-		// 定期実行本体: 並列処理/待機有り
-		// ‐ INTERVAL毎にExecutorを実行する
-		// ‐ Executor内でSpreadsheetからデータを取得し、Tweetを投稿する
-		// ‐ Tweet投稿後、Spreadsheetに投稿日を記録する
-		// ‐ その後、次のINTERVALを待つ
-
-		// Executor内のエラーについて
-		// ‐ Executor内で実行するための必要なファイルが見つからない場合は、Fatalでメインプログラムごと強制終了
-		// ‐ Executor内でエラーが発生した場合、ログを出力し終了
-		// - 次のINTERVALを待つ
-		// - 実行関数が呼び出された時間を引数にする
-		if t.Minute()%5 != 0 {
+// newRunner テナントの設定からRunnerを作成する
+// 投稿履歴・書き込み待ち・処理済み時刻を開けない場合は、重複投稿・投稿結果の消失を防げないためエラーを返す
+func newRunner(t Tenant) (*Runner, error) {
+	cfg := t.Config
+
+	// 認証があるSpreadsheetを取得する場合はcredentialを指定する
+	// 読み込めない場合は起動せずFatalで終了する
+	var cred []byte
+	if cfg.Credential != "" {
+		cred = libs.ReadCredentialToByte(cfg.Credential)
+	}
+
+	// 投稿履歴を開く
+	ledger, err := libs.OpenLedger(cfg.LedgerFile)
+	if err != nil {
+		return nil, libs.SetError(err, "failed to open ledger")
+	}
+
+	// 書き込み待ちを開く
+	outbox, err := libs.OpenOutbox(cfg.OutboxFile)
+	if err != nil {
+		return nil, libs.SetError(err, "failed to open outbox")
+	}
+
+	// スケジュールの処理済み時刻を開く
+	// 前回の停止中に過ぎた投稿時刻を検出するために使用する
+	checkpoint, err := libs.OpenCheckpoint(cfg.SchedulerFile)
+	if err != nil {
+		return nil, libs.SetError(err, "failed to open scheduler checkpoint")
+	}
+
+	rnd := newRand(cfg.Seed)
+	return &Runner{
+		Tenant: t.Name,
+		Config: cfg,
+		Cred:   cred,
+		// Spreadsheetの読み書き先を選択する
+		Store: newSheetStore(cfg, cred),
+		// TwitterAPIのHTTPリクエストをインターセプトする
+		// ‐ API Limitを取得し、残り回数でリクエストを制御する。テナントごとに保持する
+		Twitter:    newTwitterPoster(libs.GUIOptions{MaxWaitForUpload: cfg.MaxWaitForUpload, Rand: rnd}),
+		Clock:      libs.SystemClock{},
+		Rand:       rnd,
+		Ledger:     ledger,
+		Outbox:     outbox,
+		Checkpoint: checkpoint,
+		Pool:       libs.NewWorkerPool(cfg.Workers, MAXQUEUE),
+	}, nil
+}
+
+// newRand seedで初期化した乱数 seedが0の場合は現在時刻で初期化する
+func newRand(seed int64) libs.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return libs.NewRand(seed)
+}
+
+// each テナントごとに並行してfを実行し、すべての終了を待つ
+func each(runners []*Runner, f func(r *Runner)) {
+	var wg sync.WaitGroup
+	for _, r := range runners {
+		wg.Add(1)
+		go func(r *Runner) {
+			defer wg.Done()
+			f(r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// logger テナント名を付与したログ
+func (r *Runner) logger() *zerolog.Logger {
+	if r.Tenant == "" {
+		return &log.Logger
+	}
+	l := log.With().Str("tenant", r.Tenant).Logger()
+	return &l
+}
+
+// runScheduler 常駐し、アカウントごとのスケジュールに従ってExecutorを実行する
+// ctxが終了するまで戻らない
+func (r *Runner) runScheduler(ctx context.Context) {
+	// 定期実行本体: 並列処理/待機有り
+	// ‐ アカウントごとのスケジュール（cron式・タイムゾーン）から次回投稿時刻を求め、その時刻まで待機する
+	// ‐ 次回投稿時刻にExecutorを実行する。Executor内でSpreadsheetからデータを取得し、Tweetを投稿する
+	// ‐ 投稿はworkers個まで同時に実行し、同じアカウントの投稿は順に実行する
+	// ‐ Tweet投稿後、Spreadsheetに投稿日を記録する
+	// ‐ 待機中もinterval毎にTwitter account listを再取得し、スケジュールの変更を反映する
+
+	// Executor内のエラーについて
+	// ‐ Executor内で実行するための必要なファイルが見つからない場合は、Fatalでメインプログラムごと強制終了
+	// ‐ Executor内でエラーが発生した場合、ログを出力し終了
+	// - 次の投稿時刻を待つ
+	// - 実行関数が呼び出された投稿時刻を引数にする
+
+	// 停止・遅延で過ぎた投稿時刻について
+	// ‐ 処理済みの時刻をscheduler_fileに保存し、起動時・待機からの復帰時に過ぎた投稿時刻を検出する
+	// ‐ アカウントのcatchup列の扱い（skip/once/all）に従って投稿し、判断をログに出力する
+	last, err := r.Checkpoint.Load()
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "runScheduler").Msg("failed to load scheduler checkpoint")
+	}
+	if last.IsZero() {
+		// 初回起動時は過ぎた投稿時刻を扱わない
+		last = r.Clock.Now()
+	}
+	day := r.Clock.Now().Day()
+	for ctx.Err() == nil {
+		accounts, err := r.loadAccounts()
+		if err != nil {
+			r.logger().Error().Err(err).Str("function", "runScheduler").Msg("failed to get account list")
+		}
+
+		// 前回処理した時刻から現在までに過ぎた投稿時刻を処理する
+		now := r.Clock.Now()
+		if missed, ok := subsets.NextFire(last, accounts); ok && !missed.After(now) {
+			from := last
+			go r.report(func() ExecSummary { return r.CatchUp(ctx, from, now, accounts) })
+			last = now
+			r.saveCheckpoint(last)
 			continue
 		}
-		go Executor(cred, li, t)
+
+		// 次回投稿時刻がintervalより先であれば、interval後に再取得する
+		wake := r.Clock.Now().Add(r.Config.Interval)
+		next, ok := subsets.NextFire(last, accounts)
+		isFire := ok && !next.After(wake)
+		if isFire {
+			wake = next
+		}
+		r.logger().Debug().Str("function", "runScheduler").Msgf("next fire: %s, wake: %s", next, wake)
+
+		if err := r.Clock.Sleep(ctx, wake.Sub(r.Clock.Now())); err != nil {
+			return
+		}
 
 		// 1日の終りに一時ファイルを削除
-		if t.Hour() == 0 && t.Minute() == 0 {
-			if err := libs.CleanDir(subsets.TEMPORARYDIR); err != nil {
-				log.Err(err).Msg("failed to remove files")
+		if wake.Day() != day {
+			day = wake.Day()
+			if err := libs.CleanDir(r.Config.TemporaryDir); err != nil {
+				r.logger().Err(err).Msg("failed to remove files")
 			}
 		}
+
+		if isFire {
+			// 待機から大きく遅れて復帰した場合は、過ぎた投稿時刻として次の周回で処理する
+			if now := r.Clock.Now(); now.Sub(next) > subsets.CATCHUPTOLERANCE {
+				r.logger().Warn().Str("function", "runScheduler").Msgf("scheduler stalled, fire: %s, now: %s", next.Format(time.RFC3339), now.Format(time.RFC3339))
+				continue
+			}
+			// 投稿前に処理済みとして保存する
+			// why: 投稿中に停止した場合に、再起動後に同じ投稿時刻で重複投稿しないため
+			last = next
+			r.saveCheckpoint(last)
+			go r.report(func() ExecSummary { return r.Executor(ctx, next) })
+			continue
+		}
+
+		// 投稿がない間も、失敗したSpreadsheetへの書き込みを再試行し、delete_afterを過ぎた投稿を削除する
+		// 削除するアカウントはこの周回で取得した「Twitter account list」から探す
+		r.syncPending()
+		if accounts != nil {
+			r.deleteExpired(ctx, accounts)
+		}
+	}
+}
+
+// report fを実行し、dry runの場合は投稿予定を出力する
+func (r *Runner) report(f func() ExecSummary) {
+	summary := f()
+	if r.Config.IsDryRun() {
+		writeReport(summary)
+	}
+}
+
+// shutdown 実行中の投稿の終了をSHUTDOWNTIMEOUTまで待ち、投稿結果の書き込みを試行してから終了する
+// 開始していない投稿は行わない
+func (r *Runner) shutdown() {
+	r.logger().Info().Str("function", "shutdown").Msg("shutting down, wait for in-flight posts")
+
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWNTIMEOUT)
+	defer cancel()
+	if err := r.Pool.Shutdown(ctx); err != nil {
+		r.logger().Error().Err(err).Str("function", "shutdown").Msg("in-flight posts did not finish, unsynced posts will be replayed on next start")
+	}
+
+	// 終了前に書き込み待ちを書き込む 失敗したものは次回起動時に再試行する
+	r.syncPending()
+
+	r.logger().Info().Str("function", "shutdown").Msg("stopped")
+}
+
+// saveCheckpoint スケジュールの処理済み時刻を保存する
+// 保存に失敗しても投稿は続ける（再起動時に過ぎた投稿時刻として扱われる）
+// dry runでは保存しない why: dry runの後の実行で、過ぎた投稿時刻を扱うため
+func (r *Runner) saveCheckpoint(t time.Time) {
+	if r.Config.IsDryRun() {
+		return
+	}
+	if err := r.Checkpoint.Save(t); err != nil {
+		r.logger().Error().Err(err).Str("function", "main").Msg("failed to save scheduler checkpoint")
+	}
+}
+
+// loadAccounts Google spreadsheet「Twitter account list」を取得、指定の型にBindする
+func (r *Runner) loadAccounts() ([]subsets.TwitterAccount, error) {
+	twitterAccounts := make([]subsets.TwitterAccount, 0)
+	if _, err := r.Store.GetSheet(r.Config.SpreadsheetID, r.Config.Sheets.Accounts, r.Config.Sheets.Range, &twitterAccounts); err != nil {
+		return nil, err
+	}
+	return twitterAccounts, nil
+}
+
+// newSheetStore sheet_dirの指定があればCSVディレクトリ、なければGoogle Spreadsheetを使用する
+// why: オフライン・ステージングで一連の処理を実行するため
+func newSheetStore(cfg Config, cred []byte) libs.SheetStore {
+	if cfg.SheetDir != "" {
+		log.Info().Msgf("use csv sheet store: %s", cfg.SheetDir)
+		return libs.NewCSVSheetStore(cfg.SheetDir)
 	}
+	return libs.NewGoogleSheetStore(cred)
 }
 
 // Executor Google Scheduleで定期実行することを想定
-// Pingが飛んできたら実行する
-func Executor(cred []byte, li *libs.LoggingInterceptor, t time.Time) {
-	log.Info().Str("function", "Executor").Msg("start")
+// Pingが飛んできたら実行する（serveモード: POST /run）
+// 投稿時刻tに投稿するアカウントの投稿を実行し、すべての投稿が終わるまで待って結果を返す
+func (r *Runner) Executor(ctx context.Context, t time.Time) ExecSummary {
+	r.logger().Info().Str("function", "Executor").Msg("start")
+	summary := r.newSummary(t)
+
+	// 前回までにSpreadsheetへの書き込みに失敗した投稿結果を書き込む
+	r.syncPending()
+
 	// Google spreadsheet「Twitter account list」を取得、指定の方にBindする
-	// 追加でDataframeを返しているが、現行未使用
 	// ‐ 適用案: Twitter account listの行に「0/1」を含む列を作り、投稿の可否を管理する
-	twitterAccounts := make([]subsets.TwitterAccount, 0)
-	_, err := libs.GetSheet(cred, SPREADSHEET_ID, ACCOUNTSHEETTITLE, SHEET_RANGE, &twitterAccounts)
+	twitterAccounts, err := r.loadAccounts()
 	if err != nil {
-		log.Error().Err(err).Str("function", "Executor").Msgf("Failed to get list")
-		return
+		r.logger().Error().Err(err).Str("function", "Executor").Msgf("Failed to get list")
+		summary.Error = err.Error()
+		return summary
 	}
+	// delete_afterを過ぎた投稿を削除する
+	r.deleteExpired(ctx, twitterAccounts)
 
 	// Twitter account listから投稿するべきアカウントを取得する
 	targetAccounts, err := subsets.SelectTwitterAccounts(t, twitterAccounts)
 	if err != nil {
-		log.Debug().Str("function", "Executor").Msgf("%v > no accounts in list", err)
-		return
+		r.logger().Debug().Str("function", "Executor").Msgf("%v > no accounts in list", err)
+		return summary
 	}
 
 	// // For内において１アカウント、１Tweet
 	// 現状、アカウント別のツイート選択条件はない。同一条件である
+	var c summaryCollector
 	for i := 0; i < len(targetAccounts); i++ {
-		// Google spreadsheet「Tweets list for Target Account」を取得
-		// ‐ 現行: 同Spreadsheet内Sheet
-		// ‐ 適用案: Twitter account list各IDに該当するSpreadsheetIDとSheetID項目を付与する
-		twitterTweets := make([]subsets.TwitterTweet, 0)
-		dfTweets, err := libs.GetSheet(cred, targetAccounts[i].SpreadID, TWEETSSHEETTITLE, SHEET_RANGE, &twitterTweets)
-		if err != nil {
-			log.Error().Err(err).Str("function", "Executor").Msgf("failed to get list, %s", targetAccounts[i].TwitterID)
+		summary.Selected = append(summary.Selected, targetAccounts[i].TwitterID)
+		r.submitPost(ctx, targetAccounts[i], t, &c)
+	}
+	c.wait(&summary)
+
+	r.logger().Info().Str("function", "Executor").Msgf("end, selected: %d, posted: %d, failed: %d, skipped: %d, planned: %d", len(summary.Selected), summary.Posted, summary.Failed, summary.Skipped, summary.Planned)
+	return summary
+}
+
+// newSummary 投稿時刻tの実行結果
+func (r *Runner) newSummary(t time.Time) ExecSummary {
+	return ExecSummary{Tenant: r.Tenant, DryRun: r.Config.IsDryRun(), At: t, Selected: []string{}, Results: []PostResult{}}
+}
+
+// CatchUp 前回処理した時刻fromから現在時刻nowまでに過ぎた投稿時刻を、アカウントのcatchup列の扱いに従って投稿する
+// アカウントごとの判断はログに出力する
+// すべての投稿が終わるまで待って結果を返す
+func (r *Runner) CatchUp(ctx context.Context, from, now time.Time, accounts []subsets.TwitterAccount) ExecSummary {
+	r.logger().Info().Str("function", "CatchUp").Msgf("start, from: %s, now: %s", from.Format(time.RFC3339), now.Format(time.RFC3339))
+	summary := r.newSummary(now)
+
+	r.syncPending()
+
+	var c summaryCollector
+
+	for _, account := range accounts {
+		if account.Subscribed != 1 {
 			continue
 		}
 
-		// Tweetsから指定条件で抜粋
-		tweet, err := subsets.SelectTweet(targetAccounts[i], twitterTweets)
+		d, err := subsets.PlanCatchUp(account, from, now)
 		if err != nil {
-			log.Error().Err(err).Str("function", "Executor").Msgf("filed select tweets, %s", targetAccounts[i].TwitterID)
+			r.logger().Warn().Str("function", "CatchUp").Msgf("invalid schedule, %s: %s", account.TwitterID, err)
+			continue
+		}
+		if len(d.Missed) == 0 {
 			continue
 		}
+		r.logger().Warn().Str("function", "CatchUp").Msgf("missed slots, %s: missed: %d, post: %d, policy: %s > %s", account.TwitterID, len(d.Missed), len(d.Post), d.Policy, d.Reason)
 
-		// // Debug: Tweetを指定
-		// tweet = &twitterTweets[len(twitterTweets)-1]
-		if !IS_PRODUCT {
-			log.Debug().Msgf("all rows start-----------------")
-			for i := 0; i < len(targetAccounts); i++ {
-				log.Debug().Str("function", "Executor").Msgf("account: %+v", targetAccounts[i])
+		for range d.Post {
+			summary.Selected = append(summary.Selected, account.TwitterID)
+		}
+		// 2回目以降はCATCHUPINTERVALの間隔で実行待ちに追加する
+		// 投稿の追加が終わるまで、投稿結果の集計を終えない
+		c.wg.Add(1)
+		go func(account subsets.TwitterAccount, post []time.Time) {
+			defer c.wg.Done()
+			for i, t := range post {
+				if i > 0 {
+					// 停止の指示で中断した場合は、submitPostで投稿しない
+					_ = r.Clock.Sleep(ctx, subsets.CATCHUPINTERVAL)
+				}
+				r.logger().Info().Str("function", "CatchUp").Msgf("post missed slot, %s: %s", account.TwitterID, t.Format(time.RFC3339))
+				// 過ぎた投稿時刻ではなく、実行待ちに追加した時刻から開始期限を設ける
+				r.submitPost(ctx, account, r.Clock.Now(), &c)
 			}
+		}(account, d.Post)
+	}
+	c.wait(&summary)
+	return summary
+}
 
-			for i := 0; i < len(twitterTweets); i++ {
-				log.Debug().Str("function", "Executor").Msgf("tweets: %+v", twitterTweets[i])
+// submitPost アカウントの投稿を実行待ちに追加する
+// ‐ 同じアカウントの投稿は前の投稿が終わってから実行する
+// ‐ slotからJOBDEADLINE内に開始できない場合は投稿しない
+// cの指定があれば投稿結果を追加する
+func (r *Runner) submitPost(ctx context.Context, account subsets.TwitterAccount, slot time.Time, c *summaryCollector) {
+	result := PostResult{Account: account.TwitterID}
+	// 投稿結果は1回だけ追加する why: Jobがpanicした場合に、Dropからも呼び出されるため
+	var once sync.Once
+	done := func(p PostResult) {
+		once.Do(func() {
+			if c != nil {
+				c.add(p)
+				c.wg.Done()
 			}
+		})
+	}
+	if c != nil {
+		c.wg.Add(1)
+	}
 
-			log.Debug().Str("function", "Executor").Msgf("select one: %+v", tweet)
+	if err := ctx.Err(); err != nil {
+		r.logger().Info().Str("function", "submitPost").Msgf("shutting down, skip post, %s", account.TwitterID)
+		done(result.skip(err))
+		return
+	}
+	err := r.Pool.Submit(libs.Job{
+		Key:      account.TwitterID,
+		Deadline: slot.Add(JOBDEADLINE),
+		Run: func() {
+			// 投稿履歴は実行時に取得する
+			// why: 同じアカウントの前の投稿を反映し、同じTweetを続けて選択しないため
+			// 取得できない場合は重複投稿を防げないため実行しない
+			history, err := r.Ledger.Entries()
+			if err != nil {
+				r.logger().Error().Err(err).Str("function", "submitPost").Msg("failed to read ledger")
+				done(result.fail(err))
+				return
+			}
+			done(r.postForAccount(ctx, account, history))
+		},
+		Drop: func(err error) {
+			if errors.Is(err, libs.ErrJobPanicked) {
+				done(result.fail(err))
+				return
+			}
+			done(result.skip(err))
+		},
+	})
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "submitPost").Msgf("failed to submit post, %s: %s", account.TwitterID, slot.Format(time.RFC3339))
+		done(result.fail(err))
+	}
+}
 
-			log.Debug().Str("function", "Executor").Msgf("all rows end-----------------")
+// postForAccount アカウントのTweetsから1件を選択して投稿し、投稿結果を記録する
+// history: 投稿履歴 重複投稿の防止に使用する
+func (r *Runner) postForAccount(ctx context.Context, account subsets.TwitterAccount, history []libs.LedgerEntry) PostResult {
+	result := PostResult{Account: account.TwitterID}
 
-			return
+	// Google spreadsheet「Tweets list for Target Account」を取得
+	// ‐ アカウントのspread_id・tweets_sheetで指定したSheet、指定がなければ管理者用Spreadsheet内Sheet
+	// ‐ 投稿結果は同じSheetに書き込む
+	tweetsRef, dfTweets, twitterTweets, err := r.readTweets(account)
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to get list, %s", account.TwitterID)
+		return result.fail(err)
+	}
+
+	// Tweetsから指定条件で抜粋
+	tweet, trace, err := subsets.SelectTweet(r.Clock.Now(), r.Rand, account, tweetsRef, twitterTweets, history)
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("filed select tweets, %s: %s", account.TwitterID, trace.Summary())
+		result.Trace = &trace
+		return result.fail(err)
+	}
+	result.Index = tweet.Index
+
+	// // Debug: Tweetを指定
+	// tweet = &twitterTweets[len(twitterTweets)-1]
+	if !r.Config.Product {
+		r.logger().Debug().Msgf("all rows start-----------------")
+		r.logger().Debug().Str("function", "postForAccount").Msgf("account: %+v", account)
+
+		for i := 0; i < len(twitterTweets); i++ {
+			r.logger().Debug().Str("function", "postForAccount").Msgf("tweets: %+v", twitterTweets[i])
 		}
 
-		// ランダムな待機時間を設定
-		subsets.Wait(MAXWAITSEC)
-
-		// 長文ツイートでの分岐
-		// 	// Option: 選択したTweetに画像が含まれる場合は画像をアップロードしてMediaIDを取得する
-		log.Debug().Str("function", "Executor").Msgf("selected tweet id: %+v", tweet.Index)
-		var files = tweet.Tofiles(cred)
-		log.Debug().Str("function", "Executor").Msgf("setup files: %+v", files)
-		if len([]rune(tweet.Text)) > TWEETCOUNT_JA {
-			if err := libs.TweetsToGUI(
-				IS_TWITTER_POST,
-				tweet.WithFiles == 1,
-				targetAccounts[i].TwitterID,
-				targetAccounts[i].Password,
-				tweet.Text,
-				files); err != nil {
-				log.Err(err).Msgf("failed to tweeting for GUI, %s: %d", targetAccounts[i].TwitterID, tweet.Index)
-				continue
-			}
+		r.logger().Debug().Str("function", "postForAccount").Msgf("select one: %+v", tweet)
+
+		r.logger().Debug().Str("function", "postForAccount").Msgf("all rows end-----------------")
+	}
 
-			// 要検討: GUIで投稿した場合は、TwitterAPI v1 TweetsでTweetURLを更新
-			// API Limitを消費するため、現状は未実装
+	// ランダムな待機時間を設定 dry runでは待機しない
+	if !r.Config.IsDryRun() {
+		if err := subsets.Wait(ctx, r.Clock, r.Rand, r.Config.MaxWaitSec); err != nil {
+			r.logger().Info().Str("function", "postForAccount").Msgf("canceled to wait, %s: %s", account.TwitterID, err)
+			return result.skip(err)
+		}
+	}
 
-		} else {
-			req, err := subsets.RequestCreateTweet(targetAccounts[i], tweet, files)
-			if err != nil {
-				log.Error().Err(err).Str("function", "Executor").Msgf("failed to create tweet request, %s: %d", targetAccounts[i].TwitterID, tweet.Index)
-				continue
-			}
-			log.Debug().Str("function", "Executor").Msgf("tweet request: %+v", req)
-			res, err := li.Tweeting(
-				IS_TWITTER_POST,
-				targetAccounts[i],
-				req,
-			)
-			if err != nil {
-				log.Error().Err(err).Str("function", "Executor").Msgf("failed to tweeting, twitter id: %s, index: %d", targetAccounts[i].TwitterID, tweet.Index)
-				continue
+	// 長文ツイートでの分岐
+	// 	// Option: 選択したTweetに画像が含まれる場合は画像をアップロードしてMediaIDを取得する
+	r.logger().Debug().Str("function", "postForAccount").Msgf("selected tweet id: %+v", tweet.Index)
+	var files = tweet.Tofiles(ctx, r.Cred, r.Config.TemporaryDir)
+	r.logger().Debug().Str("function", "postForAccount").Msgf("setup files: %+v", files)
+
+	// 投稿履歴に記録する内容
+	entry := libs.LedgerEntry{
+		Event:    libs.LedgerPosted,
+		SheetRef: tweetsRef,
+		Account:  account.TwitterID,
+		Index:    tweet.Index,
+		TextHash: libs.TextHash(tweet.Text),
+		Count:    tweet.Count + 1,
+	}
+
+	// textのテンプレートを投稿の直前に展開する
+	// 投稿履歴には展開前のtextのハッシュを記録し、同じTweetの重複の判定に使用する
+	text, err := r.renderText(account, *tweet, r.Clock.Now())
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to render text, %s: %d", account.TwitterID, tweet.Index)
+		return result.fail(err)
+	}
+	tweet.Text = text
+	// 投稿方法 tweetのmodeと展開後の文字数で決める
+	entry.Channel, err = tweet.Channel(tweet.Text, r.Config.WeightedLimit())
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("invalid mode, %s: %d", account.TwitterID, tweet.Index)
+		return result.fail(err)
+	}
+	// 返信・引用・投票の列は、ファイルのアップロード・投稿の前に確認する
+	if err := tweet.ValidateOptions(entry.Channel); err != nil {
+		r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("invalid tweet options, %s: %d", account.TwitterID, tweet.Index)
+		return result.fail(err)
+	}
+	// delete_previous: 同じ行の前回の投稿を削除してから投稿する
+	var previous *libs.LedgerEntry
+	if tweet.DeletePrevious == 1 {
+		if post, ok := previousPost(tweetsRef, account, *tweet, history); ok {
+			previous = &post
+		}
+	}
+
+	// dry run: Twitterに投稿せず、Spreadsheetに書き込まずに投稿予定を返す
+	if r.Config.IsDryRun() {
+		entry.PostedAt = r.Clock.Now()
+		entry.DeleteAt = deleteAt(*tweet, entry.PostedAt)
+		plan, err := r.planPost(tweet, files, entry)
+		if err != nil {
+			r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to plan post, %s: %d", account.TwitterID, tweet.Index)
+			return result.fail(err)
+		}
+		r.logger().Info().Str("function", "postForAccount").Msgf("dry run, %s: %d, channel: %s", account.TwitterID, tweet.Index, entry.Channel)
+		if previous != nil {
+			plan.Delete = postTweetIDs(*previous)
+		}
+		result.Status = PostPlanned
+		result.Channel = entry.Channel
+		result.Plan = plan
+		return result
+	}
+
+	if previous != nil {
+		if err := r.deletePost(ctx, account, *previous); err != nil {
+			r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to delete previous post, %s: %d", account.TwitterID, tweet.Index)
+			return result.fail(err)
+		}
+		r.logger().Info().Str("function", "postForAccount").Msgf("deleted previous post, %s: %d, %v", account.TwitterID, tweet.Index, postTweetIDs(*previous))
+	}
+
+	switch entry.Channel {
+	case libs.ChannelGUI:
+		if err := r.Twitter.TweetsToGUI(
+			ctx,
+			tweet.WithFiles == 1,
+			account.TwitterID,
+			account.Password,
+			tweet.Text,
+			files); err != nil {
+			r.logger().Err(err).Msgf("failed to tweeting for GUI, %s: %d", account.TwitterID, tweet.Index)
+			return result.fail(err)
+		}
+
+		// 要検討: GUIで投稿した場合は、TwitterAPI v1 TweetsでTweetURLを更新
+		// API Limitを消費するため、現状は未実装
+
+	case libs.ChannelThread:
+		reqs, err := subsets.RequestCreateThread(ctx, account, tweet, r.Config.WeightedLimit(), files)
+		if err != nil {
+			r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to create thread request, %s: %d", account.TwitterID, tweet.Index)
+			return result.fail(err)
+		}
+		ids, err := r.postThread(ctx, account, reqs)
+		if err != nil {
+			r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to tweeting thread, twitter id: %s, index: %d", account.TwitterID, tweet.Index)
+			return result.fail(err)
+		}
+		// TweetURLはスレッドの先頭
+		tweet.TweetURL = libs.ID2TwitterURL(ids[0])
+		r.logger().Info().Str("function", "postForAccount").Msgf("success tweeted thread: %s, %d tweets", tweet.TweetURL, len(ids))
+
+		entry.TweetID = ids[0]
+		entry.ThreadIDs = ids
+		for _, req := range reqs {
+			if req.Media != nil {
+				entry.MediaIDs = append(entry.MediaIDs, req.Media.MediaIDs...)
 			}
-			// TweetURLを更新
-			tweet.TweetURL = libs.ID2TwitterURL(*res.Data.ID)
-			log.Info().Str("function", "Executor").Msgf("success tweeted: %s", tweet.TweetURL)
-		}
-
-		// 行の更新にかかる変更処理はここで行う
-		// Dataframeに対して、行・列を指定して更新を行い、UpdateRowでSpreadsheetに反映する
-		// ## 現行:
-		// - Countの更新
-		// - TweetURLの更新
-		// - 最終投稿日の更新
-
-		// 投稿したTweetsをGoogle spreadsheet「Tweets list」に保存（現行は指定セルである「投稿日」の上書き
-		_, colN := dfTweets.Dims()
-		dfTweets.Elem(tweet.Index-1, colN-3).Set(tweet.Count + 1)
-		dfTweets.Elem(tweet.Index-1, colN-2).Set(tweet.TweetURL)
-		dfTweets.Elem(tweet.Index-1, colN-1).Set(time.Now().Format(subsets.LAYOUT))
-
-		// 行を指定しUpdateRequestの指定する型に整形する
-		targetRangeKey, row, err := libs.SubsetToUpdateRowWithRangeKey(dfTweets, tweet.Index, TWEETSSHEETTITLE)
+		}
+
+	default:
+		req, err := subsets.RequestCreateTweet(ctx, account, tweet, files)
 		if err != nil {
-			log.Err(err).Msg("failed to subset to row with range key")
+			r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to create tweet request, %s: %d", account.TwitterID, tweet.Index)
+			return result.fail(err)
 		}
-		// 行を更新する
-		if err := libs.UpdateRow(cred, SPREADSHEET_ID, TWEETSSHEETTITLE, targetRangeKey, row); err != nil {
-			log.Warn().Msgf("failed to update cell: %s", err)
+		r.logger().Debug().Str("function", "postForAccount").Msgf("tweet request: %+v", req)
+		// 投稿のリクエストは停止の指示で中断しない
+		// why: 投稿済みで応答を受け取る前に中断すると、投稿結果を記録できないため
+		res, err := r.Twitter.Tweeting(
+			context.WithoutCancel(ctx),
+			account,
+			req,
+		)
+		if err == nil && (res == nil || res.Data.ID == nil) {
+			err = fmt.Errorf("no tweet id in response")
 		}
+		if err != nil {
+			r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to tweeting, twitter id: %s, index: %d", account.TwitterID, tweet.Index)
+			return result.fail(err)
+		}
+		// TweetURLを更新
+		tweet.TweetURL = libs.ID2TwitterURL(*res.Data.ID)
+		r.logger().Info().Str("function", "postForAccount").Msgf("success tweeted: %s", tweet.TweetURL)
+
+		entry.TweetID = *res.Data.ID
+		if req.Media != nil {
+			entry.MediaIDs = req.Media.MediaIDs
+		}
+	}
+	entry.TweetURL = tweet.TweetURL
+	entry.PostedAt = r.Clock.Now()
+	entry.DeleteAt = deleteAt(*tweet, entry.PostedAt)
+	result.Status = PostPosted
+	result.Channel = entry.Channel
+	result.TweetURL = entry.TweetURL
+
+	// 投稿の事実を先に投稿履歴へ記録する
+	// why: Spreadsheetへの書き込みに失敗しても、次回以降の重複投稿の防止・再書き込みに使うため
+	entry, err = r.Ledger.Append(entry)
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to append ledger, %s: %d", account.TwitterID, tweet.Index)
+	}
 
-	} // end of for
+	// 投稿したTweetsをGoogle spreadsheet「Tweets list」に保存
+	// 取得時の行番号ではなくindex列で書き込み先の行を特定する
+	if err := r.writeBackTweet(entry, &dfTweets); err != nil {
+		// 書き込み待ちに追加し、次回以降に再試行する
+		r.logger().Warn().Msgf("failed to update cell, retry later: %s", err)
+		r.enqueueWriteBack(entry, err)
+		result.WriteBack = WriteBackQueued
+		return result
+	}
+	result.WriteBack = WriteBackSynced
+	if err := r.Ledger.MarkSynced(entry); err != nil {
+		r.logger().Error().Err(err).Str("function", "postForAccount").Msgf("failed to mark ledger synced, %s: %d", account.TwitterID, tweet.Index)
+	}
+
+	return result
 }
 
-// UpdateDataframe Dataframeを更新する
-func UpdateDataframe(df dataframe.DataFrame, tweet subsets.TwitterTweet) (bool, int, dataframe.DataFrame) {
-	var (
-		isChanged bool
-		rowN      int
-	)
-
-	rN, cN := df.Dims()
-	for i := 0; i < rN; i++ {
-		// Indexが一番左の列にあると見込む
-		index, err := df.Elem(i, 0).Int()
-		if err != nil {
+// tweetsSheet 既定の「Tweets list」 管理者用Spreadsheet内Sheet
+func (r *Runner) tweetsSheet() libs.SheetRef {
+	return libs.SheetRef{
+		SpreadID:   r.Config.SpreadsheetID,
+		SheetTitle: r.Config.Sheets.Tweets,
+		RangeKey:   r.Config.Sheets.Range,
+	}
+}
+
+// readTweets アカウントの「Tweets list」を取得する
+// 戻り値の参照は投稿結果の書き込み先としても使用する
+func (r *Runner) readTweets(account subsets.TwitterAccount) (libs.SheetRef, dataframe.DataFrame, []subsets.TwitterTweet, error) {
+	ref := account.TweetsSheet(r.tweetsSheet())
+	tweets := make([]subsets.TwitterTweet, 0)
+	df, err := ref.Get(r.Store, &tweets)
+	if err != nil {
+		return ref, df, nil, libs.SetError(err, "failed to get tweets sheet "+ref.String())
+	}
+	return ref, df, tweets, nil
+}
+
+// renderText Tweetのtextのテンプレートを時刻atで展開する
+func (r *Runner) renderText(account subsets.TwitterAccount, tweet subsets.TwitterTweet, at time.Time) (string, error) {
+	data := subsets.TemplateData{Now: at, Account: account, Tweet: tweet, Pools: r.Config.Pools}
+	return subsets.RenderText(tweet.Text, data, r.Rand)
+}
+
+// syncPending 前回までにSpreadsheetへの書き込みに失敗した投稿結果を書き込む
+// dry runではSpreadsheetに書き込まない
+func (r *Runner) syncPending() {
+	if r.Config.IsDryRun() {
+		return
+	}
+	r.replayLedger()
+	r.flushOutbox()
+}
+
+// replayLedger 投稿履歴のうち、Spreadsheetへの書き込みが完了していない投稿結果を書き込み待ちに追加する
+// why: 投稿後、書き込み待ちに追加する前に停止した場合も投稿結果を失わないため
+func (r *Runner) replayLedger() {
+	unsynced, err := r.Ledger.Unsynced()
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "replayLedger").Msg("failed to read ledger")
+		return
+	}
+
+	for _, e := range unsynced {
+		if r.Outbox.Has(e.ID) {
 			continue
 		}
+		r.logger().Info().Str("function", "replayLedger").Msgf("replay ledger, %s: %d", e.Account, e.Index)
+		r.enqueueWriteBack(e, nil)
+	}
+}
 
-		if index == tweet.Index {
-			// 行を変更していなければtweet.Indexがある場所は、rowN+1となる
-			// しかし、並べ替えやSortしているとIndexが降順であるとは限らない
-			// そのため、投稿したIndexと一致する行を探し、その行を更新する
-			// Spreadsheetを取得してから、投稿するまでの間に行が変更されたりする場合はサポート外
-			if tweet.Index != i {
-				isChanged = true
-			}
-			rowN = i
-			df.Elem(rowN, cN-3).Set(tweet.Count + 1)
-			df.Elem(rowN, cN-2).Set(tweet.TweetURL)
-			df.Elem(rowN, cN-1).Set(time.Now().Format(subsets.LAYOUT))
-			break
+// enqueueWriteBack 投稿結果の書き込みを書き込み待ちに追加する
+func (r *Runner) enqueueWriteBack(entry libs.LedgerEntry, cause error) {
+	u, err := r.writeBackUpdate(entry)
+	if err != nil {
+		r.logger().Error().Err(err).Str("function", "enqueueWriteBack").Msgf("failed to create write back, %s: %d", entry.Account, entry.Index)
+		return
+	}
+	if cause != nil {
+		u.Attempts = 1
+		u.LastError = cause.Error()
+		u.NextAt = time.Now().Add(r.Outbox.BaseBackoff)
+	}
+
+	if err := r.Outbox.Enqueue(u); err != nil {
+		r.logger().Error().Err(err).Str("function", "enqueueWriteBack").Msgf("failed to enqueue write back, %s: %d", entry.Account, entry.Index)
+	}
+}
+
+// flushOutbox 書き込み待ちを再試行し、成功した投稿結果を投稿履歴に記録する
+func (r *Runner) flushOutbox() {
+	for _, u := range r.Outbox.Flush(r.Store, time.Now()) {
+		r.logger().Info().Str("function", "flushOutbox").Msgf("success retried sheet update, %s: %s", u.SheetTitle, u.Key)
+		if u.LedgerID == "" {
+			continue
+		}
+		if err := r.Ledger.MarkSynced(libs.LedgerEntry{ID: u.LedgerID}); err != nil {
+			r.logger().Error().Err(err).Str("function", "flushOutbox").Msgf("failed to mark ledger synced, %s", u.LedgerID)
 		}
 	}
+	if n := r.Outbox.Len(); n != 0 {
+		r.logger().Warn().Str("function", "flushOutbox").Msgf("pending sheet updates: %d", n)
+	}
+}
+
+// writeBackUpdate 投稿結果から「Tweets list」への書き込み内容を作成する
+// 書き込む列はTwitterTweetのcsvタグ（列名）で特定する
+// ## 現行:
+// - Countの更新
+// - TweetURLの更新
+// - 最終投稿日の更新
+// - 削除日時の更新（削除の場合は他の列を更新しない。deleted_dateの列がなければ書き込まない）
+func (r *Runner) writeBackUpdate(entry libs.LedgerEntry) (libs.PendingUpdate, error) {
+	src, columns := subsets.TwitterTweet{
+		Count:    entry.Count,
+		TweetURL: entry.TweetURL,
+		LastDate: entry.PostedAt.Format(subsets.LAYOUT),
+	}, subsets.WriteBackColumns
+	// 削除: 削除日時の更新
+	if entry.Event == libs.LedgerDeleted {
+		src, columns = subsets.TwitterTweet{DeletedDate: entry.DeletedAt.Format(subsets.LAYOUT)}, subsets.DeleteWriteBackColumns
+	}
+	values, err := libs.TagValues(src, columns...)
+	if err != nil {
+		return libs.PendingUpdate{}, libs.SetError(err, "failed to get write back values")
+	}
+
+	ref := entry.SheetRef
+	if ref.RangeKey == "" {
+		ref.RangeKey = r.Config.Sheets.Range
+	}
+
+	return libs.PendingUpdate{
+		SheetRef:  ref,
+		KeyColumn: "index",
+		Key:       strconv.Itoa(entry.Index),
+		Guard:     map[string]string{"twitter_id": entry.Account},
+		Values:    values,
+		// 削除日時の列は任意 why: 削除はX上で完了しているため、列がないSheetで再試行し続けない
+		Optional: entry.Event == libs.LedgerDeleted,
+		LedgerID: entry.ID,
+	}, nil
+}
+
+// deleteAt delete_afterから投稿を削除する時刻 削除しない場合はゼロ値
+func deleteAt(tweet subsets.TwitterTweet, postedAt time.Time) time.Time {
+	if tweet.DeleteAfter <= 0 {
+		return time.Time{}
+	}
+	return postedAt.Add(time.Duration(tweet.DeleteAfter) * time.Hour)
+}
+
+// writeBackTweet 投稿結果を「Tweets list」の該当行に書き戻す
+//
+// Spreadsheetを取得してから投稿するまでの間に並べ替え・挿入・削除が行われる可能性があるため、
+// 書き込み直前に再取得し、index列で該当行を特定する
+// ‐ 行が移動していた場合: 移動先の行を更新する
+// ‐ 行が存在しない・重複する・別アカウントの行である場合: 上書きせずエラーを返す
+// readDfは投稿前に取得したSheet、行の移動の検出に使用する
+func (r *Runner) writeBackTweet(entry libs.LedgerEntry, readDf *dataframe.DataFrame) error {
+	u, err := r.writeBackUpdate(entry)
+	if err != nil {
+		return err
+	}
+
+	rowN, err := u.Apply(r.Store)
+	if err != nil {
+		return err
+	}
+
+	if readDf == nil || rowN < 0 {
+		return nil
+	}
+	if readRowN, err := libs.FindRowByKey(*readDf, u.KeyColumn, u.Key); err == nil && readRowN != rowN {
+		r.logger().Warn().Str("function", "writeBackTweet").Msgf("tweet row moved, index: %s, row: %d -> %d", u.Key, readRowN+2, rowN+2)
+	}
 
-	return isChanged, rowN, df
+	return nil
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"tweet-with-spread/cmd/User596E9F4/subsets"
+	"tweet-with-spread/libs"
+)
+
+var testTweetsRows = [][]string{
+	{"index", "twitter_id", "text", "checked", "count", "tweet_url", "last_date"},
+	{"1", "user", "hello", "1", "0", "", "2024/01/01 00:00:00"},
+}
+
+// testConfig 管理者用Spreadsheetをadminとし、投稿前に待機しない設定
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.SpreadsheetID = "admin"
+	cfg.MaxWaitSec = 0
+	return cfg
+}
+
+// TestWriteBackToAccountSheet 投稿結果が読み込み元のSpreadsheetに書き込まれること
+func TestWriteBackToAccountSheet(t *testing.T) {
+	cfg := testConfig()
+
+	cases := []struct {
+		name       string
+		account    subsets.TwitterAccount
+		wantSpread string
+	}{
+		{"account spreadsheet", subsets.TwitterAccount{TwitterID: "user", SpreadID: "account"}, "account"},
+		{"admin spreadsheet", subsets.TwitterAccount{TwitterID: "user"}, "admin"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := libs.NewMemorySheetStore()
+			store.SetSheet("admin", cfg.Sheets.Tweets, testTweetsRows)
+			store.SetSheet("account", cfg.Sheets.Tweets, testTweetsRows)
+			r := &Runner{Config: cfg, Store: store, Clock: libs.SystemClock{}, Rand: libs.NewRand(1)}
+
+			ref, df, tweets, err := r.readTweets(c.account)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref.SpreadID != c.wantSpread {
+				t.Fatalf("read from: got %s, want %s", ref.SpreadID, c.wantSpread)
+			}
+
+			postedAt := time.Date(2024, 2, 3, 4, 5, 6, 0, time.Local)
+			entry := libs.LedgerEntry{
+				SheetRef: ref,
+				Account:  tweets[0].TwitterID,
+				Index:    tweets[0].Index,
+				TweetURL: "https://twitter.com/i/web/status/1",
+				Count:    tweets[0].Count + 1,
+				PostedAt: postedAt,
+			}
+			if err := r.writeBackTweet(entry, &df); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"1", "user", "hello", "1", "1", "https://twitter.com/i/web/status/1", "2024/02/03 04:05:06"}
+			for _, spread := range []string{"admin", "account"} {
+				rows := store.Sheet(spread, cfg.Sheets.Tweets)
+				if spread == c.wantSpread {
+					if !reflect.DeepEqual(rows[1], want) {
+						t.Fatalf("%s: got %v, want %v", spread, rows[1], want)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(rows, testTweetsRows) {
+					t.Fatalf("%s must not be written: got %v", spread, rows)
+				}
+			}
+		})
+	}
+}
+
+// schedulerClock 投稿の間隔（CATCHUPINTERVAL）・0以下は待機せずに記録し、スケジューラの待機は停止まで待つ
+type schedulerClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *schedulerClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *schedulerClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d > 0 && d != subsets.CATCHUPINTERVAL {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+// TestSchedulerCatchUpAll 停止中に過ぎた投稿時刻を検出し、catchup: allでCATCHUPINTERVALの間隔で投稿すること
+func TestSchedulerCatchUpAll(t *testing.T) {
+	// 投稿の開始期限は実際の時刻で判定するため、現在時刻の前後で模擬する
+	now := time.Now().UTC().Truncate(time.Minute)
+	poster := &fakePoster{}
+	r, store := newTestRunner(t, poster, now)
+	// 毎時、10分前の分に投稿する 前回の処理から3回過ぎた
+	store.SetSheet("admin", r.Config.Sheets.Accounts, [][]string{
+		{"index", "twitter_id", "subscribed", "schedule", "timezone", "term_days", "catchup"},
+		{"1", "user", "1", fmt.Sprintf("%d * * * *", now.Add(-10*time.Minute).Minute()), "UTC", "1", "all"},
+	})
+	store.SetSheet("admin", r.Config.Sheets.Tweets, [][]string{
+		{"index", "twitter_id", "text", "checked", "count", "tweet_url", "last_date"},
+		{"1", "user", "one", "1", "0", "", "2024/01/01 00:00:00"},
+		{"2", "user", "two", "1", "0", "", "2024/01/01 00:00:00"},
+		{"3", "user", "three", "1", "0", "", "2024/01/01 00:00:00"},
+	})
+
+	checkpoint, err := libs.OpenCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.Save(now.Add(-150 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	r.Checkpoint = checkpoint
+	// スケジューラの待機とCATCHUPINTERVALを区別する
+	r.Config.Interval = time.Hour
+	clock := &schedulerClock{now: now}
+	r.Clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.runScheduler(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		poster.mu.Lock()
+		n := len(poster.texts)
+		poster.mu.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("posted: got %d, want 3", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	clock.mu.Lock()
+	slept := clock.slept
+	clock.mu.Unlock()
+	intervals := 0
+	for _, d := range slept {
+		if d == subsets.CATCHUPINTERVAL {
+			intervals++
+		}
+	}
+	if intervals != 2 {
+		t.Fatalf("slept: got %v, want 2 intervals", slept)
+	}
+	last, err := checkpoint.Load()
+	if err != nil || !last.Equal(now) {
+		t.Fatalf("checkpoint: got %v, %v, want %v", last, err, now)
+	}
+}
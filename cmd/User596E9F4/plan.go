@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+	"tweet-with-spread/cmd/User596E9F4/subsets"
+	"tweet-with-spread/libs"
+)
+
+// PLANMAXSTEPS planで模擬する投稿の上限
+// why: 毎分のスケジュールで長い期間を指定した場合に、出力が膨大にならないため
+const PLANMAXSTEPS = 10000
+
+// PlanStep planで模擬した1回分の投稿
+type PlanStep struct {
+	At      time.Time `json:"at"`
+	Account string    `json:"account"`
+	Index   int       `json:"index,omitempty"`
+	Text    string    `json:"text,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	// 選択できなかった場合の理由
+	Error string `json:"error,omitempty"`
+}
+
+// Simulate fromからto（toを含む）までの投稿を模擬する
+// ‐ 投稿時刻ごとにSelectTwitterAccounts・SelectTweetを実行する。選択の基準時刻は投稿時刻とする
+// ‐ 選択したTweetのcount・last_dateと投稿履歴を更新して、次の投稿時刻の選択に反映する
+// ‐ Twitterへの投稿・Spreadsheetへの書き込み・投稿履歴への記録は行わない
+// 候補が複数残った場合の選択はr.Randを使用する。seedを指定すると模擬を再現できる
+// accountの指定があれば、そのアカウントのみを模擬する
+func (r *Runner) Simulate(from, to time.Time, account string) ([]PlanStep, error) {
+	accounts, err := r.loadAccounts()
+	if err != nil {
+		return nil, libs.SetError(err, "failed to get account list")
+	}
+	// 投稿履歴は実際の投稿を反映する
+	history, err := r.Ledger.Entries()
+	if err != nil {
+		return nil, libs.SetError(err, "failed to read ledger")
+	}
+
+	// 「Tweets list」はSheetごとに1回取得し、模擬の更新を重ねる
+	sheets := map[libs.SheetRef][]subsets.TwitterTweet{}
+	tweetsOf := func(a subsets.TwitterAccount) (libs.SheetRef, []subsets.TwitterTweet, error) {
+		ref := a.TweetsSheet(r.tweetsSheet())
+		if tweets, ok := sheets[ref]; ok {
+			return ref, tweets, nil
+		}
+		_, _, tweets, err := r.readTweets(a)
+		if err != nil {
+			return ref, nil, err
+		}
+		sheets[ref] = tweets
+		return ref, tweets, nil
+	}
+
+	var steps []PlanStep
+	t := from.Add(-time.Second)
+	for len(steps) < PLANMAXSTEPS {
+		next, ok := subsets.NextFire(t, accounts)
+		if !ok || next.After(to) {
+			break
+		}
+		t = next
+
+		targets, err := subsets.SelectTwitterAccounts(next, accounts)
+		if err != nil {
+			continue
+		}
+		for _, a := range targets {
+			if account != "" && a.TwitterID != account {
+				continue
+			}
+			step := PlanStep{At: next, Account: a.TwitterID}
+			ref, tweets, err := tweetsOf(a)
+			if err != nil {
+				step.Error = err.Error()
+				steps = append(steps, step)
+				continue
+			}
+			// 選択の各段階でsliceを並べ替えるため、模擬の状態を複製して渡す
+			tweet, _, err := subsets.SelectTweet(next, r.Rand, a, ref, append([]subsets.TwitterTweet(nil), tweets...), history)
+			if err != nil {
+				step.Error = err.Error()
+				steps = append(steps, step)
+				continue
+			}
+
+			step.Index = tweet.Index
+			text, err := r.renderText(a, *tweet, next)
+			if err != nil {
+				step.Error = err.Error()
+				steps = append(steps, step)
+				continue
+			}
+			step.Text = text
+			step.Channel, err = tweet.Channel(text, r.Config.WeightedLimit())
+			if err != nil {
+				step.Error = err.Error()
+				steps = append(steps, step)
+				continue
+			}
+			steps = append(steps, step)
+
+			// 投稿した場合の書き込みを模擬する
+			for i := range tweets {
+				if tweets[i].Index == tweet.Index && tweets[i].TwitterID == tweet.TwitterID {
+					tweets[i].Count++
+					tweets[i].LastDate = next.In(time.Local).Format(subsets.LAYOUT)
+				}
+			}
+			history = append(history, libs.LedgerEntry{
+				Event:    libs.LedgerPosted,
+				SheetRef: ref,
+				Account:  a.TwitterID,
+				Index:    tweet.Index,
+				TextHash: libs.TextHash(tweet.Text),
+				PostedAt: next,
+			})
+		}
+	}
+	if len(steps) >= PLANMAXSTEPS {
+		r.logger().Warn().Str("function", "Simulate").Msgf("too many posts, stop at %d: %s", PLANMAXSTEPS, t.Format(time.RFC3339))
+	}
+	return steps, nil
+}
+
+// writeTimeline 模擬した投稿をアカウントごとに時刻順で出力する
+func writeTimeline(w io.Writer, tenant string, steps []PlanStep) {
+	byAccount := map[string][]PlanStep{}
+	var names []string
+	for _, s := range steps {
+		if _, ok := byAccount[s.Account]; !ok {
+			names = append(names, s.Account)
+		}
+		byAccount[s.Account] = append(byAccount[s.Account], s)
+	}
+	sort.Strings(names)
+
+	if tenant != "" {
+		fmt.Fprintf(w, "tenant: %s\n", tenant)
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(w, "no posts")
+		return
+	}
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\n", name)
+		for _, s := range byAccount[name] {
+			at := s.At.Format("2006-01-02 15:04 MST")
+			if s.Error != "" {
+				fmt.Fprintf(w, "  %s  -  %s\n", at, s.Error)
+				continue
+			}
+			fmt.Fprintf(w, "  %s  #%d  %-3s  %s\n", at, s.Index, s.Channel, summarizeText(s.Text, 40))
+		}
+	}
+}
+
+// summarizeText 1行に収まるように改行を除き、n文字で切り詰める
+func summarizeText(s string, n int) string {
+	rs := []rune(s)
+	for i, c := range rs {
+		if c == '\n' || c == '\r' {
+			rs[i] = ' '
+		}
+	}
+	if len(rs) > n {
+		return string(rs[:n]) + "…"
+	}
+	return string(rs)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+// TestSimulate 投稿時刻ごとに選択し、模擬の更新を次の選択に反映すること
+func TestSimulate(t *testing.T) {
+	cfg := testConfig()
+	tweetsRows := [][]string{
+		{"index", "twitter_id", "text", "checked", "count", "tweet_url", "last_date"},
+		{"1", "user", "first", "1", "0", "", "2024/01/01 00:00:00"},
+		{"2", "user", "second", "1", "0", "", "2024/01/01 00:00:00"},
+		{"3", "other", "other", "1", "0", "", "2024/01/01 00:00:00"},
+	}
+	store := libs.NewMemorySheetStore()
+	store.SetSheet("admin", cfg.Sheets.Accounts, [][]string{
+		{"index", "twitter_id", "subscribed", "schedule", "timezone", "term_days"},
+		{"1", "user", "1", "0 9 * * *", "UTC", "1"},
+		{"2", "other", "1", "0 21 * * *", "UTC", "1"},
+	})
+	store.SetSheet("admin", cfg.Sheets.Tweets, tweetsRows)
+	ledger, err := libs.OpenLedger(filepath.Join(t.TempDir(), "posts.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Runner{Config: cfg, Store: store, Ledger: ledger, Rand: libs.NewRand(1)}
+
+	from := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	steps, err := r.Simulate(from, from.Add(72*time.Hour), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(steps) != 3 {
+		t.Fatalf("steps: %+v", steps)
+	}
+	for i, s := range steps {
+		if want := from.Add(time.Duration(i)*24*time.Hour + 9*time.Hour); !s.At.Equal(want) || s.Account != "user" || s.Error != "" || s.Channel != libs.ChannelAPI {
+			t.Fatalf("step %d: %+v", i, s)
+		}
+	}
+	// 前日に投稿したTweetは選択しない
+	if steps[0].Index == steps[1].Index || steps[1].Index == steps[2].Index {
+		t.Fatalf("posted tweet must not be selected next day: %+v", steps)
+	}
+
+	if rows := store.Sheet("admin", cfg.Sheets.Tweets); !reflect.DeepEqual(rows, tweetsRows) {
+		t.Fatalf("plan must not write sheet: %v", rows)
+	}
+	if entries, err := ledger.Entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("plan must not append ledger: %v, %v", entries, err)
+	}
+}
+
+// TestSimulateSeed 同じseedでは同じ予定になること
+func TestSimulateSeed(t *testing.T) {
+	cfg := testConfig()
+	rows := [][]string{{"index", "twitter_id", "text", "checked", "count", "tweet_url", "last_date"}}
+	for i := 1; i <= 10; i++ {
+		rows = append(rows, []string{strconv.Itoa(i), "user", "tweet" + strconv.Itoa(i), "1", "0", "", "2024/01/01 00:00:00"})
+	}
+	simulate := func(seed int64) []PlanStep {
+		store := libs.NewMemorySheetStore()
+		store.SetSheet("admin", cfg.Sheets.Accounts, [][]string{
+			{"index", "twitter_id", "subscribed", "schedule", "timezone", "term_days"},
+			{"1", "user", "1", "0 */6 * * *", "UTC", "0"},
+		})
+		store.SetSheet("admin", cfg.Sheets.Tweets, rows)
+		ledger, err := libs.OpenLedger(filepath.Join(t.TempDir(), "posts.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &Runner{Config: cfg, Store: store, Ledger: ledger, Rand: libs.NewRand(seed)}
+		from := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+		steps, err := r.Simulate(from, from.Add(48*time.Hour), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return steps
+	}
+
+	if a, b := simulate(7), simulate(7); len(a) != 9 || !reflect.DeepEqual(a, b) {
+		t.Fatalf("same seed must plan same steps: %+v, %+v", a, b)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"tweet-with-spread/libs"
+
+	mtypes "github.com/michimani/gotwi/tweet/managetweet/types"
+)
+
+// Poster Tweetを投稿する
+// why: 投稿先を差し替え、Spreadsheet・投稿履歴を含めた一連の処理をTwitterに投稿せずに確認するため
+type Poster interface {
+	// Tweeting TwitterAPIで投稿する
+	Tweeting(ctx context.Context, account libs.Box, req *mtypes.CreateInput) (*mtypes.CreateOutput, error)
+	// TweetsToGUI ブラウザ操作で投稿する
+	TweetsToGUI(ctx context.Context, withFiles bool, accountID, password, text string, files []string) error
+	// Delete TwitterAPIで投稿を削除する
+	Delete(ctx context.Context, account libs.Box, tweetID string) error
+}
+
+// twitterPoster Twitterに投稿する
+// ‐ API: LoggingInterceptorでAPI Limitを取得し、残り回数でリクエストを制御する アカウントごとのクライアントを再利用する
+// ‐ GUI: Playwrightでブラウザを操作する
+type twitterPoster struct {
+	*libs.LoggingInterceptor
+	gui libs.GUIOptions
+}
+
+func newTwitterPoster(gui libs.GUIOptions) *twitterPoster {
+	return &twitterPoster{LoggingInterceptor: libs.NewLoggingInterceptor(), gui: gui}
+}
+
+// Tweeting dry runではPosterを呼び出さないため、常に投稿する
+func (p *twitterPoster) Tweeting(ctx context.Context, account libs.Box, req *mtypes.CreateInput) (*mtypes.CreateOutput, error) {
+	return p.LoggingInterceptor.Tweeting(ctx, true, account, req)
+}
+
+func (p *twitterPoster) TweetsToGUI(ctx context.Context, withFiles bool, accountID, password, text string, files []string) error {
+	return libs.TweetsToGUI(ctx, p.gui, true, withFiles, accountID, password, text, files)
+}
+
+func (p *twitterPoster) Delete(ctx context.Context, account libs.Box, tweetID string) error {
+	return p.LoggingInterceptor.Delete(ctx, account, &mtypes.DeleteInput{ID: tweetID})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ServeConfig serveモードの設定
+type ServeConfig struct {
+	// 待ち受けポート Cloud RunではPORTが指定される
+	Port string `yaml:"port"`
+	// POST /runの認証トークン Authorization: Bearer <RunToken>
+	RunToken string `yaml:"run_token"`
+}
+
+// Serve HTTPリクエストを受けてテナントのExecutorを実行する
+// ctxが終了すると新しいリクエストの受付を止め、実行中のリクエストの終了をSHUTDOWNTIMEOUTまで待つ
+func Serve(ctx context.Context, c ServeConfig, runners ...*Runner) error {
+	srv := &http.Server{
+		Addr:              ":" + c.Port,
+		Handler:           Handler(ctx, c.RunToken, runners...),
+		ReadHeaderTimeout: 10 * time.Second,
+		// リクエストのctxは停止の指示で終了する
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info().Str("function", "Serve").Msgf("listen: :%s", c.Port)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), SHUTDOWNTIMEOUT)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler serveモードのHTTPハンドラ
+// ‐ POST /run?tenant=<name>&at=<RFC3339>: テナントのExecutorをatを投稿時刻として1回実行し、結果をJSONで返す。atがなければ現在時刻
+// ‐ GET /healthz: 死活監視
+// /runはAuthorization: Bearer <token>で認証する
+// テナントが1つの場合はtenantを省略できる
+// Executorはリクエストではなくctxで実行する
+// why: クライアントの切断やCloud Schedulerのタイムアウトで、実行中の投稿と投稿結果の書き込みを中断しないため
+// ctxの終了（serveの停止）では中断する
+func Handler(ctx context.Context, token string, runners ...*Runner) http.Handler {
+	tenants := make(map[string]*Runner, len(runners))
+	for _, r := range runners {
+		tenants[r.Tenant] = r
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/run", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if !authorized(req, token) {
+			log.Warn().Str("function", "Handler").Msgf("unauthorized run request from %s", req.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		r, status, err := runTenant(req, runners, tenants)
+		if err != nil {
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		at, err := runAt(req)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		summary := r.Executor(ctx, at)
+		status = http.StatusOK
+		if summary.Error != "" {
+			status = http.StatusInternalServerError
+		}
+		writeJSON(w, status, summary)
+	})
+	return mux
+}
+
+// authorized Authorization: Bearer <token>を検証する
+func authorized(req *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// runTenant リクエストのテナント
+func runTenant(req *http.Request, runners []*Runner, tenants map[string]*Runner) (*Runner, int, error) {
+	name := req.URL.Query().Get("tenant")
+	if name == "" {
+		if len(runners) != 1 {
+			return nil, http.StatusBadRequest, errors.New("tenant is required")
+		}
+		return runners[0], http.StatusOK, nil
+	}
+	r, ok := tenants[name]
+	if !ok {
+		return nil, http.StatusNotFound, errors.New("unknown tenant: " + name)
+	}
+	return r, http.StatusOK, nil
+}
+
+// runAt リクエストの投稿時刻 分単位に切り捨てる
+// why: スケジュールは分単位で評価するため、Cloud Schedulerの起動の遅れを吸収する
+func runAt(req *http.Request) (time.Time, error) {
+	s := req.URL.Query().Get("at")
+	if s == "" {
+		return time.Now().Truncate(time.Minute), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid at, must be RFC3339: " + s)
+	}
+	return t.Truncate(time.Minute), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Str("function", "writeJSON").Msg("failed to write response")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+
+	mtypes "github.com/michimani/gotwi/tweet/managetweet/types"
+)
+
+// fakePoster 投稿せずにリクエストを記録する
+type fakePoster struct {
+	mu    sync.Mutex
+	texts []string
+	reqs  []*mtypes.CreateInput
+	err   error
+	// failOn n回目のAPI投稿を失敗させる
+	failOn  int
+	calls   int
+	deleted []string
+	// deleteErr TweetのIDごとの削除のエラー
+	deleteErr map[string]error
+	// noID 投稿結果にTweetのIDを含めない
+	noID bool
+	// panics API投稿でpanicする
+	panics bool
+}
+
+func (f *fakePoster) Tweeting(ctx context.Context, account libs.Box, req *mtypes.CreateInput) (*mtypes.CreateOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.panics {
+		panic("tweeting")
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.noID {
+		return &mtypes.CreateOutput{}, nil
+	}
+	if f.calls == f.failOn {
+		return nil, errors.New("failed to tweet")
+	}
+	f.texts = append(f.texts, *req.Text)
+	f.reqs = append(f.reqs, req)
+	id := strconv.Itoa(len(f.texts))
+	res := &mtypes.CreateOutput{}
+	res.Data.ID = &id
+	res.Data.Text = req.Text
+	return res, nil
+}
+
+func (f *fakePoster) TweetsToGUI(ctx context.Context, withFiles bool, accountID, password, text string, files []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.texts = append(f.texts, text)
+	return nil
+}
+
+func (f *fakePoster) Delete(ctx context.Context, account libs.Box, tweetID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err, ok := f.deleteErr[tweetID]; ok {
+		return err
+	}
+	f.deleted = append(f.deleted, tweetID)
+	return nil
+}
+
+// newTestRunner メモリ上のSheet・偽の投稿先でRunnerを作成する
+// アカウントuserはatに投稿し、otherは投稿しない
+// why: 投稿の開始期限は投稿時刻から数えるため、現在時刻に近い投稿時刻で実行する
+func newTestRunner(t *testing.T, poster Poster, at time.Time) (*Runner, *libs.MemorySheetStore) {
+	t.Helper()
+	cfg := testConfig()
+
+	at = at.UTC()
+	store := libs.NewMemorySheetStore()
+	store.SetSheet("admin", cfg.Sheets.Accounts, [][]string{
+		{"index", "twitter_id", "subscribed", "schedule", "timezone", "term_days"},
+		{"1", "user", "1", fmt.Sprintf("%d %d * * *", at.Minute(), at.Hour()), "UTC", "1"},
+		{"2", "other", "1", fmt.Sprintf("%d %d * * *", at.Minute(), (at.Hour()+12)%24), "UTC", "1"},
+	})
+	store.SetSheet("admin", cfg.Sheets.Tweets, testTweetsRows)
+
+	dir := t.TempDir()
+	ledger, err := libs.OpenLedger(filepath.Join(dir, "posts.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox, err := libs.OpenOutbox(filepath.Join(dir, "outbox.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Runner{
+		Config:  cfg,
+		Store:   store,
+		Twitter: poster,
+		Clock:   libs.SystemClock{},
+		Rand:    libs.NewRand(1),
+		Ledger:  ledger,
+		Outbox:  outbox,
+		Pool:    libs.NewWorkerPool(1, 0),
+	}
+	t.Cleanup(func() { r.Pool.Close() })
+	return r, store
+}
+
+func TestServeRun(t *testing.T) {
+	poster := &fakePoster{}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, poster, at)
+	srv := httptest.NewServer(Handler(context.Background(), "secret", r))
+	defer srv.Close()
+
+	post := func(query, token string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/run"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for _, c := range []struct {
+		name, query, token string
+		want               int
+	}{
+		{"no token", "", "", http.StatusUnauthorized},
+		{"wrong token", "", "wrong", http.StatusUnauthorized},
+		{"invalid at", "?at=tomorrow", "secret", http.StatusBadRequest},
+	} {
+		res := post(c.query, c.token)
+		res.Body.Close()
+		if res.StatusCode != c.want {
+			t.Fatalf("%s: got %d, want %d", c.name, res.StatusCode, c.want)
+		}
+	}
+	if len(poster.texts) != 0 {
+		t.Fatalf("rejected requests must not post: %v", poster.texts)
+	}
+
+	res := post("?at="+at.Add(30*time.Second).Format(time.RFC3339), "secret")
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got %d", res.StatusCode)
+	}
+	var summary ExecSummary
+	if err := json.NewDecoder(res.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(summary.Selected) != 1 || summary.Selected[0] != "user" {
+		t.Fatalf("selected: %v", summary.Selected)
+	}
+	if summary.Posted != 1 || len(summary.Results) != 1 {
+		t.Fatalf("summary: %+v", summary)
+	}
+	got := summary.Results[0]
+	if got.Status != PostPosted || got.Index != 1 || got.WriteBack != WriteBackSynced || got.TweetURL != libs.ID2TwitterURL("1") {
+		t.Fatalf("result: %+v", got)
+	}
+	if len(poster.texts) != 1 || poster.texts[0] != "hello" {
+		t.Fatalf("posted: %v", poster.texts)
+	}
+	if row := store.Sheet("admin", r.Config.Sheets.Tweets)[1]; row[4] != "1" || row[5] != libs.ID2TwitterURL("1") {
+		t.Fatalf("write back: %v", row)
+	}
+}
+
+func TestServeRunFailed(t *testing.T) {
+	poster := &fakePoster{err: context.DeadlineExceeded}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, _ := newTestRunner(t, poster, at)
+	srv := httptest.NewServer(Handler(context.Background(), "secret", r))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/run?at="+at.Format(time.RFC3339), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var summary ExecSummary
+	if err := json.NewDecoder(res.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || summary.Failed != 1 || summary.Results[0].Error == "" {
+		t.Fatalf("status: %d, summary: %+v", res.StatusCode, summary)
+	}
+}
+
+// blockingPoster releaseが閉じるまで投稿を止める
+type blockingPoster struct {
+	*fakePoster
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingPoster) Tweeting(ctx context.Context, account libs.Box, req *mtypes.CreateInput) (*mtypes.CreateOutput, error) {
+	close(b.started)
+	<-b.release
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.fakePoster.Tweeting(ctx, account, req)
+}
+
+// TestServeRunContext クライアントが切断しても投稿を続け、serveの停止後は投稿しないこと
+func TestServeRunContext(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		shutdown bool
+		want     int
+	}{
+		{"client disconnect", false, 1},
+		{"server shutdown", true, 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			poster := &blockingPoster{fakePoster: &fakePoster{}, started: make(chan struct{}), release: make(chan struct{})}
+			at := time.Now().UTC().Truncate(time.Minute)
+			r, store := newTestRunner(t, poster, at)
+
+			ctx, stop := context.WithCancel(context.Background())
+			defer stop()
+			handler := Handler(ctx, "secret", r)
+			done := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer close(done)
+				handler.ServeHTTP(w, req)
+			}))
+			defer srv.Close()
+
+			reqCtx, disconnect := context.WithCancel(context.Background())
+			defer disconnect()
+			req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, srv.URL+"/run?at="+at.Format(time.RFC3339), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer secret")
+			go func() {
+				if res, err := http.DefaultClient.Do(req); err == nil {
+					res.Body.Close()
+				}
+			}()
+
+			if c.shutdown {
+				stop()
+				close(poster.release)
+			} else {
+				<-poster.started
+				disconnect()
+				// サーバーが切断を検知するまで待つ
+				time.Sleep(100 * time.Millisecond)
+				close(poster.release)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("run did not finish")
+			}
+			poster.mu.Lock()
+			defer poster.mu.Unlock()
+			if len(poster.texts) != c.want {
+				t.Fatalf("posted: %v, want %d", poster.texts, c.want)
+			}
+			if row := store.Sheet("admin", r.Config.Sheets.Tweets)[1]; c.want == 1 && row[4] != "1" {
+				t.Fatalf("write back: %v", row)
+			}
+		})
+	}
+}
+
+// TestExecutorBrokenResponse 投稿結果にIDがない・投稿中にpanicした場合も、Executorは失敗として終了すること
+func TestExecutorBrokenResponse(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		poster *fakePoster
+	}{
+		{"no id", &fakePoster{noID: true}},
+		{"panic", &fakePoster{panics: true}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			at := time.Now().UTC().Truncate(time.Minute)
+			r, _ := newTestRunner(t, c.poster, at)
+
+			done := make(chan ExecSummary, 1)
+			go func() { done <- r.Executor(context.Background(), at) }()
+			select {
+			case summary := <-done:
+				if summary.Failed != 1 || summary.Posted != 0 {
+					t.Fatalf("summary: %+v", summary)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("executor did not finish")
+			}
+		})
+	}
+}
+
+func TestServeRunTenant(t *testing.T) {
+	at := time.Now().UTC().Truncate(time.Minute)
+	acmePoster, globexPoster := &fakePoster{}, &fakePoster{}
+	acme, _ := newTestRunner(t, acmePoster, at)
+	acme.Tenant = "acme"
+	globex, _ := newTestRunner(t, globexPoster, at)
+	globex.Tenant = "globex"
+	srv := httptest.NewServer(Handler(context.Background(), "secret", acme, globex))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name, query string
+		want        int
+	}{
+		{"no tenant", "", http.StatusBadRequest},
+		{"unknown tenant", "?tenant=initech", http.StatusNotFound},
+		{"tenant", "?tenant=globex&at=" + at.Format(time.RFC3339), http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/run"+c.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.want {
+			t.Fatalf("%s: got %d, want %d", c.name, res.StatusCode, c.want)
+		}
+	}
+	if len(acmePoster.texts) != 0 || len(globexPoster.texts) != 1 {
+		t.Fatalf("posted: acme: %v, globex: %v", acmePoster.texts, globexPoster.texts)
+	}
+}
@@ -0,0 +1,121 @@
+package subsets
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// CatchUpSkip 過ぎた投稿時刻は投稿しない
+	CatchUpSkip = "skip"
+	// CatchUpOnce 最後に過ぎた投稿時刻が猶予内であれば1回だけ投稿する
+	CatchUpOnce = "once"
+	// CatchUpAll 過ぎた投稿時刻の回数分、CATCHUPINTERVALの間隔で投稿する
+	CatchUpAll = "all"
+
+	// 遅延がこの時間以内の投稿時刻は過ぎたものとせず、通常どおり投稿する
+	CATCHUPTOLERANCE = 1 * time.Minute
+	// onceの猶予の既定値
+	DEFAULTCATCHUPGRACE = 30 * time.Minute
+	// allで投稿する上限回数
+	// why: 長時間停止した後に大量の投稿を行わないため
+	CATCHUPMAXPOSTS = 10
+	// allで投稿する間隔
+	// why: 過ぎた投稿時刻の分を一度に連続して投稿しないため
+	CATCHUPINTERVAL = 5 * time.Minute
+)
+
+// CatchUpPolicy アカウントの過ぎた投稿時刻の扱いと、onceの猶予を返す
+func (a TwitterAccount) CatchUpPolicy() (string, time.Duration, error) {
+	policy := strings.ToLower(strings.TrimSpace(a.CatchUp))
+	switch policy {
+	case "":
+		policy = CatchUpSkip
+	case CatchUpSkip, CatchUpOnce, CatchUpAll:
+	default:
+		return "", 0, fmt.Errorf("invalid catchup %q, must be %s, %s or %s", a.CatchUp, CatchUpSkip, CatchUpOnce, CatchUpAll)
+	}
+
+	if a.CatchUpGrace < 0 {
+		return "", 0, fmt.Errorf("invalid catchup_grace %d", a.CatchUpGrace)
+	}
+	grace := DEFAULTCATCHUPGRACE
+	if a.CatchUpGrace > 0 {
+		grace = time.Duration(a.CatchUpGrace) * time.Minute
+	}
+
+	return policy, grace, nil
+}
+
+// MissedFires fromより後、to以前（toを含む）のアカウントの投稿時刻を古い順に返す
+func (a TwitterAccount) MissedFires(from, to time.Time) ([]time.Time, error) {
+	sched, loc, err := a.CronSchedule()
+	if err != nil {
+		return nil, err
+	}
+
+	var fires []time.Time
+	for t := sched.Next(from.In(loc)); !t.IsZero() && !t.After(to); t = sched.Next(t) {
+		fires = append(fires, t)
+	}
+	return fires, nil
+}
+
+// CatchUpDecision 過ぎた投稿時刻に対する判断
+type CatchUpDecision struct {
+	Policy string
+	// 過ぎた投稿時刻
+	Missed []time.Time
+	// 投稿する投稿時刻 Missedの一部
+	Post []time.Time
+	// 判断の理由 ログに出力する
+	Reason string
+}
+
+// PlanCatchUp 前回処理した時刻fromから現在時刻nowまでに過ぎた投稿時刻と、アカウントの扱いから投稿する投稿時刻を決める
+// 遅延がCATCHUPTOLERANCE以内の投稿時刻は、扱いにかかわらず投稿する
+func PlanCatchUp(a TwitterAccount, from, now time.Time) (CatchUpDecision, error) {
+	policy, grace, err := a.CatchUpPolicy()
+	if err != nil {
+		return CatchUpDecision{}, err
+	}
+	missed, err := a.MissedFires(from, now)
+	if err != nil {
+		return CatchUpDecision{}, err
+	}
+
+	d := CatchUpDecision{Policy: policy, Missed: missed}
+	if len(missed) == 0 {
+		d.Reason = "no missed slots"
+		return d, nil
+	}
+
+	latest := missed[len(missed)-1]
+	if now.Sub(latest) <= CATCHUPTOLERANCE {
+		d.Post = []time.Time{latest}
+		d.Reason = "delayed within tolerance"
+		return d, nil
+	}
+
+	switch policy {
+	case CatchUpSkip:
+		d.Reason = "skip by policy"
+	case CatchUpOnce:
+		if now.Sub(latest) > grace {
+			d.Reason = fmt.Sprintf("latest slot %s exceeded grace %s", latest.Format(time.RFC3339), grace)
+			break
+		}
+		d.Post = []time.Time{latest}
+		d.Reason = fmt.Sprintf("post once within grace %s", grace)
+	case CatchUpAll:
+		d.Post = missed
+		d.Reason = "post all missed slots"
+		if len(d.Post) > CATCHUPMAXPOSTS {
+			d.Post = d.Post[len(d.Post)-CATCHUPMAXPOSTS:]
+			d.Reason = fmt.Sprintf("post latest %d of %d missed slots", CATCHUPMAXPOSTS, len(missed))
+		}
+	}
+
+	return d, nil
+}
@@ -0,0 +1,99 @@
+package subsets
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanCatchUp(t *testing.T) {
+	// 毎時0分の投稿が、09:00以降の停止で09:00〜12:00の4回過ぎた
+	from := time.Date(2024, 1, 5, 8, 30, 0, 0, time.UTC)
+	now := time.Date(2024, 1, 5, 12, 10, 0, 0, time.UTC)
+	base := TwitterAccount{TwitterID: "a", Cron: "0 * * * *", Timezone: "UTC"}
+
+	cases := []struct {
+		name     string
+		catchUp  string
+		grace    int
+		now      time.Time
+		wantPost []time.Time
+	}{
+		{
+			name:    "default skip",
+			catchUp: "",
+		},
+		{
+			name:     "once within grace",
+			catchUp:  CatchUpOnce,
+			wantPost: []time.Time{time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:    "once exceeded grace",
+			catchUp: CatchUpOnce,
+			grace:   5,
+		},
+		{
+			name:    "all",
+			catchUp: CatchUpAll,
+			wantPost: []time.Time{
+				time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 5, 11, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "skip but delayed within tolerance",
+			catchUp:  CatchUpSkip,
+			now:      time.Date(2024, 1, 5, 12, 0, 30, 0, time.UTC),
+			wantPost: []time.Time{time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := base
+			a.CatchUp = c.catchUp
+			a.CatchUpGrace = c.grace
+			n := now
+			if !c.now.IsZero() {
+				n = c.now
+			}
+
+			d, err := PlanCatchUp(a, from, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(d.Missed) == 0 {
+				t.Fatal("expected missed slots")
+			}
+			if len(d.Post) != len(c.wantPost) {
+				t.Fatalf("got %v, want %v (%s)", d.Post, c.wantPost, d.Reason)
+			}
+			for i := range d.Post {
+				if !d.Post[i].Equal(c.wantPost[i]) {
+					t.Fatalf("got %v, want %v", d.Post, c.wantPost)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanCatchUpLimit(t *testing.T) {
+	a := TwitterAccount{Cron: "*/5 * * * *", Timezone: "UTC", CatchUp: CatchUpAll}
+	from := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	d, err := PlanCatchUp(a, from, from.Add(24*time.Hour+2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Post) != CATCHUPMAXPOSTS {
+		t.Fatalf("got %d posts, want %d", len(d.Post), CATCHUPMAXPOSTS)
+	}
+	if last := d.Post[len(d.Post)-1]; !last.Equal(from.Add(24 * time.Hour)) {
+		t.Fatalf("latest slot should be kept, got %s", last)
+	}
+
+	if _, err := PlanCatchUp(TwitterAccount{Cron: "@hourly", CatchUp: "later"}, from, from.Add(time.Hour)); err == nil {
+		t.Fatal("expected invalid catchup error")
+	}
+}
@@ -1,6 +1,7 @@
 package subsets
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strconv"
@@ -12,16 +13,14 @@ import (
 )
 
 // RequestCreateTweet API Twitter投稿リクエストを作成する
-func RequestCreateTweet(account TwitterAccount, tweet *TwitterTweet, files []string) (*types.CreateInput, error) {
-	req := &types.CreateInput{
-		Text: &tweet.Text,
-	}
-	mediaIDs := libs.TweetUpload(account, files)
-	if len(mediaIDs) != 0 && mediaIDs != nil {
-		req.Media = &types.CreateInputMedia{
-			MediaIDs: mediaIDs,
-		}
+// filesはアップロードし、MediaIDを添付する
+func RequestCreateTweet(ctx context.Context, account TwitterAccount, tweet *TwitterTweet, files []string) (*types.CreateInput, error) {
+	// アップロードの前に確認する
+	if err := tweet.ValidateOptions(libs.ChannelAPI); err != nil {
+		return nil, err
 	}
+	mediaIDs := libs.TweetUpload(ctx, account, files)
+	req := NewCreateTweetInput(tweet, mediaIDs)
 
 	// メディアアップロードに失敗した場合は、画像なしで投稿するか判断
 	if len(files) != len(mediaIDs) {
@@ -35,14 +34,30 @@ func RequestCreateTweet(account TwitterAccount, tweet *TwitterTweet, files []str
 	return req, nil
 }
 
+// NewCreateTweetInput API Twitter投稿リクエストを作成する アップロード済みのMediaIDを添付する
+// 返信・引用・投票・返信の制限の列を設定する
+func NewCreateTweetInput(tweet *TwitterTweet, mediaIDs []string) *types.CreateInput {
+	req := &types.CreateInput{
+		Text: &tweet.Text,
+	}
+	applyOptions(req, tweet)
+	if len(mediaIDs) != 0 {
+		req.Media = &types.CreateInputMedia{
+			MediaIDs: mediaIDs,
+		}
+	}
+	return req
+}
+
 // Tofiles Spread項目からfiles []stringを生成する
-func (p *TwitterTweet) Tofiles(cred []byte) []string {
+// DriveファイルはsaveDirに保存する
+func (p *TwitterTweet) Tofiles(ctx context.Context, cred []byte, saveDir string) []string {
 	var files []string
 	for _, file := range []string{p.File1, p.File2, p.File3, p.File4} {
 		// 空文字列は無視
 		if file != "" {
 			// DriveURLからファイルをダウンロードし、一時保存先を返す。DriveURLでない場合はそのまま返す
-			file = DriveToFile(cred, file)
+			file = DriveToFile(ctx, cred, file, saveDir)
 			files = append(files, file)
 		}
 	}
@@ -50,7 +65,13 @@ func (p *TwitterTweet) Tofiles(cred []byte) []string {
 }
 
 // // DriveToFile GetDriveFile GoogleDriveAPIを使用してDriveURLからファイルをダウンロードし、一時保存先を返す。DriveURLでない場合はそのまま返す
-func DriveToFile(cred []byte, file string) string {
+// saveDir: ファイルの一時保存先 プログラムにより毎日削除される
+func DriveToFile(ctx context.Context, cred []byte, file, saveDir string) string {
+	// クレデンシャルがない場合（CSVディレクトリ使用時など）はそのまま返す
+	if len(cred) == 0 {
+		return file
+	}
+
 	// DriveURLからファイルIDを取得
 	// 取得できなければそのまま返す
 	fileID, err := libs.GetFileIDFromDriveURL(file)
@@ -61,7 +82,7 @@ func DriveToFile(cred []byte, file string) string {
 
 	// FileIDが取得できれば
 	// Driveファイルをダウンロード
-	b, err := libs.GetDriveFile(cred, fileID)
+	b, err := libs.GetDriveFile(ctx, cred, fileID)
 	if err != nil {
 		log.Err(err).Msgf("failed to get drive file")
 		return file
@@ -94,7 +115,7 @@ func DriveToFile(cred []byte, file string) string {
 
 	filename := fmt.Sprintf("%s.%s", fileID, fileExtension)
 	// ファイルを保存
-	saveTo := filepath.Join(TEMPORARYDIR, filename)
+	saveTo := filepath.Join(saveDir, filename)
 	if err := libs.SaveFile(b, saveTo); err != nil {
 		log.Err(err).Msgf("failed to save file")
 		return file
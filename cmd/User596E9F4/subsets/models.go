@@ -11,24 +11,43 @@ cmd/User596E9F4におけるオンデマンドな処理を行うためのモデ
 
 package subsets
 
+import "tweet-with-spread/libs"
+
 // TwitterAccount は、Twitterアカウントを表します。
 type TwitterAccount struct {
-	Index          int    `csv:"index"`
-	TwitterID      string `csv:"twitter_id"`
-	TwitterName    string `csv:"twitter_name"`
-	Password       string `csv:"password"`
-	SpreadID       string `csv:"spread_id"`
-	ConsumerKey    string `csv:"consumer_key"`
-	ConsumerSecret string `csv:"consumer_secret"`
-	AccessToken    string `csv:"access_token"`
-	SecretToken    string `csv:"secret_token"`
-	BearerToken    string `csv:"bearer_token"`
-	Subscribed     int    `csv:"subscribed"`
-
+	Index       int    `csv:"index"`
+	TwitterID   string `csv:"twitter_id"`
+	TwitterName string `csv:"twitter_name"`
+	Password    string `csv:"password"`
+	SpreadID    string `csv:"spread_id"`
+	// Tweetsを管理するSheetのタイトル 空の場合は既定のSheet
+	TweetsSheetTitle string `csv:"tweets_sheet"`
+	ConsumerKey      string `csv:"consumer_key"`
+	ConsumerSecret   string `csv:"consumer_secret"`
+	AccessToken      string `csv:"access_token"`
+	SecretToken      string `csv:"secret_token"`
+	BearerToken      string `csv:"bearer_token"`
+	Subscribed       int    `csv:"subscribed"`
 
 	// 時間指定での投稿を行う場合の項目
-	Hours   string `csv:"hours"`
-	Minutes string `csv:"minutes"`
+	// scheduleはcron式（分 時 日 月 曜日） 例: "7 9 * * 1-5" -> 平日9:07
+	// scheduleの指定がない場合はhours, minutesを使用する
+	Cron     string `csv:"schedule"`
+	Hours    string `csv:"hours"`
+	Minutes  string `csv:"minutes"`
+	Timezone string `csv:"timezone"` // 例: Asia/Tokyo 空の場合はプロセスのタイムゾーン
+
+	// 停止・遅延で過ぎた投稿時刻の扱い
+	// catchupはskip（投稿しない）/once（猶予内であれば1回だけ投稿する）/all（過ぎた回数分投稿する） 空の場合はskip
+	// catchup_graceはonceの猶予（分） 空の場合は既定値
+	CatchUp      string `csv:"catchup"`
+	CatchUpGrace int    `csv:"catchup_grace"`
+
+	// Tweetの選択段階 カンマ区切り 例: "checked,date,priority,count,random"
+	// 空の場合はDEFAULTSELECTION account・ledgerは常に最初に適用する
+	Selection string `csv:"selection"`
+	// weighted段階の重みの式 例: "priority=1,count=-0.5,age=0.1" 空の場合はDEFAULTWEIGHT
+	Weight string `csv:"weight"`
 
 	// 以下は現行未使用
 	TermDays int `csv:"term_days"`
@@ -41,6 +60,27 @@ func (a TwitterAccount) Keys() (id, consumerKey, consumerSecret, accessToken, ac
 	return a.TwitterID, a.ConsumerKey, a.ConsumerSecret, a.AccessToken, a.SecretToken
 }
 
+// TweetsSheet は、アカウントのTweetsを読み書きするSheetを返します。
+// spread_id・tweets_sheetの指定がなければ既定のSheet（管理者用Spreadsheet）を使用します。
+// 読み込み元と書き込み先は必ずこの参照を使い、別のSpreadsheetに書き込まないようにします。
+func (a TwitterAccount) TweetsSheet(defaultRef libs.SheetRef) libs.SheetRef {
+	ref := defaultRef
+	if a.SpreadID != "" {
+		ref.SpreadID = a.SpreadID
+	}
+	if a.TweetsSheetTitle != "" {
+		ref.SheetTitle = a.TweetsSheetTitle
+	}
+	return ref
+}
+
+// WriteBackColumns は、投稿後にプログラムが上書きするTwitterTweetの列名（csvタグ）です。
+var WriteBackColumns = []string{"count", "tweet_url", "last_date"}
+
+// DeleteWriteBackColumns は、投稿の削除後にプログラムが上書きするTwitterTweetの列名（csvタグ）です。
+// delete_after・delete_previousを使用するSheetに必要です。
+var DeleteWriteBackColumns = []string{"deleted_date"}
+
 // TwitterTweet は、Twitterアカウントが包括する投稿群を表します。
 type TwitterTweet struct {
 	Index     int    `csv:"index"`
@@ -53,7 +93,23 @@ type TwitterTweet struct {
 	File3     string `csv:"file3"`
 	File4     string `csv:"file4"`
 	WithFiles int    `csv:"with_files"`
-	
+
+	// 投稿方法 空・auto: 重み付き文字数でtweet_count_ja×2を超える場合はGUI、thread: 超える場合はスレッド、gui: 常にGUI
+	Mode string `csv:"mode"`
+
+	// 返信先・引用するTweetのIDまたはURL
+	ReplyTo string `csv:"reply_to"`
+	Quote   string `csv:"quote"`
+	// 投票の選択肢（|区切り）と期間（分） 期間が空の場合は1日
+	PollOption   string `csv:"poll_options"`
+	PollDuration int    `csv:"poll_duration"`
+	// 返信できるアカウントの制限 following・mentionedUsers・subscribers・verified 空の場合は全員
+	ReplySettings string `csv:"reply_settings"`
+
+	// 投稿後に削除するまでの時間（時間） 空・0の場合は削除しない
+	DeleteAfter int `csv:"delete_after"`
+	// 1: 同じ行の前回の投稿を削除してから投稿する why: 同一内容の投稿として拒否されないため
+	DeletePrevious int `csv:"delete_previous"`
 
 	// 分岐処理用項目
 	Kind     int `csv:"kind"`
@@ -65,4 +121,9 @@ type TwitterTweet struct {
 	Count    int    `csv:"count"`
 	TweetURL string `csv:"tweet_url"`
 	LastDate string `csv:"last_date"` // 形式: YYYY/MM/DD HH:MM:SS
+	// 投稿を削除した日時 形式はlast_dateと同じ
+	DeletedDate string `csv:"deleted_date"`
+
+	// 上記以外の列 列名で参照する textのテンプレートの変数に使用する
+	Columns map[string]string `csv:"*"`
 }
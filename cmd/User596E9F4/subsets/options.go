@@ -0,0 +1,157 @@
+package subsets
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"tweet-with-spread/libs"
+
+	"github.com/michimani/gotwi/tweet/managetweet/types"
+)
+
+const (
+	// DEFAULTPOLLDURATION poll_durationが空の場合の投票期間（分） 1日
+	DEFAULTPOLLDURATION int = 1440
+)
+
+// REPLYSETTINGS reply_settingsに指定できる値 空の場合は全員が返信できる
+var REPLYSETTINGS = []string{"following", "mentionedUsers", "subscribers", "verified"}
+
+var (
+	tweetIDPattern  = regexp.MustCompile(`^[0-9]+$`)
+	tweetURLPattern = regexp.MustCompile(`^/(?:[^/]+|i/web)/status(?:es)?/([0-9]+)/?$`)
+)
+
+// ParseTweetID TweetのIDまたはURLからIDを取得する
+// 例: "1234567890", "https://x.com/user/status/1234567890", "https://twitter.com/i/web/status/1234567890"
+func ParseTweetID(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if tweetIDPattern.MatchString(s) {
+		return s, nil
+	}
+	u, err := url.Parse(s)
+	if err == nil {
+		host := strings.TrimPrefix(strings.TrimPrefix(u.Host, "www."), "mobile.")
+		if host == "x.com" || host == "twitter.com" {
+			if m := tweetURLPattern.FindStringSubmatch(u.Path); m != nil {
+				return m[1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("invalid tweet id or url: %q", s)
+}
+
+// PollOptions 投票の選択肢 poll_optionsを|で区切る 空の場合はnil
+func (p TwitterTweet) PollOptions() []string {
+	if strings.TrimSpace(p.PollOption) == "" {
+		return nil
+	}
+	var options []string
+	for _, o := range strings.Split(p.PollOption, "|") {
+		options = append(options, strings.TrimSpace(o))
+	}
+	return options
+}
+
+// ValidateOptions 返信・引用・投票・返信の制限の列を確認する
+// ‐ 返信・引用はTweetのIDまたはURL
+// ‐ 投票は選択肢2〜4個（各25文字以内）、期間5〜10080分 ファイル・引用とは併用できない
+// ‐ 削除までの時間は0以上、前回の投稿の削除は0・1
+// ‐ GUIでの投稿では指定できない（GUIでの投稿はTweetのIDを取得できず、削除もできない）
+// why: 投稿の途中（メディアのアップロード後など）で失敗しないよう、投稿前に確認する
+func (p TwitterTweet) ValidateOptions(channel string) error {
+	var errs []error
+	if p.ReplyTo != "" {
+		if _, err := ParseTweetID(p.ReplyTo); err != nil {
+			errs = append(errs, fmt.Errorf("reply_to: %w", err))
+		}
+	}
+	if p.Quote != "" {
+		if _, err := ParseTweetID(p.Quote); err != nil {
+			errs = append(errs, fmt.Errorf("quote: %w", err))
+		}
+	}
+
+	if options := p.PollOptions(); options != nil {
+		if len(options) < 2 || len(options) > 4 {
+			errs = append(errs, fmt.Errorf("poll_options: must have 2 to 4 options: %d", len(options)))
+		}
+		for _, o := range options {
+			if n := len([]rune(o)); n == 0 || n > 25 {
+				errs = append(errs, fmt.Errorf("poll_options: each option must be 1 to 25 characters: %q", o))
+			}
+		}
+		if p.hasFiles() {
+			errs = append(errs, errors.New("poll_options: poll and files are mutually exclusive"))
+		}
+		if p.Quote != "" {
+			errs = append(errs, errors.New("poll_options: poll and quote are mutually exclusive"))
+		}
+	}
+	if p.PollDuration != 0 {
+		if p.PollOptions() == nil {
+			errs = append(errs, errors.New("poll_duration: requires poll_options"))
+		} else if p.PollDuration < 5 || p.PollDuration > 10080 {
+			errs = append(errs, fmt.Errorf("poll_duration: must be 5 to 10080 minutes: %d", p.PollDuration))
+		}
+	}
+
+	if p.ReplySettings != "" && !slices.Contains(REPLYSETTINGS, p.ReplySettings) {
+		errs = append(errs, fmt.Errorf("reply_settings: must be one of %s: %q", strings.Join(REPLYSETTINGS, ","), p.ReplySettings))
+	}
+
+	if p.DeleteAfter < 0 {
+		errs = append(errs, fmt.Errorf("delete_after: must not be negative: %d", p.DeleteAfter))
+	}
+	if p.DeletePrevious != 0 && p.DeletePrevious != 1 {
+		errs = append(errs, fmt.Errorf("delete_previous: must be 0 or 1: %d", p.DeletePrevious))
+	}
+
+	if channel == libs.ChannelGUI && p.hasOptions() {
+		errs = append(errs, errors.New("reply_to, quote, poll_options and reply_settings are not supported by gui"))
+	}
+	if channel == libs.ChannelGUI && p.HasLifecycle() {
+		errs = append(errs, errors.New("delete_after and delete_previous are not supported by gui"))
+	}
+	return errors.Join(errs...)
+}
+
+// hasFiles file1〜file4のいずれかを指定しているか
+func (p TwitterTweet) hasFiles() bool {
+	return p.File1 != "" || p.File2 != "" || p.File3 != "" || p.File4 != ""
+}
+
+// hasOptions 返信・引用・投票・返信の制限のいずれかを指定しているか
+func (p TwitterTweet) hasOptions() bool {
+	return p.ReplyTo != "" || p.Quote != "" || p.PollOption != "" || p.ReplySettings != ""
+}
+
+// HasLifecycle 投稿の削除（delete_after・delete_previous）を指定しているか
+func (p TwitterTweet) HasLifecycle() bool {
+	return p.DeleteAfter > 0 || p.DeletePrevious == 1
+}
+
+// applyOptions 返信・引用・投票・返信の制限をリクエストに設定する
+// ValidateOptionsで確認済みの値を前提とし、不正な値は設定しない
+func applyOptions(req *types.CreateInput, tweet *TwitterTweet) {
+	if id, err := ParseTweetID(tweet.ReplyTo); tweet.ReplyTo != "" && err == nil {
+		req.Reply = &types.CreateInputReply{InReplyToTweetID: id}
+	}
+	if id, err := ParseTweetID(tweet.Quote); tweet.Quote != "" && err == nil {
+		req.QuoteTweetID = &id
+	}
+	if options := tweet.PollOptions(); options != nil {
+		duration := tweet.PollDuration
+		if duration == 0 {
+			duration = DEFAULTPOLLDURATION
+		}
+		req.Poll = &types.CreateInputPoll{DurationMinutes: &duration, Options: options}
+	}
+	if tweet.ReplySettings != "" {
+		settings := tweet.ReplySettings
+		req.ReplySettings = &settings
+	}
+}
@@ -0,0 +1,109 @@
+package subsets
+
+import (
+	"strings"
+	"testing"
+	"tweet-with-spread/libs"
+)
+
+func TestParseTweetID(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"1234567890", "1234567890", false},
+		{" 1234567890 ", "1234567890", false},
+		{"https://x.com/user/status/1234567890", "1234567890", false},
+		{"https://twitter.com/user/status/1234567890?s=20", "1234567890", false},
+		{"https://mobile.twitter.com/user/statuses/1234567890/", "1234567890", false},
+		{"https://twitter.com/i/web/status/1234567890", "1234567890", false},
+		{"https://example.com/user/status/1234567890", "", true},
+		{"https://x.com/user", "", true},
+		{"abc", "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			got, err := ParseTweetID(c.in)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	cases := []struct {
+		name    string
+		tweet   TwitterTweet
+		channel string
+		wantErr string
+	}{
+		{"none", TwitterTweet{}, libs.ChannelGUI, ""},
+		{"reply", TwitterTweet{ReplyTo: "https://x.com/user/status/1"}, libs.ChannelAPI, ""},
+		{"invalid reply", TwitterTweet{ReplyTo: "not a tweet"}, libs.ChannelAPI, "reply_to"},
+		{"invalid quote", TwitterTweet{Quote: "https://x.com/user"}, libs.ChannelAPI, "quote"},
+		{"poll", TwitterTweet{PollOption: "はい|いいえ", PollDuration: 60}, libs.ChannelAPI, ""},
+		{"poll one option", TwitterTweet{PollOption: "はい"}, libs.ChannelAPI, "2 to 4 options"},
+		{"poll empty option", TwitterTweet{PollOption: "はい||いいえ"}, libs.ChannelAPI, "1 to 25 characters"},
+		{"poll long option", TwitterTweet{PollOption: "a|" + strings.Repeat("b", 26)}, libs.ChannelAPI, "1 to 25 characters"},
+		{"poll with files", TwitterTweet{PollOption: "a|b", File1: "a.png"}, libs.ChannelAPI, "poll and files"},
+		{"poll with quote", TwitterTweet{PollOption: "a|b", Quote: "1"}, libs.ChannelAPI, "poll and quote"},
+		{"poll duration", TwitterTweet{PollOption: "a|b", PollDuration: 4}, libs.ChannelAPI, "5 to 10080"},
+		{"duration without poll", TwitterTweet{PollDuration: 60}, libs.ChannelAPI, "requires poll_options"},
+		{"reply settings", TwitterTweet{ReplySettings: "following"}, libs.ChannelThread, ""},
+		{"invalid reply settings", TwitterTweet{ReplySettings: "nobody"}, libs.ChannelAPI, "reply_settings"},
+		{"gui", TwitterTweet{ReplyTo: "1"}, libs.ChannelGUI, "not supported by gui"},
+		{"delete after", TwitterTweet{DeleteAfter: 24, DeletePrevious: 1}, libs.ChannelThread, ""},
+		{"negative delete after", TwitterTweet{DeleteAfter: -1}, libs.ChannelAPI, "delete_after"},
+		{"invalid delete previous", TwitterTweet{DeletePrevious: 2}, libs.ChannelAPI, "delete_previous"},
+		{"gui delete", TwitterTweet{DeletePrevious: 1}, libs.ChannelGUI, "delete_after and delete_previous are not supported by gui"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.tweet.ValidateOptions(c.channel)
+			if c.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Fatalf("err: %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewCreateTweetInputOptions(t *testing.T) {
+	tweet := &TwitterTweet{
+		Text:          "投票",
+		ReplyTo:       "https://x.com/user/status/10",
+		PollOption:    "はい | いいえ",
+		ReplySettings: "mentionedUsers",
+	}
+	req := NewCreateTweetInput(tweet, nil)
+	if req.Reply == nil || req.Reply.InReplyToTweetID != "10" {
+		t.Fatalf("reply: %+v", req.Reply)
+	}
+	if req.Poll == nil || *req.Poll.DurationMinutes != DEFAULTPOLLDURATION || strings.Join(req.Poll.Options, ",") != "はい,いいえ" {
+		t.Fatalf("poll: %+v", req.Poll)
+	}
+	if req.QuoteTweetID != nil || req.Media != nil || req.ReplySettings == nil || *req.ReplySettings != "mentionedUsers" {
+		t.Fatalf("req: %+v", req)
+	}
+
+	quote := NewCreateTweetInput(&TwitterTweet{Text: "引用", Quote: "20"}, []string{"m"})
+	if quote.QuoteTweetID == nil || *quote.QuoteTweetID != "20" || quote.Reply != nil || quote.Poll != nil {
+		t.Fatalf("quote: %+v", quote)
+	}
+
+	// スレッドでは返信先・引用・投票は先頭のみ、返信の制限は全て
+	reqs := NewCreateThreadInputs(tweet, []string{"一", "二"}, nil)
+	if reqs[0].Reply == nil || reqs[0].Poll == nil || reqs[1].Reply != nil || reqs[1].Poll != nil || reqs[1].ReplySettings == nil {
+		t.Fatalf("thread: %+v, %+v", reqs[0], reqs[1])
+	}
+}
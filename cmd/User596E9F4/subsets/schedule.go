@@ -0,0 +1,112 @@
+package subsets
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser 標準のcron式（分 時 日 月 曜日）と@daily等の記述子を受け付ける
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Location アカウントのタイムゾーンを返す
+// 指定がなければプロセスのタイムゾーン
+func (a TwitterAccount) Location() (*time.Location, error) {
+	if a.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", a.Timezone, err)
+	}
+	return loc, nil
+}
+
+// CronSpec アカウントの投稿スケジュールをcron式で返す
+// ‐ schedule列の指定があればそのまま使用する
+// ‐ なければhours, minutes列から生成する 例: hours "9,21", minutes "0,30" -> "0,30 9,21 * * *"
+func (a TwitterAccount) CronSpec() (string, error) {
+	if s := strings.TrimSpace(a.Cron); s != "" {
+		return s, nil
+	}
+
+	hours := StrToIntSlice(a.Hours)
+	minutes := StrToIntSlice(a.Minutes)
+	if len(hours) == 0 || len(minutes) == 0 {
+		return "", errors.New("no schedule, hours and minutes are required without schedule")
+	}
+
+	return fmt.Sprintf("%s %s * * *", joinInts(minutes), joinInts(hours)), nil
+}
+
+// CronSchedule アカウントの投稿スケジュールとタイムゾーンを返す
+func (a TwitterAccount) CronSchedule() (cron.Schedule, *time.Location, error) {
+	spec, err := a.CronSpec()
+	if err != nil {
+		return nil, nil, err
+	}
+	sched, err := cronParser.Parse(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+	}
+	loc, err := a.Location()
+	if err != nil {
+		return nil, nil, err
+	}
+	return sched, loc, nil
+}
+
+// NextFire アカウントのafter以降（afterを含まない）の次回投稿時刻を返す
+// 時刻はアカウントのタイムゾーンで評価する
+func (a TwitterAccount) NextFire(after time.Time) (time.Time, error) {
+	sched, loc, err := a.CronSchedule()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sched.Next(after.In(loc)), nil
+}
+
+// IsDue tの分がアカウントの投稿時刻であるか
+func (a TwitterAccount) IsDue(t time.Time) (bool, error) {
+	minute := t.Truncate(time.Minute)
+	next, err := a.NextFire(minute.Add(-time.Second))
+	if err != nil {
+		return false, err
+	}
+	return next.Equal(minute), nil
+}
+
+// NextFire 購読中のアカウントの次回投稿時刻のうち、最も早い時刻を返す
+// スケジュールが不正なアカウントは除外する
+func NextFire(after time.Time, accounts []TwitterAccount) (time.Time, bool) {
+	var (
+		next  time.Time
+		found bool
+	)
+	for _, a := range accounts {
+		if a.Subscribed != 1 {
+			continue
+		}
+		t, err := a.NextFire(after)
+		if err != nil || t.IsZero() {
+			continue
+		}
+		if !found || t.Before(next) {
+			next = t
+			found = true
+		}
+	}
+	return next, found
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
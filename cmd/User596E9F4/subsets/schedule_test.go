@@ -0,0 +1,91 @@
+package subsets
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextFire(t *testing.T) {
+	jst, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2024/01/05 金曜日 00:00 UTC = 09:00 JST
+	after := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		account TwitterAccount
+		want    time.Time
+	}{
+		{
+			name:    "cron weekdays JST",
+			account: TwitterAccount{Cron: "7 9 * * 1-5", Timezone: "Asia/Tokyo"},
+			want:    time.Date(2024, 1, 5, 9, 7, 0, 0, jst),
+		},
+		{
+			name:    "cron skips weekend",
+			account: TwitterAccount{Cron: "0 9 * * 1-5", Timezone: "Asia/Tokyo"},
+			want:    time.Date(2024, 1, 8, 9, 0, 0, 0, jst),
+		},
+		{
+			name:    "hours and minutes fallback",
+			account: TwitterAccount{Hours: "9,21", Minutes: "0,30", Timezone: "Asia/Tokyo"},
+			want:    time.Date(2024, 1, 5, 9, 30, 0, 0, jst),
+		},
+		{
+			name:    "schedule takes precedence",
+			account: TwitterAccount{Cron: "@daily", Hours: "9", Minutes: "30", Timezone: "UTC"},
+			want:    time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := c.account.NextFire(after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(c.want) {
+				t.Fatalf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestScheduleErrors(t *testing.T) {
+	for _, a := range []TwitterAccount{
+		{},
+		{Cron: "61 * * * *"},
+		{Cron: "0 9 * * *", Timezone: "Mars/Base"},
+	} {
+		if _, err := a.NextFire(time.Now()); err == nil {
+			t.Fatalf("expected error for %+v", a)
+		}
+	}
+}
+
+func TestSelectTwitterAccounts(t *testing.T) {
+	accounts := []TwitterAccount{
+		{TwitterID: "jst", Subscribed: 1, Cron: "7 9 * * *", Timezone: "Asia/Tokyo"},
+		{TwitterID: "utc", Subscribed: 1, Hours: "0", Minutes: "7", Timezone: "UTC"},
+		{TwitterID: "unsubscribed", Subscribed: 0, Cron: "* * * * *"},
+		{TwitterID: "invalid", Subscribed: 1, Cron: "invalid"},
+		{TwitterID: "other", Subscribed: 1, Cron: "8 9 * * *", Timezone: "Asia/Tokyo"},
+	}
+
+	// 00:07:30 UTC = 09:07:30 JST
+	got, err := SelectTwitterAccounts(time.Date(2024, 1, 5, 0, 7, 30, 0, time.UTC), accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].TwitterID != "jst" || got[1].TwitterID != "utc" {
+		t.Fatalf("got %+v", got)
+	}
+
+	next, ok := NextFire(time.Date(2024, 1, 5, 0, 7, 0, 0, time.UTC), accounts)
+	if !ok || !next.Equal(time.Date(2024, 1, 5, 0, 8, 0, 0, time.UTC)) {
+		t.Fatalf("next fire: got %s, %t", next, ok)
+	}
+}
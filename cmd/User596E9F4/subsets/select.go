@@ -17,9 +17,9 @@ package subsets
 import (
 	"errors"
 	"fmt"
-	"math/rand"
 	"sort"
 	"time"
+	"tweet-with-spread/libs"
 
 	"github.com/rs/zerolog/log"
 )
@@ -28,11 +28,6 @@ const (
 	// 日付のフォーマット
 	// "2006/01/02 15:04:05" -> "YYYY/MM/DD HH:MM:SS"
 	LAYOUT string = "2006/01/02 15:04:05"
-
-	// ファイルの一時保存先
-	// プログラムによりファイルは24時に削除される
-	// why: ストレージを圧迫しないため
-	TEMPORARYDIR = "./temp"
 )
 
 // SelectTwitterAccounts Twitter account listから投稿するべきアカウントを取得する
@@ -53,26 +48,15 @@ func SelectTwitterAccounts(t time.Time, sourceAccounts []TwitterAccount) ([]Twit
 			continue
 		}
 
-		hours := StrToIntSlice(sourceAccounts[i].Hours)
-		// 時間指定での投稿を行う場合の選別
-		for j := 0; j < len(hours); j++ {
-			// 指定時間総当たりで選別
-			// 一致しなければ次の指定時間へ
-			if t.Hour() != hours[j] {
-				continue
-			}
-
-			// 時間合致確認後
-			// 分指定での投稿を行う場合の選別
-			minutes := StrToIntSlice(sourceAccounts[i].Minutes)
-			for k := 0; k < len(minutes); k++ {
-				if t.Minute() != minutes[k] {
-					continue
-				}
-				targetAccounts = append(targetAccounts, sourceAccounts[i])
-				// 一つでも合致したら次のアカウントへ
-				break
-			}
+		// 投稿スケジュール（schedule、またはhours, minutes）で選別
+		// アカウントのタイムゾーンでtの分が投稿時刻であるか
+		isDue, err := sourceAccounts[i].IsDue(t)
+		if err != nil {
+			log.Warn().Str("function", "SelectTwitterAccounts").Msgf("invalid schedule, %s: %s", sourceAccounts[i].TwitterID, err)
+			continue
+		}
+		if isDue {
+			targetAccounts = append(targetAccounts, sourceAccounts[i])
 		}
 	}
 
@@ -84,56 +68,40 @@ func SelectTwitterAccounts(t time.Time, sourceAccounts []TwitterAccount) ([]Twit
 }
 
 // SelectTweet 指定条件でTweetsを選択する
-// ‐ 現行: 最後の投稿から指定日数経過したTweetsを抜粋
-func SelectTweet(account TwitterAccount, tweets []TwitterTweet) (*TwitterTweet, error) {
-	// 指定アカウントのTweetsを抜粋
-	targetTweet, err := TweetsByAccount(account, tweets)
+// ‐ アカウントのselection（空の場合はDEFAULTSELECTION）の選択段階を順に適用する。詳細はNewPipeline
+// ‐ now: 選択する時刻。経過日数の基準とする。planでは模擬の時刻を指定する
+// ‐ rnd: 候補が複数残った場合の選択に使用する。seedを指定すると選択を再現できる
+// ‐ sheet: tweetsを読み込んだSheet
+// ‐ history: 投稿履歴。Spreadsheetへの書き込みに失敗した投稿を重複して選択しないために参照する
+// 選択できなかった場合も、段階ごとの候補数・除外の理由を記録した選択の経過を返す
+func SelectTweet(now time.Time, rnd libs.Rand, account TwitterAccount, sheet libs.SheetRef, tweets []TwitterTweet, history []libs.LedgerEntry) (*TwitterTweet, SelectTrace, error) {
+	pipeline, err := NewPipeline(account.Selection)
 	if err != nil {
-		return nil, err
+		return nil, SelectTrace{Account: account.TwitterID, At: now, Candidates: len(tweets), Error: err.Error()}, err
 	}
 
-	// // 最後の投稿から指定日数経過したTweetsを抜粋
-	targetTweet, err = TweetsByDate(account, targetTweet)
+	sc := SelectContext{Now: now, Rand: rnd, Account: account, Sheet: sheet, History: history}
+	selectedTweet, trace, err := pipeline.Run(sc, tweets)
+	log.Debug().Str("function", "SelectTweet").Msgf("account: %s, stages: %s", account.TwitterID, trace.Summary())
 	if err != nil {
-		return nil, err
-	}
-
-	// チェック有無でTweetsを抜粋
-	targetTweet, err = TweetsByChecked(account, targetTweet)
-	if err != nil {
-		return nil, err
-	}
-
-	// PriorityでTweetsをソート
-	targetTweet, err = SortByPriority(account, targetTweet)
-	if err != nil {
-		return nil, err
-	}
-
-	// CountでTweetsをソート
-	targetTweet, err = TweetsByCount(account, targetTweet)
-	if err != nil {
-		return nil, err
-	}
-
-	// Tweetを一つ選択
-	selectedTweet, err := SelectTweetsToOne(targetTweet)
-	if err != nil {
-		return nil, err
+		return nil, trace, err
 	}
 
 	// 最終チェック
 	if err := finalCheck(account, *selectedTweet); err != nil {
-		return nil, err
+		trace.Selected = 0
+		trace.Error = err.Error()
+		return nil, trace, err
 	}
 
-	return selectedTweet, nil
+	return selectedTweet, trace, nil
 }
 
 /*
-	Select elements 投稿選択の条件分岐実装各項目
+	Select elements 投稿選択の条件分岐実装各項目 選択段階として登録する（stage.go）
 	- tweetsByAccount: 指定アカウントのTweetsを抜粋
 	- tweetsByDate: 最後の投稿から指定日数経過したTweetsを抜粋
+	- tweetsByLedger: 投稿履歴で指定日数以内に投稿したTweetsを除外
 	- tweetsByChecked: チェック有無でTweetsを抜粋
 	- sortByPriority: PriorityでTweetsをソート
 	- tweetsByCount: CountでTweetsをソート
@@ -169,7 +137,8 @@ func TweetsByAccount(account TwitterAccount, tweets []TwitterTweet) ([]TwitterTw
 	return targetTweet, nil
 }
 
-func TweetsByDate(account TwitterAccount, tweets []TwitterTweet) ([]TwitterTweet, error) {
+// TweetsByDate 最後の投稿からnowまでに指定日数経過したTweetsを抜粋
+func TweetsByDate(now time.Time, account TwitterAccount, tweets []TwitterTweet) ([]TwitterTweet, error) {
 	isThere, _, err := Exist(tweets)
 	if err != nil || !isThere {
 		return nil, err
@@ -177,7 +146,7 @@ func TweetsByDate(account TwitterAccount, tweets []TwitterTweet) ([]TwitterTweet
 	// 一つであってもチェックする
 
 	var selectedTweets []TwitterTweet
-	borderDate := time.Now().AddDate(0, 0, -int(account.TermDays))
+	borderDate := now.AddDate(0, 0, -int(account.TermDays))
 	for i := 0; i < len(tweets); i++ {
 		// JTStimeから文字列で保存されたLastDateをtime型に変換、JSTとの時差を緩衝する
 		// 失敗した場合は、ログを出力し次の処理を続行する
@@ -199,6 +168,49 @@ func TweetsByDate(account TwitterAccount, tweets []TwitterTweet) ([]TwitterTweet
 	return selectedTweets, nil
 }
 
+// TweetsByLedger 投稿履歴で指定日数以内に投稿したTweetsを除外
+// why: Spreadsheetのlast_dateが更新されていなくても、同じTweet（Indexまたは同文）を重複して投稿しない
+// Indexはtweetsを読み込んだSheet（sheet）の投稿のみ、同文は別のSheetの投稿も照合する
+func TweetsByLedger(now time.Time, account TwitterAccount, sheet libs.SheetRef, tweets []TwitterTweet, history []libs.LedgerEntry) ([]TwitterTweet, error) {
+	isThere, _, err := Exist(tweets)
+	if err != nil || !isThere {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return tweets, nil
+	}
+
+	borderDate := now.AddDate(0, 0, -int(account.TermDays))
+	recentIndex := make(map[int]bool)
+	recentText := make(map[string]bool)
+	for _, e := range history {
+		if e.Event != libs.LedgerPosted || e.Account != account.TwitterID {
+			continue
+		}
+		if e.PostedAt.Before(borderDate) {
+			continue
+		}
+		if e.SheetRef.SameSheet(sheet) {
+			recentIndex[e.Index] = true
+		}
+		recentText[e.TextHash] = true
+	}
+
+	var selectedTweets []TwitterTweet
+	for i := 0; i < len(tweets); i++ {
+		if recentIndex[tweets[i].Index] || recentText[libs.TextHash(tweets[i].Text)] {
+			log.Debug().Str("function", "TweetsByLedger").Msgf("posted recently in ledger, index: %d", tweets[i].Index)
+			continue
+		}
+		selectedTweets = append(selectedTweets, tweets[i])
+	}
+	if len(selectedTweets) == 0 {
+		return nil, errors.New("no tweet without recent post in ledger")
+	}
+
+	return selectedTweets, nil
+}
+
 // AdjustDate 文字列をtime型にするための補助調整する
 func AdjustDate(s string) (time.Time, error) {
 	t, err := time.Parse(LAYOUT, s)
@@ -228,6 +240,9 @@ func TweetsByChecked(account TwitterAccount, tweets []TwitterTweet) ([]TwitterTw
 			selectedTweets = append(selectedTweets, tweets[i])
 		}
 	}
+	if len(selectedTweets) == 0 {
+		return nil, errors.New("no checked tweet")
+	}
 
 	return selectedTweets, nil
 }
@@ -294,7 +309,7 @@ func Exist(tweets []TwitterTweet) (bool, int, error) {
 }
 
 // SelectTweetsToOne 条件にあったTweetsを選択（現行ランダム
-func SelectTweetsToOne(tweets []TwitterTweet) (*TwitterTweet, error) {
+func SelectTweetsToOne(rnd libs.Rand, tweets []TwitterTweet) (*TwitterTweet, error) {
 	isThere, l, err := Exist(tweets)
 	if err != nil || !isThere {
 		return nil, fmt.Errorf("%v > no tweet at select one", err)
@@ -302,7 +317,7 @@ func SelectTweetsToOne(tweets []TwitterTweet) (*TwitterTweet, error) {
 		return &tweets[0], nil
 	}
 
-	n := rand.Intn(l)
+	n := rnd.Intn(l)
 
 	return &tweets[n], nil
 }
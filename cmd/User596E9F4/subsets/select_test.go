@@ -0,0 +1,248 @@
+package subsets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+// fakeRand 常にn・fを返す乱数 nが範囲外の場合は最大値
+type fakeRand struct {
+	n int
+	f float64
+}
+
+func (r fakeRand) Intn(n int) int {
+	if r.n >= n {
+		return n - 1
+	}
+	return r.n
+}
+
+func (r fakeRand) Float64() float64 { return r.f }
+
+// fakeClock 待機せずに待機時間を記録する
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+func indexes(tweets []TwitterTweet) []int {
+	if tweets == nil {
+		return nil
+	}
+	s := make([]int, len(tweets))
+	for i, t := range tweets {
+		s[i] = t.Index
+	}
+	return s
+}
+
+// selectCase Tweetsの選択の各段階のテストケース
+type selectCase struct {
+	name    string
+	account TwitterAccount
+	tweets  []TwitterTweet
+	want    []int
+	wantErr bool
+}
+
+func runSelectCases(t *testing.T, cases []selectCase, f func(TwitterAccount, []TwitterTweet) ([]TwitterTweet, error)) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := f(c.account, c.tweets)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if !reflect.DeepEqual(indexes(got), c.want) {
+				t.Fatalf("got %v, want %v", indexes(got), c.want)
+			}
+		})
+	}
+}
+
+func TestTweetsByAccount(t *testing.T) {
+	user := TwitterAccount{TwitterID: "user"}
+	runSelectCases(t, []selectCase{
+		{"empty", user, nil, nil, true},
+		{"same id", user, []TwitterTweet{{Index: 1, TwitterID: "user"}, {Index: 2, TwitterID: "other"}, {Index: 3, TwitterID: "user"}}, []int{1, 3}, false},
+		{"no same id", user, []TwitterTweet{{Index: 1, TwitterID: "other"}}, nil, true},
+	}, TweetsByAccount)
+}
+
+func TestTweetsByDate(t *testing.T) {
+	// last_dateはJSTで記録される 2024/02/07 09:00:00 JST = 2024/02/07 00:00:00 UTC
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	account := TwitterAccount{TwitterID: "user", TermDays: 3}
+	runSelectCases(t, []selectCase{
+		{"empty", account, nil, nil, true},
+		{"older than term", account, []TwitterTweet{{Index: 1, LastDate: "2024/02/07 08:59:59"}, {Index: 2, LastDate: "2024/02/07 09:00:00"}}, []int{1}, false},
+		{"all recent", account, []TwitterTweet{{Index: 1, LastDate: "2024/02/09 09:00:00"}}, nil, true},
+		{"invalid date is skipped", account, []TwitterTweet{{Index: 1, LastDate: "yesterday"}, {Index: 2, LastDate: "2024/01/01 00:00:00"}}, []int{2}, false},
+		{"no term", TwitterAccount{TwitterID: "user"}, []TwitterTweet{{Index: 1, LastDate: "2024/02/10 08:59:00"}, {Index: 2, LastDate: "2024/02/10 09:00:00"}}, []int{1}, false},
+	}, func(a TwitterAccount, tweets []TwitterTweet) ([]TwitterTweet, error) {
+		return TweetsByDate(now, a, tweets)
+	})
+}
+
+func TestTweetsByLedger(t *testing.T) {
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	account := TwitterAccount{TwitterID: "user", TermDays: 3}
+	sheet := libs.SheetRef{SpreadID: "s", SheetTitle: "tweets", RangeKey: "A1:Z"}
+	otherSheet := libs.SheetRef{SpreadID: "s", SheetTitle: "other"}
+	tweets := []TwitterTweet{{Index: 1, Text: "a"}, {Index: 2, Text: "b"}, {Index: 3, Text: "c"}}
+	history := []libs.LedgerEntry{
+		// 期間内に投稿した（取得範囲は比較しない）
+		{Event: libs.LedgerPosted, SheetRef: libs.SheetRef{SpreadID: "s", SheetTitle: "tweets"}, Account: "user", Index: 1, PostedAt: now.AddDate(0, 0, -1)},
+		// 期間内に同文を投稿した（行が移動した場合、別のSheetの場合）
+		{Event: libs.LedgerPosted, SheetRef: otherSheet, Account: "user", Index: 9, TextHash: libs.TextHash("b"), PostedAt: now.AddDate(0, 0, -2)},
+		// 期間外
+		{Event: libs.LedgerPosted, SheetRef: sheet, Account: "user", Index: 3, PostedAt: now.AddDate(0, 0, -4)},
+		// 別アカウント
+		{Event: libs.LedgerPosted, SheetRef: sheet, Account: "other", Index: 3, PostedAt: now},
+		// 別のSheetの同じIndex
+		{Event: libs.LedgerPosted, SheetRef: otherSheet, Account: "user", Index: 3, PostedAt: now},
+	}
+
+	cases := []struct {
+		name    string
+		history []libs.LedgerEntry
+		want    []int
+		wantErr bool
+	}{
+		{"no history", nil, []int{1, 2, 3}, false},
+		{"recent posts are excluded", history, []int{3}, false},
+		{"all excluded", append(history, libs.LedgerEntry{Event: libs.LedgerPosted, SheetRef: sheet, Account: "user", Index: 3, PostedAt: now}), nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := TweetsByLedger(now, account, sheet, tweets, c.history)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if !reflect.DeepEqual(indexes(got), c.want) {
+				t.Fatalf("got %v, want %v", indexes(got), c.want)
+			}
+		})
+	}
+}
+
+func TestTweetsByChecked(t *testing.T) {
+	runSelectCases(t, []selectCase{
+		{"empty", TwitterAccount{}, nil, nil, true},
+		{"checked", TwitterAccount{}, []TwitterTweet{{Index: 1, Checked: 1}, {Index: 2, Checked: 0}, {Index: 3, Checked: 1}}, []int{1, 3}, false},
+		{"none checked", TwitterAccount{}, []TwitterTweet{{Index: 1}}, nil, true},
+	}, TweetsByChecked)
+}
+
+func TestSortByPriority(t *testing.T) {
+	runSelectCases(t, []selectCase{
+		{"empty", TwitterAccount{}, nil, nil, true},
+		{"one", TwitterAccount{}, []TwitterTweet{{Index: 1, Priority: 0}}, []int{1}, false},
+		{"highest", TwitterAccount{}, []TwitterTweet{{Index: 1, Priority: 1}, {Index: 2, Priority: 3}, {Index: 3, Priority: 3}}, []int{2, 3}, false},
+	}, SortByPriority)
+}
+
+func TestTweetsByCount(t *testing.T) {
+	runSelectCases(t, []selectCase{
+		{"empty", TwitterAccount{}, nil, nil, true},
+		{"one", TwitterAccount{}, []TwitterTweet{{Index: 1, Count: 5}}, []int{1}, false},
+		{"lowest", TwitterAccount{}, []TwitterTweet{{Index: 1, Count: 2}, {Index: 2, Count: 0}, {Index: 3, Count: 1}}, []int{2}, false},
+	}, TweetsByCount)
+}
+
+func TestSelectTweetsToOne(t *testing.T) {
+	tweets := []TwitterTweet{{Index: 1}, {Index: 2}, {Index: 3}}
+	cases := []struct {
+		name    string
+		rnd     libs.Rand
+		tweets  []TwitterTweet
+		want    int
+		wantErr bool
+	}{
+		{"empty", fakeRand{}, nil, 0, true},
+		{"one", fakeRand{n: 2}, tweets[:1], 1, false},
+		{"first", fakeRand{n: 0}, tweets, 1, false},
+		{"last", fakeRand{n: 2}, tweets, 3, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := SelectTweetsToOne(c.rnd, c.tweets)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if got != nil && got.Index != c.want {
+				t.Fatalf("got %d, want %d", got.Index, c.want)
+			}
+		})
+	}
+}
+
+// TestSelectTweetSeed 同じseedでは同じTweetを選択すること
+func TestSelectTweetSeed(t *testing.T) {
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	account := TwitterAccount{TwitterID: "user", TermDays: 1}
+	var tweets []TwitterTweet
+	for i := 1; i <= 20; i++ {
+		tweets = append(tweets, TwitterTweet{Index: i, TwitterID: "user", Checked: 1, LastDate: "2024/01/01 00:00:00"})
+	}
+
+	pick := func(seed int64) []int {
+		rnd := libs.NewRand(seed)
+		var got []int
+		for i := 0; i < 10; i++ {
+			tweet, _, err := SelectTweet(now, rnd, account, libs.SheetRef{}, tweets, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, tweet.Index)
+		}
+		return got
+	}
+	if a, b := pick(42), pick(42); !reflect.DeepEqual(a, b) {
+		t.Fatalf("same seed must select same tweets: %v, %v", a, b)
+	}
+}
+
+func TestWait(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		name    string
+		ctx     context.Context
+		rnd     libs.Rand
+		maxSec  int
+		want    []time.Duration
+		wantErr error
+	}{
+		{"no wait", context.Background(), fakeRand{n: 100}, 0, nil, nil},
+		{"random wait", context.Background(), fakeRand{n: 1500}, 2, []time.Duration{1500 * time.Millisecond}, nil},
+		{"canceled", canceled, fakeRand{n: 1500}, 2, []time.Duration{1500 * time.Millisecond}, context.Canceled},
+		{"canceled without wait", canceled, fakeRand{}, 0, nil, context.Canceled},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clock := &fakeClock{}
+			err := Wait(c.ctx, clock, c.rnd, c.maxSec)
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("err: %v, want: %v", err, c.wantErr)
+			}
+			if !reflect.DeepEqual(clock.slept, c.want) {
+				t.Fatalf("slept: %v, want: %v", clock.slept, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package subsets
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+const (
+	// DEFAULTSELECTION アカウントのselectionが空の場合の選択段階
+	DEFAULTSELECTION string = "date,checked,priority,count,random"
+)
+
+// REQUIREDSTAGES selectionにかかわらず最初に適用する選択段階
+// why: 別アカウントのTweet・投稿履歴で最近投稿したTweetを選択しない
+var REQUIREDSTAGES = []string{"account", "ledger"}
+
+// SelectContext 選択の各段階が参照する情報
+type SelectContext struct {
+	// 選択する時刻 経過日数の基準とする
+	Now time.Time
+	// 候補からランダムに選択する段階で使用する
+	Rand    libs.Rand
+	Account TwitterAccount
+	// Tweetsを読み込んだSheet 投稿履歴の行（Index）との照合に使用する
+	Sheet libs.SheetRef
+	// 投稿履歴
+	History []libs.LedgerEntry
+}
+
+// Stage 選択の段階
+// 候補を絞り込む（filter）、または並べ替えて上位に絞り込む（ranker）
+// 候補が残らない場合はエラーを返す
+type Stage interface {
+	Apply(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error)
+}
+
+// StageFunc 関数をStageとして使用する
+type StageFunc func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error)
+
+func (f StageFunc) Apply(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+	return f(sc, tweets)
+}
+
+var (
+	stagesMu sync.RWMutex
+	stages   = make(map[string]Stage)
+)
+
+// RegisterStage 選択段階をnameで登録する
+// アカウントのselectionでnameを指定すると使用できる 同じnameを登録するとpanicする
+func RegisterStage(name string, s Stage) {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+	if name == "" || s == nil {
+		panic("subsets: RegisterStage with empty name or nil stage")
+	}
+	if _, ok := stages[name]; ok {
+		panic("subsets: RegisterStage called twice for " + name)
+	}
+	stages[name] = s
+}
+
+// LookupStage 登録された選択段階
+func LookupStage(name string) (Stage, bool) {
+	stagesMu.RLock()
+	defer stagesMu.RUnlock()
+	s, ok := stages[name]
+	return s, ok
+}
+
+// StageNames 登録された選択段階の名前 昇順
+func StageNames() []string {
+	stagesMu.RLock()
+	defer stagesMu.RUnlock()
+	names := make([]string, 0, len(stages))
+	for name := range stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Explainer 候補から除外したTweetの理由を返す選択段階
+// keptは段階の後に残った候補 実装しない段階の理由は"dropped by <段階名>"
+type Explainer interface {
+	Explain(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string
+}
+
+// explainedStage 除外の理由を返す関数を持つStage
+type explainedStage struct {
+	StageFunc
+	explain func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string
+}
+
+func (s explainedStage) Explain(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+	return s.explain(sc, tweet, kept)
+}
+
+func init() {
+	RegisterStage("account", explainedStage{
+		func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+			return TweetsByAccount(sc.Account, tweets)
+		},
+		func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+			return fmt.Sprintf("wrong account: %s", tweet.TwitterID)
+		},
+	})
+	RegisterStage("date", explainedStage{
+		func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+			return TweetsByDate(sc.Now, sc.Account, tweets)
+		},
+		func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+			if _, err := AdjustDate(tweet.LastDate); err != nil {
+				return fmt.Sprintf("unparseable last_date: %q", tweet.LastDate)
+			}
+			return fmt.Sprintf("posted too recently: last_date %s, term_days %d", tweet.LastDate, sc.Account.TermDays)
+		},
+	})
+	RegisterStage("ledger", explainedStage{
+		func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+			return TweetsByLedger(sc.Now, sc.Account, sc.Sheet, tweets, sc.History)
+		},
+		func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+			borderDate := sc.Now.AddDate(0, 0, -int(sc.Account.TermDays))
+			for _, e := range sc.History {
+				if e.Event != libs.LedgerPosted || e.Account != sc.Account.TwitterID || e.PostedAt.Before(borderDate) {
+					continue
+				}
+				if e.SheetRef.SameSheet(sc.Sheet) && e.Index == tweet.Index {
+					return fmt.Sprintf("posted too recently in ledger: %s", e.PostedAt.Format(time.RFC3339))
+				}
+				if e.TextHash == libs.TextHash(tweet.Text) {
+					return fmt.Sprintf("same text posted too recently in ledger: index %d, %s", e.Index, e.PostedAt.Format(time.RFC3339))
+				}
+			}
+			return "posted too recently in ledger"
+		},
+	})
+	RegisterStage("checked", explainedStage{
+		func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+			return TweetsByChecked(sc.Account, tweets)
+		},
+		func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+			return "unchecked"
+		},
+	})
+	RegisterStage("priority", explainedStage{
+		func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+			return SortByPriority(sc.Account, tweets)
+		},
+		func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+			// 段階がエラーを返した場合は残った候補がない
+			if len(kept) == 0 {
+				return "dropped by priority"
+			}
+			return fmt.Sprintf("lower priority: %d < %d", tweet.Priority, kept[0].Priority)
+		},
+	})
+	RegisterStage("count", explainedStage{
+		func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+			return TweetsByCount(sc.Account, tweets)
+		},
+		func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+			if len(kept) == 0 {
+				return "dropped by count"
+			}
+			return fmt.Sprintf("higher count: %d > %d", tweet.Count, kept[0].Count)
+		},
+	})
+	RegisterStage("random", explainedStage{
+		func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+			tweet, err := SelectTweetsToOne(sc.Rand, tweets)
+			if err != nil {
+				return nil, err
+			}
+			return []TwitterTweet{*tweet}, nil
+		},
+		func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+			return "not drawn"
+		},
+	})
+}
+
+// StageReport 選択段階ごとの候補数 診断用
+type StageReport struct {
+	Stage string `json:"stage"`
+	// 段階の前後の候補数
+	In  int `json:"in"`
+	Out int `json:"out"`
+	// 段階で除外した候補数
+	Removed int    `json:"removed"`
+	Error   string `json:"error,omitempty"`
+	// 除外したTweetと理由
+	Dropped []DroppedTweet `json:"dropped,omitempty"`
+}
+
+// DroppedTweet 選択段階で除外したTweet
+type DroppedTweet struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// SelectTrace アカウントのTweetの選択の経過 選択できなかった理由の確認用
+type SelectTrace struct {
+	Account string    `json:"account"`
+	At      time.Time `json:"at"`
+	// 全候補数
+	Candidates int           `json:"candidates"`
+	Stages     []StageReport `json:"stages"`
+	// 選択したTweetのIndex
+	Selected int    `json:"selected,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Summary 段階ごとの候補数の1行の要約 例: "account 5->4, ledger 4->4, date 4->0"
+func (t SelectTrace) Summary() string {
+	parts := make([]string, len(t.Stages))
+	for i, s := range t.Stages {
+		parts[i] = fmt.Sprintf("%s %d->%d", s.Stage, s.In, s.Out)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Pipeline 選択段階の並び
+type Pipeline struct {
+	names  []string
+	stages []Stage
+}
+
+// NewPipeline selection（カンマ区切りの選択段階名 例: "checked,date,priority,count,random"）から選択段階の並びを作成する
+// ‐ REQUIREDSTAGESを先頭に追加する
+// ‐ selectionが空の場合はDEFAULTSELECTION
+// ‐ 登録されていない名前はエラー
+func NewPipeline(selection string) (Pipeline, error) {
+	if strings.TrimSpace(selection) == "" {
+		selection = DEFAULTSELECTION
+	}
+	names := append([]string(nil), REQUIREDSTAGES...)
+	for _, name := range strings.Split(selection, ",") {
+		names = append(names, strings.ToLower(strings.TrimSpace(name)))
+	}
+
+	var p Pipeline
+	for _, name := range names {
+		if name == "" {
+			return Pipeline{}, fmt.Errorf("invalid selection %q: empty stage", selection)
+		}
+		s, ok := LookupStage(name)
+		if !ok {
+			return Pipeline{}, fmt.Errorf("invalid selection %q: unknown stage %q, must be one of %s", selection, name, strings.Join(StageNames(), ","))
+		}
+		p.names = append(p.names, name)
+		p.stages = append(p.stages, s)
+	}
+	return p, nil
+}
+
+// Names 選択段階名
+func (p Pipeline) Names() []string {
+	return append([]string(nil), p.names...)
+}
+
+// Run 選択段階を順に適用し、Tweetを一つ選択する
+// 最後に複数の候補が残った場合は先頭（Sheetの行順、並べ替えた場合はその順）を選択する
+// 段階ごとの候補数・除外の理由を記録した選択の経過を返す 途中で候補がなくなった場合はそこまでの経過とエラーを返す
+func (p Pipeline) Run(sc SelectContext, tweets []TwitterTweet) (*TwitterTweet, SelectTrace, error) {
+	trace := SelectTrace{Account: sc.Account.TwitterID, At: sc.Now, Candidates: len(tweets)}
+	// why: 並べ替える段階が呼び出し元のスライスを変更しない
+	candidates := append([]TwitterTweet(nil), tweets...)
+
+	trace.Stages = make([]StageReport, 0, len(p.stages))
+	for i, s := range p.stages {
+		in := append([]TwitterTweet(nil), candidates...)
+		report := StageReport{Stage: p.names[i], In: len(in)}
+		out, err := s.Apply(sc, candidates)
+		if err == nil && len(out) == 0 {
+			err = errors.New("no tweet left")
+		}
+		if err != nil {
+			out = nil
+		}
+		report.Out = len(out)
+		report.Removed = report.In - report.Out
+		report.Dropped = dropped(sc, p.names[i], s, in, out)
+		if err != nil {
+			report.Error = err.Error()
+			trace.Stages = append(trace.Stages, report)
+			err = fmt.Errorf("stage %s: %w", p.names[i], err)
+			trace.Error = err.Error()
+			return nil, trace, err
+		}
+		trace.Stages = append(trace.Stages, report)
+		candidates = out
+	}
+
+	if len(candidates) == 0 {
+		err := errors.New("no tweet at select one")
+		trace.Error = err.Error()
+		return nil, trace, err
+	}
+	trace.Selected = candidates[0].Index
+	return &candidates[0], trace, nil
+}
+
+// dropped inのうちoutに残らなかったTweetと理由
+// TweetはIndexで照合する
+func dropped(sc SelectContext, name string, s Stage, in, out []TwitterTweet) []DroppedTweet {
+	kept := make(map[int]int, len(out))
+	for _, t := range out {
+		kept[t.Index]++
+	}
+
+	var drops []DroppedTweet
+	for _, t := range in {
+		if kept[t.Index] > 0 {
+			kept[t.Index]--
+			continue
+		}
+		reason := "dropped by " + name
+		if e, ok := s.(Explainer); ok {
+			reason = e.Explain(sc, t, out)
+		}
+		drops = append(drops, DroppedTweet{Index: t.Index, Reason: reason})
+	}
+	return drops
+}
@@ -0,0 +1,185 @@
+package subsets
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+func TestNewPipeline(t *testing.T) {
+	cases := []struct {
+		name      string
+		selection string
+		want      []string
+		wantErr   bool
+	}{
+		{"default", "", []string{"account", "ledger", "date", "checked", "priority", "count", "random"}, false},
+		{"custom", " Checked, count ,random", []string{"account", "ledger", "checked", "count", "random"}, false},
+		{"unknown stage", "checked,newest", nil, true},
+		{"empty stage", "checked,,random", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := NewPipeline(c.selection)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(p.Names(), c.want) {
+				t.Fatalf("got %v, want %v", p.Names(), c.want)
+			}
+		})
+	}
+}
+
+func TestPipelineRun(t *testing.T) {
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	tweets := []TwitterTweet{
+		{Index: 1, TwitterID: "user", Checked: 1, Priority: 1, Count: 0, LastDate: "2024/01/01 00:00:00"},
+		{Index: 2, TwitterID: "user", Checked: 1, Priority: 2, Count: 3, LastDate: "2024/01/01 00:00:00"},
+		{Index: 3, TwitterID: "user", Checked: 1, Priority: 2, Count: 1, LastDate: "2024/01/01 00:00:00"},
+		{Index: 4, TwitterID: "user", Checked: 0, Priority: 2, Count: 0, LastDate: "2024/01/01 00:00:00"},
+		{Index: 5, TwitterID: "other", Checked: 1, Priority: 2, Count: 0, LastDate: "2024/01/01 00:00:00"},
+	}
+
+	cases := []struct {
+		name      string
+		now       time.Time
+		selection string
+		want      int
+		removed   []int
+		wantErr   bool
+	}{
+		{"default", now, "", 3, []int{1, 0, 0, 1, 1, 1, 0}, false},
+		// 並び順で結果が変わる
+		{"count before priority", now, "checked,count,priority", 1, []int{1, 0, 1, 2, 0}, false},
+		// randomがなければ先頭
+		{"without random", now, "checked", 1, []int{1, 0, 1}, false},
+		{"no candidate", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "checked,date", 0, []int{1, 0, 1, 3}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := NewPipeline(c.selection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sc := SelectContext{Now: c.now, Rand: fakeRand{}, Account: TwitterAccount{TwitterID: "user", TermDays: 1}}
+			got, trace, err := p.Run(sc, tweets)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if got != nil && got.Index != c.want {
+				t.Fatalf("got %d, want %d", got.Index, c.want)
+			}
+			var removed []int
+			for _, r := range trace.Stages {
+				removed = append(removed, r.Removed)
+			}
+			if !reflect.DeepEqual(removed, c.removed) {
+				t.Fatalf("removed: %+v, want %v", trace.Stages, c.removed)
+			}
+		})
+	}
+}
+
+// TestExplainNoKept 段階がエラーを返し、残った候補がない場合も除外の理由を返すこと
+func TestExplainNoKept(t *testing.T) {
+	sc := SelectContext{Account: TwitterAccount{TwitterID: "user", TermDays: 1}}
+	tweet := TwitterTweet{Index: 1, TwitterID: "user", Priority: 1, Count: 2}
+	for _, c := range []struct {
+		stage, want string
+	}{
+		{"priority", "dropped by priority"},
+		{"count", "dropped by count"},
+	} {
+		s, ok := LookupStage(c.stage)
+		if !ok {
+			t.Fatalf("stage %s not registered", c.stage)
+		}
+		if got := dropped(sc, c.stage, s, []TwitterTweet{tweet}, nil); len(got) != 1 || got[0].Reason != c.want {
+			t.Fatalf("%s: got %+v, want %q", c.stage, got, c.want)
+		}
+	}
+}
+
+// TestRegisterStage 登録した選択段階をselectionで使用できること
+func TestRegisterStage(t *testing.T) {
+	RegisterStage("test_even", StageFunc(func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+		var out []TwitterTweet
+		for _, tweet := range tweets {
+			if tweet.Index%2 == 0 {
+				out = append(out, tweet)
+			}
+		}
+		return out, nil
+	}))
+
+	account := TwitterAccount{TwitterID: "user", Selection: "test_even,random"}
+	tweets := []TwitterTweet{{Index: 1, TwitterID: "user"}, {Index: 2, TwitterID: "user"}, {Index: 3, TwitterID: "user"}}
+	got, _, err := SelectTweet(time.Now(), libs.NewRand(1), account, libs.SheetRef{}, tweets, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Index != 2 {
+		t.Fatalf("got %d", got.Index)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("register twice must panic")
+		}
+	}()
+	RegisterStage("test_even", StageFunc(nil))
+}
+
+// TestSelectTweetTrace 段階ごとに除外したTweetと理由を記録すること
+func TestSelectTweetTrace(t *testing.T) {
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	account := TwitterAccount{TwitterID: "user", TermDays: 3, Selection: "date,checked,priority,random"}
+	tweets := []TwitterTweet{
+		{Index: 1, TwitterID: "other", Checked: 1, LastDate: "2024/01/01 00:00:00"},
+		{Index: 2, TwitterID: "user", Checked: 1, LastDate: "2024/01/01 00:00:00"},
+		{Index: 3, TwitterID: "user", Checked: 1, LastDate: ""},
+		{Index: 4, TwitterID: "user", Checked: 1, LastDate: "2024/02/09 09:00:00"},
+		{Index: 5, TwitterID: "user", Checked: 0, LastDate: "2024/01/01 00:00:00"},
+		{Index: 6, TwitterID: "user", Checked: 1, Priority: 1, LastDate: "2024/01/01 00:00:00"},
+		{Index: 7, TwitterID: "user", Checked: 1, Priority: 0, LastDate: "2024/01/01 00:00:00"},
+	}
+	history := []libs.LedgerEntry{{Event: libs.LedgerPosted, Account: "user", Index: 2, PostedAt: now.AddDate(0, 0, -1)}}
+
+	got, trace, err := SelectTweet(now, fakeRand{}, account, libs.SheetRef{}, tweets, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Index != 6 || trace.Selected != 6 || trace.Candidates != 7 || trace.Error != "" {
+		t.Fatalf("got: %+v, trace: %+v", got, trace)
+	}
+
+	want := map[string][]DroppedTweet{
+		"account":  {{1, "wrong account: other"}},
+		"ledger":   {{2, "posted too recently in ledger: 2024-02-09T00:00:00Z"}},
+		"date":     {{3, `unparseable last_date: ""`}, {4, "posted too recently: last_date 2024/02/09 09:00:00, term_days 3"}},
+		"checked":  {{5, "unchecked"}},
+		"priority": {{7, "lower priority: 0 < 1"}},
+		"random":   nil,
+	}
+	if len(trace.Stages) != len(want) {
+		t.Fatalf("stages: %+v", trace.Stages)
+	}
+	for _, s := range trace.Stages {
+		if !reflect.DeepEqual(s.Dropped, want[s.Stage]) || s.Removed != len(s.Dropped) {
+			t.Fatalf("%s: got %+v, want %+v", s.Stage, s.Dropped, want[s.Stage])
+		}
+	}
+
+	// 候補がなくなった段階で終了する
+	account.TermDays = 60
+	_, trace, err = SelectTweet(now, fakeRand{}, account, libs.SheetRef{}, tweets, history)
+	if err == nil || trace.Error == "" || trace.Selected != 0 {
+		t.Fatalf("err: %v, trace: %+v", err, trace)
+	}
+	last := trace.Stages[len(trace.Stages)-1]
+	if last.Stage != "date" || last.Out != 0 || len(last.Dropped) != 5 {
+		t.Fatalf("last stage: %+v", last)
+	}
+}
@@ -0,0 +1,246 @@
+package subsets
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+/*
+	Template 投稿の直前にTweetのtextを展開する
+	why: 同じTweetを繰り返し投稿すると、同一の本文として投稿を拒否されるため
+
+	書式
+	- {{name}}: 変数 TemplateVarsを参照
+	- {{pool:name}}: 設定のpoolsから1つをランダムに選択 例: {{pool:emoji}}
+	- {a|b|c}: いずれか1つをランダムに選択 入れ子にできる 例: {おはよう|こんにちは{!|。}}
+	- \{ \} \| \\: 記号そのもの
+	選択肢が1つの{a}は記号を含めてそのまま出力する
+	対応しない括弧（閉じていない{・{{、対応する{のない}）は記号そのものとして出力する
+*/
+
+// TemplateVars テンプレートで使用できる変数
+// 上記以外の変数は、Tweets listの他の列（列名）を参照する
+var TemplateVars = []string{"date", "time", "account", "account_name", "index", "count"}
+
+// TemplateData テンプレートの変数・poolの値
+type TemplateData struct {
+	// 投稿時刻 date・timeはアカウントのタイムゾーンで出力する
+	Now     time.Time
+	Account TwitterAccount
+	Tweet   TwitterTweet
+	// 名前ごとの候補 {{pool:name}}で使用する
+	Pools map[string][]string
+}
+
+// lookup 変数の値 pool・列がなければfalse
+func (d TemplateData) lookup(rnd libs.Rand, name string) (string, bool) {
+	if pool, ok := strings.CutPrefix(name, "pool:"); ok {
+		values := d.Pools[pool]
+		if len(values) == 0 {
+			return "", false
+		}
+		if rnd == nil {
+			return values[0], true
+		}
+		return values[rnd.Intn(len(values))], true
+	}
+
+	now := d.Now
+	if loc, err := d.Account.Location(); err == nil {
+		now = now.In(loc)
+	}
+	switch name {
+	case "date":
+		return now.Format("2006/01/02"), true
+	case "time":
+		return now.Format("15:04"), true
+	case "account":
+		return d.Account.TwitterID, true
+	case "account_name":
+		return d.Account.TwitterName, true
+	case "index":
+		return strconv.Itoa(d.Tweet.Index), true
+	case "count":
+		// 今回の投稿を含めた投稿回数
+		return strconv.Itoa(d.Tweet.Count + 1), true
+	}
+	v, ok := d.Tweet.Columns[name]
+	return v, ok
+}
+
+// templateNode 解析したテンプレートの要素
+// text・variable・choicesのいずれか
+type templateNode struct {
+	text     string
+	variable string
+	choices  [][]templateNode
+	// 選択肢が1つの{a}
+	literal bool
+}
+
+// parseTemplate テンプレートを解析する
+// 対応しない括弧（閉じていない{・{{、対応する{のない}）は記号そのものとして扱う
+// why: 顔文字など括弧を含む従来のtextを、そのまま投稿するため
+func parseTemplate(s string) []templateNode {
+	p := &templateParser{src: []rune(s), unclosed: make(map[int]bool)}
+	nodes, _ := p.parseSeq(false)
+	return nodes
+}
+
+type templateParser struct {
+	src []rune
+	pos int
+	// 閉じていない{の位置 why: 同じ{を繰り返し解析しないため
+	unclosed map[int]bool
+}
+
+// index fromからsubの位置 見つからなければ-1
+func (p *templateParser) index(sub string, from int) int {
+	subs := []rune(sub)
+	for i := from; i+len(subs) <= len(p.src); i++ {
+		if string(p.src[i:i+len(subs)]) == sub {
+			return i
+		}
+	}
+	return -1
+}
+
+// variable posから始まる{{name}}の名前と、}}の位置 変数でなければfalse
+func (p *templateParser) variable() (string, int, bool) {
+	if p.pos+1 >= len(p.src) || p.src[p.pos] != '{' || p.src[p.pos+1] != '{' {
+		return "", 0, false
+	}
+	end := p.index("}}", p.pos+2)
+	if end < 0 {
+		return "", 0, false
+	}
+	name := strings.TrimSpace(string(p.src[p.pos+2 : end]))
+	if name == "" || strings.ContainsAny(name, "{|") {
+		return "", 0, false
+	}
+	return name, end, true
+}
+
+// parseSeq 終端まで、またはinChoiceの場合は|・}まで解析する
+// 終端の記号を返す 入力の終わりは0
+func (p *templateParser) parseSeq(inChoice bool) ([]templateNode, rune) {
+	var nodes []templateNode
+	var text []rune
+	flush := func() {
+		if len(text) > 0 {
+			nodes = append(nodes, templateNode{text: string(text)})
+			text = nil
+		}
+	}
+
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if name, end, ok := p.variable(); ok {
+			flush()
+			nodes = append(nodes, templateNode{variable: name})
+			p.pos = end + 2
+			continue
+		}
+		switch {
+		case c == '\\' && p.pos+1 < len(p.src) && strings.ContainsRune(`{}|\`, p.src[p.pos+1]):
+			text = append(text, p.src[p.pos+1])
+			p.pos += 2
+		case c == '{' && !p.unclosed[p.pos]:
+			start := p.pos
+			p.pos++
+			var choices [][]templateNode
+			for {
+				choice, end := p.parseSeq(true)
+				if end == 0 {
+					// 閉じていない{は記号として、続きを解析し直す
+					p.unclosed[start] = true
+					p.pos = start
+					choices = nil
+					break
+				}
+				choices = append(choices, choice)
+				if end == '}' {
+					break
+				}
+			}
+			if choices == nil {
+				continue
+			}
+			flush()
+			nodes = append(nodes, templateNode{choices: choices, literal: len(choices) == 1})
+		case inChoice && (c == '|' || c == '}'):
+			p.pos++
+			flush()
+			return nodes, c
+		default:
+			// 閉じていない{・対応する{のない}を含む
+			text = append(text, c)
+			p.pos++
+		}
+	}
+	flush()
+	return nodes, 0
+}
+
+// RenderText テンプレートを展開する
+// 変数・poolが見つからない場合はエラー
+func RenderText(s string, data TemplateData, rnd libs.Rand) (string, error) {
+	nodes := parseTemplate(s)
+	var b strings.Builder
+	if err := renderNodes(&b, nodes, data, rnd); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func renderNodes(b *strings.Builder, nodes []templateNode, data TemplateData, rnd libs.Rand) error {
+	for _, n := range nodes {
+		switch {
+		case n.variable != "":
+			v, ok := data.lookup(rnd, n.variable)
+			if !ok {
+				return fmt.Errorf("unknown variable: {{%s}}", n.variable)
+			}
+			b.WriteString(v)
+		case n.literal:
+			b.WriteString("{")
+			if err := renderNodes(b, n.choices[0], data, rnd); err != nil {
+				return err
+			}
+			b.WriteString("}")
+		case n.choices != nil:
+			if err := renderNodes(b, n.choices[rnd.Intn(len(n.choices))], data, rnd); err != nil {
+				return err
+			}
+		default:
+			b.WriteString(n.text)
+		}
+	}
+	return nil
+}
+
+// ValidateTemplate 投稿前にテンプレートの誤りを確認する
+// 全ての選択肢の変数・poolが見つかるかを確認する
+func ValidateTemplate(s string, data TemplateData) error {
+	nodes := parseTemplate(s)
+	var errs []error
+	var walk func(nodes []templateNode)
+	walk = func(nodes []templateNode) {
+		for _, n := range nodes {
+			if n.variable != "" {
+				if _, ok := data.lookup(nil, n.variable); !ok {
+					errs = append(errs, fmt.Errorf("unknown variable: {{%s}}", n.variable))
+				}
+			}
+			for _, c := range n.choices {
+				walk(c)
+			}
+		}
+	}
+	walk(nodes)
+	return errors.Join(errs...)
+}
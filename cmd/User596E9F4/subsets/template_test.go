@@ -0,0 +1,86 @@
+package subsets
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTemplateData() TemplateData {
+	return TemplateData{
+		// 2024/02/01 09:30 JST
+		Now:     time.Date(2024, 2, 1, 0, 30, 0, 0, time.UTC),
+		Account: TwitterAccount{TwitterID: "user", TwitterName: "ユーザー", Timezone: "Asia/Tokyo"},
+		Tweet:   TwitterTweet{Index: 3, Count: 4, Columns: map[string]string{"campaign": "春のセール"}},
+		Pools:   map[string][]string{"emoji": {"🌸", "☀️"}},
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	cases := []struct {
+		name    string
+		text    string
+		rnd     fakeRand
+		want    string
+		wantErr bool
+	}{
+		{"plain", "hello", fakeRand{}, "hello", false},
+		{"variables", "{{date}} {{time}} @{{account}} {{account_name}} #{{index}} {{count}}回目", fakeRand{}, "2024/02/01 09:30 @user ユーザー #3 5回目", false},
+		{"custom column", "{{ campaign }}開催中", fakeRand{}, "春のセール開催中", false},
+		{"spintax first", "{おはよう|こんにちは}", fakeRand{n: 0}, "おはよう", false},
+		{"spintax last", "{おはよう|こんにちは}", fakeRand{n: 1}, "こんにちは", false},
+		{"nested spintax", "{a|b{c|d}}!", fakeRand{n: 1}, "bd!", false},
+		{"empty choice", "x{|y}", fakeRand{n: 0}, "x", false},
+		{"pool", "{{pool:emoji}}", fakeRand{n: 1}, "☀️", false},
+		{"single choice is literal", "{note}", fakeRand{}, "{note}", false},
+		{"escape", `\{a\|b\} \\`, fakeRand{}, `{a|b} \`, false},
+		{"unknown variable", "{{unknown}}", fakeRand{}, "", true},
+		{"unknown pool", "{{pool:hashtag}}", fakeRand{}, "", true},
+		// 対応しない括弧は記号そのもの
+		{"unclosed variable", "{{date", fakeRand{}, "{{date", false},
+		{"unclosed spintax", "{a|b", fakeRand{}, "{a|b", false},
+		{"unexpected close", "a}", fakeRand{}, "a}", false},
+		{"emoticon", "ありがとう(^^)/} {{date}}", fakeRand{}, "ありがとう(^^)/} 2024/02/01", false},
+		{"unclosed before spintax", "{ {a|b}", fakeRand{n: 1}, "{ b", false},
+		{"spintax in unclosed", "{a{b|c}", fakeRand{n: 1}, "{ac", false},
+		{"many unclosed", strings.Repeat("{", 40) + "a", fakeRand{}, strings.Repeat("{", 40) + "a", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := RenderText(c.text, testTemplateData(), c.rnd)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"valid", "{{date}} {a|{{pool:emoji}}}", nil},
+		// 選択されない選択肢も確認する
+		{"unknown in choices", "{a|{{unknown}}|{{pool:hashtag}}}", []string{"{{unknown}}", "{{pool:hashtag}}"}},
+		// 対応しない括弧は誤りとしない
+		{"lone brace", "{a|b} }{", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateTemplate(c.text, testTemplateData())
+			if (err != nil) != (c.want != nil) {
+				t.Fatalf("err: %v", err)
+			}
+			for _, want := range c.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("err must contain %q: %v", want, err)
+				}
+			}
+		})
+	}
+}
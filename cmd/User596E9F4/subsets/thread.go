@@ -0,0 +1,165 @@
+package subsets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"tweet-with-spread/libs"
+	"tweet-with-spread/libs/twittertext"
+
+	"github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/rs/zerolog/log"
+)
+
+// Channel Tweetの投稿方法
+// modeと展開後のtextの重み付き文字数（limitを超えるか）で決める 文字数はXの数え方（日本語2・英数字1・URL 23）
+// ‐ 空・auto: 超える場合はGUI、以下はAPI
+// ‐ thread: 超える場合はスレッド、以下はAPI
+// ‐ gui: 常にGUI
+func (p TwitterTweet) Channel(text string, limit int) (string, error) {
+	long := twittertext.WeightedLength(text) > limit
+	switch strings.ToLower(strings.TrimSpace(p.Mode)) {
+	case "", "auto":
+		if long {
+			return libs.ChannelGUI, nil
+		}
+		return libs.ChannelAPI, nil
+	case "thread":
+		if long {
+			return libs.ChannelThread, nil
+		}
+		return libs.ChannelAPI, nil
+	case "gui":
+		return libs.ChannelGUI, nil
+	}
+	return "", fmt.Errorf("invalid mode %q, must be one of auto,thread,gui", p.Mode)
+}
+
+// SplitThread textを重み付き文字数limit以内のスレッドの各Tweetに分割する
+// 文（。！？!?、空白が続く.）・改行の区切りでまとめ、1文がlimitを超える場合はlimit以内で分割する
+func SplitThread(text string, limit int) []string {
+	if limit <= 0 || twittertext.WeightedLength(text) <= limit {
+		return []string{text}
+	}
+
+	var parts []string
+	var cur []rune
+	flush := func() {
+		if s := strings.TrimSpace(string(cur)); s != "" {
+			parts = append(parts, s)
+		}
+		cur = nil
+	}
+	for _, seg := range splitSentences(text) {
+		for twittertext.WeightedLength(string(seg)) > limit {
+			flush()
+			n := fitLength(seg, limit)
+			cur = seg[:n]
+			flush()
+			seg = seg[n:]
+		}
+		if twittertext.WeightedLength(string(cur)+string(seg)) > limit {
+			flush()
+		}
+		cur = append(cur, seg...)
+	}
+	flush()
+	return parts
+}
+
+// fitLength 重み付き文字数がlimit以内となるrsの先頭の文字数 少なくとも1
+func fitLength(rs []rune, limit int) int {
+	n := 1
+	for n < len(rs) && twittertext.WeightedLength(string(rs[:n+1])) <= limit {
+		n++
+	}
+	return n
+}
+
+// splitSentences 文・改行の区切りで分割する 区切りの記号は前の文に含める
+func splitSentences(text string) [][]rune {
+	rs := []rune(text)
+	var segs [][]rune
+	start := 0
+	for i, c := range rs {
+		end := false
+		switch c {
+		case '\n', '。', '！', '？', '!', '?':
+			end = true
+		case '.':
+			end = i+1 == len(rs) || rs[i+1] == ' ' || rs[i+1] == '\n'
+		}
+		if end {
+			segs = append(segs, rs[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(rs) {
+		segs = append(segs, rs[start:])
+	}
+	return segs
+}
+
+// DistributeFiles filesをn個のTweetに順に振り分ける
+// ファイルがTweetより少ない場合は先頭から1つずつ、多い場合は均等に添付する
+func DistributeFiles(files []string, n int) [][]string {
+	dist := make([][]string, n)
+	if n == 0 {
+		return dist
+	}
+	for i, f := range files {
+		j := i * n / len(files)
+		dist[j] = append(dist[j], f)
+	}
+	return dist
+}
+
+// NewCreateThreadInputs スレッドの各TweetのAPI投稿リクエストを作成する
+// 返信先・引用・投票は先頭のTweet、返信の制限は全てのTweetに設定する
+// 2件目以降の返信先（前のTweetのID）は投稿時に決まるため含まない
+func NewCreateThreadInputs(tweet *TwitterTweet, parts []string, mediaIDs [][]string) []*types.CreateInput {
+	reqs := make([]*types.CreateInput, len(parts))
+	for i := range parts {
+		var ids []string
+		if i < len(mediaIDs) {
+			ids = mediaIDs[i]
+		}
+		part := TwitterTweet{Text: parts[i], ReplySettings: tweet.ReplySettings}
+		if i == 0 {
+			part.ReplyTo, part.Quote = tweet.ReplyTo, tweet.Quote
+			part.PollOption, part.PollDuration = tweet.PollOption, tweet.PollDuration
+		}
+		reqs[i] = NewCreateTweetInput(&part, ids)
+	}
+	return reqs
+}
+
+// RequestCreateThread スレッドのAPI投稿リクエストを作成する
+// textを分割し、filesを各Tweetに振り分けてアップロードする
+func RequestCreateThread(ctx context.Context, account TwitterAccount, tweet *TwitterTweet, limit int, files []string) ([]*types.CreateInput, error) {
+	// アップロードの前に確認する
+	if err := tweet.ValidateOptions(libs.ChannelThread); err != nil {
+		return nil, err
+	}
+	parts := SplitThread(tweet.Text, limit)
+	dist := DistributeFiles(files, len(parts))
+
+	mediaIDs := make([][]string, len(parts))
+	for i, partFiles := range dist {
+		if len(partFiles) == 0 {
+			continue
+		}
+		mediaIDs[i] = libs.TweetUpload(ctx, account, partFiles)
+		// メディアアップロードに失敗した場合は、画像なしで投稿するか判断
+		if len(partFiles) != len(mediaIDs[i]) {
+			log.Error().Err(fmt.Errorf("files: %v -> media_ids: %v", partFiles, mediaIDs[i])).Str("function", "RequestCreateThread").Msgf("failed to upload media, %s", account.TwitterID)
+			if tweet.WithFiles == 1 {
+				return nil, fmt.Errorf("failed to upload media, %s", account.TwitterID)
+			}
+		}
+	}
+
+	reqs := NewCreateThreadInputs(tweet, parts, mediaIDs)
+	log.Debug().Str("function", "RequestCreateThread").Msgf("thread request: %d tweets", len(reqs))
+	return reqs, nil
+}
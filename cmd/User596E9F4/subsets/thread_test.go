@@ -0,0 +1,96 @@
+package subsets
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"tweet-with-spread/libs"
+	"tweet-with-spread/libs/twittertext"
+)
+
+func TestTweetChannel(t *testing.T) {
+	cases := []struct {
+		mode    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"", "short", libs.ChannelAPI, false},
+		{"", "long text", libs.ChannelGUI, false},
+		// 日本語は2文字として数える
+		{"", "あいう", libs.ChannelGUI, false},
+		{"auto", "long text", libs.ChannelGUI, false},
+		{"thread", "short", libs.ChannelAPI, false},
+		{"Thread", "long text", libs.ChannelThread, false},
+		{"gui", "short", libs.ChannelGUI, false},
+		{"poll", "short", "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.mode+"/"+c.text, func(t *testing.T) {
+			got, err := TwitterTweet{Mode: c.mode}.Channel(c.text, 5)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSplitThread(t *testing.T) {
+	cases := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short", "こんにちは。", 12, []string{"こんにちは。"}},
+		{"sentences", "一文目です。二文目です。三文目です。", 24, []string{"一文目です。二文目です。", "三文目です。"}},
+		{"lines", "line one\nline two\nline three", 18, []string{"line one\nline two", "line three"}},
+		{"english", "First one. Second one. Third.", 12, []string{"First one.", "Second one.", "Third."}},
+		// URLは23文字として数える
+		{"url", "Link: https://example.com/a/very/long/path/to/the/page. Next sentence.", 40, []string{"Link: https://example.com/a/very/long/path/to/the/page.", "Next sentence."}},
+		{"long sentence", "あいうえおかきくけこさしすせそ", 12, []string{"あいうえおか", "きくけこさし", "すせそ"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := SplitThread(c.text, c.limit)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+			for _, part := range got {
+				if twittertext.WeightedLength(part) > c.limit {
+					t.Fatalf("part over limit: %q", part)
+				}
+			}
+		})
+	}
+
+	// 区切りの文字以外は失わない
+	text := strings.Repeat("長い文章が続きます、", 30) + "。終わり。"
+	if got := strings.Join(SplitThread(text, 280), ""); got != text {
+		t.Fatalf("lost text: %q", got)
+	}
+}
+
+func TestDistributeFiles(t *testing.T) {
+	cases := []struct {
+		name  string
+		files []string
+		n     int
+		want  [][]string
+	}{
+		{"no files", nil, 2, [][]string{nil, nil}},
+		{"fewer files", []string{"a", "b"}, 3, [][]string{{"a"}, {"b"}, nil}},
+		{"more files", []string{"a", "b", "c", "d"}, 2, [][]string{{"a", "b"}, {"c", "d"}}},
+		{"uneven", []string{"a", "b", "c"}, 2, [][]string{{"a", "b"}, {"c"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := DistributeFiles(c.files, c.n); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
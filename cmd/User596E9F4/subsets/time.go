@@ -1,12 +1,18 @@
 package subsets
 
 import (
-	"math/rand"
+	"context"
 	"time"
+	"tweet-with-spread/libs"
 )
 
 // Wait は、指定秒を最大に、0~maxsec秒待機します。
-func Wait(maxSec int) {
-	waitMillisec := rand.Intn(maxSec * 1000)
-	time.Sleep(time.Duration(waitMillisec) * time.Millisecond)
+// 待機時間はrndで決め、clockで待機します。
+// ctxが終了した場合は待機を中断し、ctxのエラーを返します。
+func Wait(ctx context.Context, clock libs.Clock, rnd libs.Rand, maxSec int) error {
+	if maxSec <= 0 {
+		return ctx.Err()
+	}
+	waitMillisec := rnd.Intn(maxSec * 1000)
+	return clock.Sleep(ctx, time.Duration(waitMillisec)*time.Millisecond)
 }
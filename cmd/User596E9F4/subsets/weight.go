@@ -0,0 +1,132 @@
+package subsets
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"tweet-with-spread/libs"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DEFAULTWEIGHT アカウントのweightが空の場合の重みの式 priorityに比例する
+	DEFAULTWEIGHT string = "priority=1"
+)
+
+// Weight weighted段階の重みの式
+// 重み = Priority*priority + Count*count + Age*最後の投稿からの経過日数 負の場合は0
+// 例: "priority=1,count=-0.5,age=0.1" -> 優先度が高く、投稿回数が少なく、最後の投稿から日数が経過したTweetほど選択されやすい
+type Weight struct {
+	Priority float64
+	Count    float64
+	Age      float64
+}
+
+// ParseWeight 重みの式 "<項目>=<係数>"のカンマ区切り 指定のない項目の係数は0
+// 空の場合はDEFAULTWEIGHT
+func ParseWeight(s string) (Weight, error) {
+	if strings.TrimSpace(s) == "" {
+		s = DEFAULTWEIGHT
+	}
+
+	var w Weight
+	for _, term := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok {
+			return Weight{}, fmt.Errorf("invalid weight %q: %q must be <name>=<coefficient>", s, term)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return Weight{}, fmt.Errorf("invalid weight %q: %w", s, err)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "priority":
+			w.Priority = f
+		case "count":
+			w.Count = f
+		case "age":
+			w.Age = f
+		default:
+			return Weight{}, fmt.Errorf("invalid weight %q: unknown name %q, must be one of priority,count,age", s, key)
+		}
+	}
+	return w, nil
+}
+
+// Of nowにおけるtweetの重み
+// last_dateが不正な場合（未投稿で空など）は経過日数を0とする
+func (w Weight) Of(now time.Time, tweet TwitterTweet) float64 {
+	var age float64
+	if w.Age != 0 {
+		if t, err := AdjustDate(tweet.LastDate); err == nil {
+			age = now.Sub(t).Hours() / 24
+		} else {
+			log.Debug().Str("function", "Weight.Of").Msgf("no last date for age, index: %d", tweet.Index)
+		}
+	}
+
+	v := w.Priority*float64(tweet.Priority) + w.Count*float64(tweet.Count) + w.Age*age
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// TweetsByWeight 重みに比例した確率でTweetを一つ選択する
+// why: SortByPriorityでは最大のpriorityのTweetが残る限り、低いpriorityのTweetを投稿しない
+// 全ての重みが0の場合は同じ確率で選択する
+func TweetsByWeight(now time.Time, rnd libs.Rand, w Weight, tweets []TwitterTweet) ([]TwitterTweet, error) {
+	isThere, l, err := Exist(tweets)
+	if err != nil || !isThere {
+		return nil, err
+	} else if l == 1 { // 選別の必要がない場合
+		return tweets, nil
+	}
+
+	weights := make([]float64, l)
+	var total float64
+	for i := range tweets {
+		weights[i] = w.Of(now, tweets[i])
+		total += weights[i]
+	}
+	if total == 0 {
+		return []TwitterTweet{tweets[rnd.Intn(l)]}, nil
+	}
+
+	x := rnd.Float64() * total
+	for i := range tweets {
+		x -= weights[i]
+		if x < 0 {
+			return []TwitterTweet{tweets[i]}, nil
+		}
+	}
+	// 浮動小数の誤差で残った場合は重みが正の最後のTweet
+	for i := l - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return []TwitterTweet{tweets[i]}, nil
+		}
+	}
+	return nil, errors.New("no tweet at select by weight")
+}
+
+func init() {
+	RegisterStage("weighted", explainedStage{
+		func(sc SelectContext, tweets []TwitterTweet) ([]TwitterTweet, error) {
+			w, err := ParseWeight(sc.Account.Weight)
+			if err != nil {
+				return nil, err
+			}
+			return TweetsByWeight(sc.Now, sc.Rand, w, tweets)
+		},
+		func(sc SelectContext, tweet TwitterTweet, kept []TwitterTweet) string {
+			w, err := ParseWeight(sc.Account.Weight)
+			if err != nil {
+				return err.Error()
+			}
+			return fmt.Sprintf("not drawn, weight: %g", w.Of(sc.Now, tweet))
+		},
+	})
+}
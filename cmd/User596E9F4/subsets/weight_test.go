@@ -0,0 +1,145 @@
+package subsets
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+func TestParseWeight(t *testing.T) {
+	cases := []struct {
+		name    string
+		s       string
+		want    Weight
+		wantErr bool
+	}{
+		{"default", "", Weight{Priority: 1}, false},
+		{"formula", "priority=2, count=-0.5,AGE=0.1", Weight{Priority: 2, Count: -0.5, Age: 0.1}, false},
+		{"no coefficient", "priority", Weight{}, true},
+		{"invalid coefficient", "priority=high", Weight{}, true},
+		{"unknown name", "likes=1", Weight{}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseWeight(c.s)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Fatalf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestWeightOf(t *testing.T) {
+	// 2024/02/01 09:00:00 JST = 2024/02/01 00:00:00 UTC
+	now := time.Date(2024, 2, 11, 0, 0, 0, 0, time.UTC)
+	tweet := TwitterTweet{Priority: 3, Count: 4, LastDate: "2024/02/01 09:00:00"}
+	cases := []struct {
+		name  string
+		w     Weight
+		tweet TwitterTweet
+		want  float64
+	}{
+		{"priority", Weight{Priority: 1}, tweet, 3},
+		{"formula", Weight{Priority: 1, Count: -0.5, Age: 0.1}, tweet, 3 - 2 + 1},
+		{"negative is zero", Weight{Count: -1}, tweet, 0},
+		{"no last date", Weight{Age: 1}, TwitterTweet{}, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.w.Of(now, c.tweet); math.Abs(got-c.want) > 1e-9 {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestTweetsByWeight(t *testing.T) {
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	tweets := []TwitterTweet{{Index: 1, Priority: 1}, {Index: 2, Priority: 0}, {Index: 3, Priority: 3}}
+	cases := []struct {
+		name    string
+		rnd     libs.Rand
+		tweets  []TwitterTweet
+		want    []int
+		wantErr bool
+	}{
+		{"empty", fakeRand{}, nil, nil, true},
+		{"one", fakeRand{}, tweets[:1], []int{1}, false},
+		// 累積の重み 1, 1, 4 の区間で選択する
+		{"lowest point", fakeRand{f: 0}, tweets, []int{1}, false},
+		{"zero weight is skipped", fakeRand{f: 0.25}, tweets, []int{3}, false},
+		{"highest point", fakeRand{f: 0.999}, tweets, []int{3}, false},
+		{"all zero", fakeRand{n: 1}, []TwitterTweet{{Index: 1}, {Index: 2}}, []int{2}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := TweetsByWeight(now, c.rnd, Weight{Priority: 1}, c.tweets)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if !reflect.DeepEqual(indexes(got), c.want) {
+				t.Fatalf("got %v, want %v", indexes(got), c.want)
+			}
+		})
+	}
+}
+
+// TestTweetsByWeightSeed seedを指定すると再現でき、priorityに比例した割合で選択すること
+func TestTweetsByWeightSeed(t *testing.T) {
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	tweets := []TwitterTweet{{Index: 1, Priority: 1}, {Index: 2, Priority: 3}}
+
+	draw := func(seed int64) []int {
+		rnd := libs.NewRand(seed)
+		counts := make([]int, 2)
+		for i := 0; i < 4000; i++ {
+			got, err := TweetsByWeight(now, rnd, Weight{Priority: 1}, tweets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts[got[0].Index-1]++
+		}
+		return counts
+	}
+
+	a, b := draw(1), draw(1)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("same seed must draw same tweets: %v, %v", a, b)
+	}
+	// 期待値 1000, 3000
+	if a[0] < 850 || a[0] > 1150 {
+		t.Fatalf("lower priority must be drawn in proportion: %v", a)
+	}
+}
+
+// TestSelectTweetWeighted selectionでweightedを指定すると最大でないpriorityのTweetも選択すること
+func TestSelectTweetWeighted(t *testing.T) {
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	tweets := []TwitterTweet{
+		{Index: 1, TwitterID: "user", Checked: 1, Priority: 1, LastDate: "2024/01/01 00:00:00"},
+		{Index: 2, TwitterID: "user", Checked: 1, Priority: 9, LastDate: "2024/01/01 00:00:00"},
+	}
+	for _, c := range []struct {
+		selection string
+		f         float64
+		want      int
+	}{
+		{"checked,priority,random", 0, 2},
+		{"checked,weighted", 0.05, 1},
+		{"checked,weighted", 0.5, 2},
+	} {
+		account := TwitterAccount{TwitterID: "user", Selection: c.selection}
+		got, _, err := SelectTweet(now, fakeRand{f: c.f}, account, libs.SheetRef{}, tweets, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Index != c.want {
+			t.Fatalf("%s, %v: got %d, want %d", c.selection, c.f, got.Index, c.want)
+		}
+	}
+}
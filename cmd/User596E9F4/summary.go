@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sync"
+	"time"
+	"tweet-with-spread/cmd/User596E9F4/subsets"
+)
+
+const (
+	// PostPosted 投稿した
+	PostPosted = "posted"
+	// PostFailed 投稿しなかった（エラー）
+	PostFailed = "failed"
+	// PostSkipped 投稿しなかった（停止・開始期限切れ）
+	PostSkipped = "skipped"
+	// PostPlanned dry runで投稿予定を作成した
+	PostPlanned = "planned"
+
+	// WriteBackSynced 投稿結果をSpreadsheetに書き込んだ
+	WriteBackSynced = "synced"
+	// WriteBackQueued 投稿結果の書き込みに失敗し、書き込み待ちに追加した
+	WriteBackQueued = "queued"
+)
+
+// PostResult アカウントごとの投稿結果
+type PostResult struct {
+	Account   string `json:"account"`
+	Status    string `json:"status"`
+	Index     int    `json:"index,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	TweetURL  string `json:"tweet_url,omitempty"`
+	WriteBack string `json:"write_back,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// dry runでの投稿予定
+	Plan *PostPlan `json:"plan,omitempty"`
+	// Tweetを選択できなかった場合の選択の経過
+	Trace *subsets.SelectTrace `json:"trace,omitempty"`
+}
+
+func (p PostResult) fail(err error) PostResult {
+	p.Status = PostFailed
+	p.Error = err.Error()
+	return p
+}
+
+func (p PostResult) skip(err error) PostResult {
+	p.Status = PostSkipped
+	p.Error = err.Error()
+	return p
+}
+
+// ExecSummary Executor 1回分の実行結果
+type ExecSummary struct {
+	Tenant   string       `json:"tenant,omitempty"`
+	DryRun   bool         `json:"dry_run,omitempty"`
+	At       time.Time    `json:"at"`
+	Selected []string     `json:"selected"`
+	Results  []PostResult `json:"results"`
+	Posted   int          `json:"posted"`
+	Failed   int          `json:"failed"`
+	Skipped  int          `json:"skipped"`
+	Planned  int          `json:"planned,omitempty"`
+	// アカウントの選択前に失敗した場合のエラー
+	Error string `json:"error,omitempty"`
+}
+
+// summaryCollector 並列に実行した投稿結果を集める
+type summaryCollector struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	results []PostResult
+}
+
+func (c *summaryCollector) add(p PostResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = append(c.results, p)
+}
+
+// wait すべての投稿結果を待ち、集計する
+func (c *summaryCollector) wait(s *ExecSummary) {
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.Results = append(s.Results, c.results...)
+	for _, p := range c.results {
+		switch p.Status {
+		case PostPosted:
+			s.Posted++
+		case PostFailed:
+			s.Failed++
+		case PostSkipped:
+			s.Skipped++
+		case PostPlanned:
+			s.Planned++
+		}
+	}
+}
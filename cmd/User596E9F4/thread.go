@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"tweet-with-spread/libs"
+
+	mtypes "github.com/michimani/gotwi/tweet/managetweet/types"
+)
+
+// postThread スレッドの各Tweetを前のTweetへの返信として順に投稿し、投稿したTweetのIDを返す
+// 途中で失敗した場合は投稿済みのTweetを削除し、エラーを返す
+// why: 途中までのスレッドを残さず、次回に同じTweetを最初から投稿できるようにするため
+// 投稿・削除のリクエストは停止の指示で中断しない
+func (r *Runner) postThread(ctx context.Context, account libs.Box, reqs []*mtypes.CreateInput) ([]string, error) {
+	ctx = context.WithoutCancel(ctx)
+	ids := make([]string, 0, len(reqs))
+	for i, req := range reqs {
+		if i > 0 {
+			req.Reply = &mtypes.CreateInputReply{InReplyToTweetID: ids[i-1]}
+		}
+		res, err := r.Twitter.Tweeting(ctx, account, req)
+		if err == nil && (res == nil || res.Data.ID == nil) {
+			err = fmt.Errorf("no tweet id in response")
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to post thread %d/%d: %w", i+1, len(reqs), err)
+			if left := r.rollbackThread(ctx, account, ids); len(left) > 0 {
+				return nil, fmt.Errorf("%w, failed to delete posted tweets: %v", err, left)
+			}
+			return nil, err
+		}
+		ids = append(ids, *res.Data.ID)
+	}
+	return ids, nil
+}
+
+// rollbackThread 投稿済みのスレッドを後ろから削除し、削除できなかったTweetのIDを返す
+func (r *Runner) rollbackThread(ctx context.Context, account libs.Box, ids []string) []string {
+	var left []string
+	for i := len(ids) - 1; i >= 0; i-- {
+		if err := r.Twitter.Delete(ctx, account, ids[i]); err != nil {
+			r.logger().Error().Err(err).Str("function", "rollbackThread").Msgf("failed to delete thread tweet: %s", libs.ID2TwitterURL(ids[i]))
+			left = append(left, ids[i])
+			continue
+		}
+		r.logger().Info().Str("function", "rollbackThread").Msgf("deleted thread tweet: %s", ids[i])
+	}
+	return left
+}
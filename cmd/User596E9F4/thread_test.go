@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+// threadTweetsRows modeがthreadで、tweet_count_jaを超えるTweet
+func threadTweetsRows(text string) [][]string {
+	return [][]string{
+		{"index", "twitter_id", "text", "checked", "count", "tweet_url", "last_date", "mode"},
+		{"1", "user", text, "1", "0", "", "2024/01/01 00:00:00", "thread"},
+	}
+}
+
+// TestExecutorThread 長文を返信の連鎖で投稿し、全てのTweetのIDを記録すること
+func TestExecutorThread(t *testing.T) {
+	poster := &fakePoster{}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, poster, at)
+	r.Config.TweetCountJA = 10
+	store.SetSheet("admin", r.Config.Sheets.Tweets, threadTweetsRows("一文目です。二文目です。三文目です。"))
+
+	summary := r.Executor(context.Background(), at)
+	if summary.Posted != 1 || summary.Results[0].Channel != libs.ChannelThread {
+		t.Fatalf("summary: %+v", summary)
+	}
+	if want := []string{"一文目です。", "二文目です。", "三文目です。"}; strings.Join(poster.texts, ",") != strings.Join(want, ",") {
+		t.Fatalf("posted: %v", poster.texts)
+	}
+	if poster.reqs[0].Reply != nil || poster.reqs[1].Reply.InReplyToTweetID != "1" || poster.reqs[2].Reply.InReplyToTweetID != "2" {
+		t.Fatalf("thread must reply to previous tweet: %+v", poster.reqs)
+	}
+
+	entries, err := r.Ledger.Entries()
+	if err != nil || len(entries) == 0 {
+		t.Fatal(err)
+	}
+	if e := entries[0]; e.TweetID != "1" || strings.Join(e.ThreadIDs, ",") != "1,2,3" || e.Channel != libs.ChannelThread {
+		t.Fatalf("ledger: %+v", e)
+	}
+	// 書き込むTweetURLはスレッドの先頭
+	if row := store.Sheet("admin", r.Config.Sheets.Tweets)[1]; row[5] != libs.ID2TwitterURL("1") {
+		t.Fatalf("write back: %v", row)
+	}
+}
+
+// TestExecutorThreadRollback 途中で失敗した場合は投稿済みのTweetを削除し、投稿として記録しないこと
+func TestExecutorThreadRollback(t *testing.T) {
+	poster := &fakePoster{failOn: 3}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, poster, at)
+	r.Config.TweetCountJA = 10
+	rows := threadTweetsRows("一文目です。二文目です。三文目です。")
+	store.SetSheet("admin", r.Config.Sheets.Tweets, rows)
+
+	summary := r.Executor(context.Background(), at)
+	if summary.Failed != 1 || !strings.Contains(summary.Results[0].Error, "3/3") {
+		t.Fatalf("summary: %+v", summary)
+	}
+	if strings.Join(poster.deleted, ",") != "2,1" {
+		t.Fatalf("deleted: %v", poster.deleted)
+	}
+	if entries, err := r.Ledger.Entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("ledger: %+v, %v", entries, err)
+	}
+	if row := store.Sheet("admin", r.Config.Sheets.Tweets)[1]; row[4] != "0" || row[5] != "" {
+		t.Fatalf("write back: %v", row)
+	}
+}
+
+// TestExecutorThreadDryRun dry runでは分割した各Tweetを投稿予定に含めること
+func TestExecutorThreadDryRun(t *testing.T) {
+	poster := &fakePoster{}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, poster, at)
+	r.Config.TweetCountJA = 10
+	r.Config.DryRun = true
+	store.SetSheet("admin", r.Config.Sheets.Tweets, threadTweetsRows("一文目です。二文目です。"))
+
+	summary := r.Executor(context.Background(), at)
+	if summary.Planned != 1 || len(poster.texts) != 0 {
+		t.Fatalf("summary: %+v, posted: %v", summary, poster.texts)
+	}
+	plan := summary.Results[0].Plan
+	if plan == nil || len(plan.Thread) != 2 || plan.Thread[1].Text != "二文目です。" {
+		t.Fatalf("plan: %+v", plan)
+	}
+}
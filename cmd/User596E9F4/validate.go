@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+	"tweet-with-spread/cmd/User596E9F4/subsets"
+	"tweet-with-spread/libs"
+	"tweet-with-spread/libs/twittertext"
+
+	"github.com/go-gota/gota/dataframe"
+)
+
+// SheetIssue Twitter account list・Tweets listの設定の誤り
+type SheetIssue struct {
+	Account string `json:"account"`
+	// Tweetの行の誤りの場合のindex アカウントの列の誤りの場合は0
+	Index int    `json:"index,omitempty"`
+	Sheet string `json:"sheet,omitempty"`
+	Error string `json:"error"`
+	// 投稿はできるが確認が必要な場合 validateの失敗としない
+	Warning bool `json:"warning,omitempty"`
+}
+
+// validateCommand validateモード テナントごとにSheetの設定の誤りを確認し、行ごとに出力する
+// 投稿時に失敗する前に、textのテンプレート・mode・返信・引用・投票・削除の列・selection・weightの誤りと文字数を確認する
+// 誤りがあればエラーを返す 警告のみの場合は成功とする
+//
+//	./User596E9F4 validate -account user
+func validateCommand(runners []*Runner, args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		account = fs.String("account", "", "確認するアカウント（twitter_id） 指定がなければすべて")
+		tenant  = fs.String("tenant", "", "確認するテナント 指定がなければすべて")
+		asJSON  = fs.Bool("json", false, "JSONで出力する")
+	)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	found, total := false, 0
+	for _, r := range runners {
+		if *tenant != "" && r.Tenant != *tenant {
+			continue
+		}
+		found = true
+
+		issues, err := r.ValidateSheets(time.Now(), *account)
+		if err != nil {
+			return libs.SetError(err, "failed to validate "+r.Tenant)
+		}
+		for _, i := range issues {
+			if !i.Warning {
+				total++
+			}
+		}
+		if *asJSON {
+			writeReport(struct {
+				Tenant string       `json:"tenant,omitempty"`
+				Issues []SheetIssue `json:"issues"`
+			}{r.Tenant, issues})
+			continue
+		}
+		writeIssues(os.Stdout, r.Tenant, issues)
+	}
+	if !found {
+		return fmt.Errorf("unknown tenant: %s", *tenant)
+	}
+	if total > 0 {
+		return fmt.Errorf("%d issues found", total)
+	}
+	return nil
+}
+
+// ValidateSheets アカウントのselection・weightと、アカウントのTweetsのtextのテンプレート・mode・文字数・返信・引用・投票・削除の列を確認する
+// テンプレートの変数はatを投稿時刻として確認する
+// accountの指定があれば、そのアカウントのみを確認する
+func (r *Runner) ValidateSheets(at time.Time, account string) ([]SheetIssue, error) {
+	accounts, err := r.loadAccounts()
+	if err != nil {
+		return nil, libs.SetError(err, "failed to get account list")
+	}
+
+	// 「Tweets list」はSheetごとに1回取得する
+	sheets := map[libs.SheetRef][]subsets.TwitterTweet{}
+	columns := map[libs.SheetRef][]string{}
+	issues := []SheetIssue{}
+	for _, a := range accounts {
+		if account != "" && a.TwitterID != account {
+			continue
+		}
+		if _, err := subsets.NewPipeline(a.Selection); err != nil {
+			issues = append(issues, SheetIssue{Account: a.TwitterID, Error: err.Error()})
+		}
+		if _, err := subsets.ParseWeight(a.Weight); err != nil {
+			issues = append(issues, SheetIssue{Account: a.TwitterID, Error: err.Error()})
+		}
+
+		ref := a.TweetsSheet(r.tweetsSheet())
+		tweets, ok := sheets[ref]
+		if !ok {
+			var df dataframe.DataFrame
+			_, df, tweets, err = r.readTweets(a)
+			if err != nil {
+				issues = append(issues, SheetIssue{Account: a.TwitterID, Sheet: ref.String(), Error: err.Error()})
+				continue
+			}
+			sheets[ref] = tweets
+			columns[ref] = df.Names()
+		}
+
+		for _, t := range tweets {
+			if t.TwitterID != a.TwitterID {
+				continue
+			}
+			if _, err := t.Channel("", r.Config.WeightedLimit()); err != nil {
+				issues = append(issues, SheetIssue{Account: a.TwitterID, Index: t.Index, Sheet: ref.String(), Error: err.Error()})
+				continue
+			}
+			data := subsets.TemplateData{Now: at, Account: a, Tweet: t, Pools: r.Config.Pools}
+			if err := subsets.ValidateTemplate(t.Text, data); err != nil {
+				issues = append(issues, SheetIssue{Account: a.TwitterID, Index: t.Index, Sheet: ref.String(), Error: err.Error()})
+				continue
+			}
+			// 削除の記録先の列
+			if t.HasLifecycle() {
+				for _, c := range subsets.DeleteWriteBackColumns {
+					if !slices.Contains(columns[ref], c) {
+						issues = append(issues, SheetIssue{Account: a.TwitterID, Index: t.Index, Sheet: ref.String(), Error: "delete_after and delete_previous require column: " + c})
+					}
+				}
+			}
+			if issue, ok := r.checkPost(at, a, t); ok {
+				issue.Sheet = ref.String()
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues, nil
+}
+
+// checkPost 展開後のtextの重み付き文字数と、投稿方法に対する返信・引用・投票の列を確認する
+// ‐ 返信・引用・投票の列の誤り（GUIでの投稿での指定を含む）は誤り
+// ‐ 使用できない文字を含む、またはパスワードのないアカウントでGUIへの投稿となる場合は誤り
+// ‐ 上限を超える場合（GUI・スレッドでの投稿）は警告
+// テンプレートは乱数のseedを固定して1通りに展開して数える
+func (r *Runner) checkPost(at time.Time, account subsets.TwitterAccount, tweet subsets.TwitterTweet) (SheetIssue, bool) {
+	data := subsets.TemplateData{Now: at, Account: account, Tweet: tweet, Pools: r.Config.Pools}
+	text, err := subsets.RenderText(tweet.Text, data, libs.NewRand(1))
+	if err != nil {
+		return SheetIssue{Account: account.TwitterID, Index: tweet.Index, Error: err.Error()}, true
+	}
+
+	limit := r.Config.WeightedLimit()
+	result := twittertext.Parse(text)
+	issue := SheetIssue{Account: account.TwitterID, Index: tweet.Index}
+	channel, _ := tweet.Channel(text, limit)
+	switch err := tweet.ValidateOptions(channel); {
+	case err != nil:
+		issue.Error = err.Error()
+	case result.WeightedLength == 0:
+		issue.Error = "empty text"
+	case result.WeightedLength <= limit && !result.Valid:
+		issue.Error = "text contains invalid characters"
+	case result.WeightedLength <= limit:
+		return SheetIssue{}, false
+	case channel == libs.ChannelGUI && account.Password == "":
+		issue.Error = fmt.Sprintf("over length: %d/%d, posting by gui requires password", result.WeightedLength, limit)
+	default:
+		issue.Error = fmt.Sprintf("over length: %d/%d, posted by %s", result.WeightedLength, limit, channel)
+		issue.Warning = true
+	}
+	return issue, true
+}
+
+// writeIssues 設定の誤りを1行ずつ出力する
+func writeIssues(w io.Writer, tenant string, issues []SheetIssue) {
+	if tenant != "" {
+		fmt.Fprintf(w, "tenant: %s\n", tenant)
+	}
+	if len(issues) == 0 {
+		fmt.Fprintln(w, "no issues")
+		return
+	}
+	for _, i := range issues {
+		msg := summarizeText(i.Error, 200)
+		if i.Warning {
+			msg = "warning: " + msg
+		}
+		if i.Index == 0 {
+			fmt.Fprintf(w, "%s  %s\n", i.Account, msg)
+			continue
+		}
+		fmt.Fprintf(w, "%s  #%d  %s\n", i.Account, i.Index, msg)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"tweet-with-spread/libs"
+)
+
+// TestValidateSheets テンプレート・selection・weightの誤りを行ごとに返すこと
+func TestValidateSheets(t *testing.T) {
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, &fakePoster{}, at)
+	r.Config.Pools = map[string][]string{"emoji": {"🌸"}}
+	store.SetSheet("admin", r.Config.Sheets.Accounts, [][]string{
+		{"index", "twitter_id", "subscribed", "schedule", "selection", "weight"},
+		{"1", "user", "1", "0 9 * * *", "", ""},
+		{"2", "other", "1", "0 9 * * *", "checked,newest", "likes=1"},
+	})
+	store.SetSheet("admin", r.Config.Sheets.Tweets, [][]string{
+		{"index", "twitter_id", "text", "checked", "campaign"},
+		{"1", "user", "{{campaign}} {{pool:emoji}} {おはよう|こんにちは}", "1", "spring"},
+		{"2", "user", "{{campaign_url}}", "1", "spring"},
+		// 対応しない括弧は誤りとしない
+		{"3", "user", "ありがとう(^^)/} {a|b", "1", ""},
+		{"4", "other", "hello", "1", ""},
+	})
+
+	issues, err := r.ValidateSheets(at, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		account string
+		index   int
+		err     string
+	}{
+		{"user", 2, "unknown variable: {{campaign_url}}"},
+		{"other", 0, "unknown stage"},
+		{"other", 0, "unknown name"},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("issues: %+v", issues)
+	}
+	for i, w := range want {
+		if got := issues[i]; got.Account != w.account || got.Index != w.index || !strings.Contains(got.Error, w.err) {
+			t.Fatalf("issue %d: got %+v, want %+v", i, got, w)
+		}
+	}
+
+	if issues, err := r.ValidateSheets(at, "other"); err != nil || len(issues) != 2 {
+		t.Fatalf("account: %+v, %v", issues, err)
+	}
+}
+
+// TestExecutorTemplate 投稿の直前にテンプレートを展開し、投稿履歴には展開前のtextを記録すること
+func TestExecutorTemplate(t *testing.T) {
+	poster := &fakePoster{}
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, poster, at)
+	template := "{{account}} {{count}}回目 {{pool:emoji}}"
+	store.SetSheet("admin", r.Config.Sheets.Tweets, [][]string{
+		{"index", "twitter_id", "text", "checked", "count", "tweet_url", "last_date"},
+		{"1", "user", template, "1", "2", "", "2024/01/01 00:00:00"},
+	})
+	r.Config.Pools = map[string][]string{"emoji": {"🌸"}}
+
+	summary := r.Executor(context.Background(), at)
+	if summary.Posted != 1 {
+		t.Fatalf("summary: %+v", summary)
+	}
+	if len(poster.texts) != 1 || poster.texts[0] != "user 3回目 🌸" {
+		t.Fatalf("posted: %v", poster.texts)
+	}
+	entries, err := r.Ledger.Entries()
+	if err != nil || len(entries) == 0 || entries[0].Event != libs.LedgerPosted || entries[0].TextHash != libs.TextHash(template) {
+		t.Fatalf("ledger: %#v, %v", entries, err)
+	}
+}
+
+// TestValidateSheetsLength 重み付き文字数が上限を超える行を、投稿方法に応じて誤り・警告として返すこと
+func TestValidateSheetsLength(t *testing.T) {
+	at := time.Now().UTC().Truncate(time.Minute)
+	r, store := newTestRunner(t, &fakePoster{}, at)
+	r.Config.TweetCountJA = 15
+	store.SetSheet("admin", r.Config.Sheets.Accounts, [][]string{
+		{"index", "twitter_id", "password", "subscribed", "schedule"},
+		{"1", "user", "", "1", "0 9 * * *"},
+		{"2", "gui", "secret", "1", "0 9 * * *"},
+	})
+	long := strings.Repeat("あ", 16)
+	store.SetSheet("admin", r.Config.Sheets.Tweets, [][]string{
+		{"index", "twitter_id", "text", "checked", "mode", "poll_options"},
+		// 英数字は1文字、URLは23文字として数えるため上限以内
+		{"1", "user", strings.Repeat("a", 30), "1", ""},
+		{"2", "user", "あ https://example.com/a/very/long/path", "1", ""},
+		{"3", "user", long, "1", ""},
+		{"4", "user", long, "1", "thread"},
+		{"5", "user", "abc‮", "1", ""},
+		{"6", "gui", long, "1", ""},
+		{"7", "user", "poll", "1", "", "A"},
+	})
+
+	issues, err := r.ValidateSheets(at, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		account string
+		index   int
+		err     string
+		warning bool
+	}{
+		{"user", 3, "over length: 32/30, posting by gui requires password", false},
+		{"user", 4, "over length: 32/30, posted by thread", true},
+		{"user", 5, "invalid characters", false},
+		{"user", 7, "2 to 4 options", false},
+		{"gui", 6, "over length: 32/30, posted by gui", true},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("issues: %+v", issues)
+	}
+	for i, w := range want {
+		if got := issues[i]; got.Account != w.account || got.Index != w.index || !strings.Contains(got.Error, w.err) || got.Warning != w.warning {
+			t.Fatalf("issue %d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+// TestExecutorOptions 返信・投票の列をAPI投稿のリクエストに設定し、誤りがあれば投稿しないこと
+func TestExecutorOptions(t *testing.T) {
+	cases := []struct {
+		name    string
+		row     []string
+		wantErr string
+	}{
+		{"reply and poll", []string{"1", "user", "どちら？", "1", "https://x.com/other/status/99", "A|B", "", ""}, ""},
+		{"poll with files", []string{"1", "user", "どちら？", "1", "", "A|B", "a.png", ""}, "poll and files"},
+		{"gui", []string{"1", "user", "どちら？", "1", "99", "", "", "gui"}, "not supported by gui"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			poster := &fakePoster{}
+			at := time.Now().UTC().Truncate(time.Minute)
+			r, store := newTestRunner(t, poster, at)
+			store.SetSheet("admin", r.Config.Sheets.Tweets, [][]string{
+				{"index", "twitter_id", "text", "checked", "reply_to", "poll_options", "file1", "mode", "last_date"},
+				append(c.row, "2024/01/01 00:00:00"),
+			})
+
+			summary := r.Executor(context.Background(), at)
+			if c.wantErr != "" {
+				if summary.Failed != 1 || !strings.Contains(summary.Results[0].Error, c.wantErr) || len(poster.texts) != 0 {
+					t.Fatalf("summary: %+v, posted: %v", summary, poster.texts)
+				}
+				return
+			}
+			if summary.Posted != 1 || len(poster.reqs) != 1 {
+				t.Fatalf("summary: %+v", summary)
+			}
+			req := poster.reqs[0]
+			if req.Reply == nil || req.Reply.InReplyToTweetID != "99" || req.Poll == nil || len(req.Poll.Options) != 2 {
+				t.Fatalf("req: %+v", req)
+			}
+		})
+	}
+}
@@ -9,10 +9,14 @@ require (
 	github.com/google/uuid v1.5.0
 	github.com/michimani/gotwi v0.14.0
 	github.com/playwright-community/playwright-go v0.4101.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/zerolog v1.31.0
 	github.com/stretchr/testify v1.8.4
+	golang.org/x/net v0.20.0
 	golang.org/x/oauth2 v0.16.0
+	golang.org/x/text v0.14.0
 	google.golang.org/api v0.161.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -47,13 +51,10 @@ require (
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/crypto v0.18.0 // indirect
 	golang.org/x/exp v0.0.0-20240119083558-1b970713d09a // indirect
-	golang.org/x/net v0.20.0 // indirect
 	golang.org/x/sys v0.16.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 	gonum.org/v1/gonum v0.9.1 // indirect
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240116215550-a9fa1716bcac // indirect
 	google.golang.org/grpc v1.60.1 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,73 @@
+package libs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checkpoint 処理済みの時刻をファイルに保存する
+// why: 停止・再起動しても、前回どこまで処理したかを知り、過ぎた処理を検出するため
+type Checkpoint struct {
+	path string
+	mu   sync.Mutex
+}
+
+type checkpointFile struct {
+	LastProcessed time.Time `json:"last_processed"`
+	SavedAt       time.Time `json:"saved_at"`
+}
+
+// OpenCheckpoint 処理済みの時刻を保存するファイルを開く
+// ファイルは保存時に作成する
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, SetError(err, "failed to create checkpoint directory")
+	}
+	return &Checkpoint{path: path}, nil
+}
+
+// Load 保存した処理済みの時刻を返す。保存したことがなければゼロ値
+func (c *Checkpoint) Load() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, SetError(err, "failed to read checkpoint")
+	}
+
+	var f checkpointFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return time.Time{}, SetError(err, "failed to parse checkpoint")
+	}
+	return f.LastProcessed, nil
+}
+
+// Save 処理済みの時刻を保存する
+// 一時ファイルに書き込んでから置き換える
+func (c *Checkpoint) Save(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := json.MarshalIndent(checkpointFile{LastProcessed: t, SavedAt: time.Now()}, "", "  ")
+	if err != nil {
+		return SetError(err, "failed to marshal checkpoint")
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return SetError(err, "failed to write checkpoint")
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return SetError(err, "failed to replace checkpoint")
+	}
+
+	return nil
+}
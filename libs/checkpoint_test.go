@@ -0,0 +1,54 @@
+package libs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler", "checkpoint.json")
+	c, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 保存したことがなければゼロ値
+	got, err := c.Load()
+	if err != nil || !got.IsZero() {
+		t.Fatalf("got %v, %v, want zero", got, err)
+	}
+
+	want := time.Date(2024, 1, 5, 12, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	if err := c.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	// 再起動後も同じ時刻を読み込む
+	c, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = c.Load()
+	if err != nil || !got.Equal(want) {
+		t.Fatalf("got %v, %v, want %v", got, err, want)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file remains: %v", err)
+	}
+
+	// 壊れたファイルはエラー
+	if err := os.WriteFile(path, []byte(`{"last_processed":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Load(); err == nil {
+		t.Fatal("expected error for corrupt checkpoint")
+	}
+	// 保存し直すと読み込める
+	if err := c.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Load(); err != nil || !got.Equal(want) {
+		t.Fatalf("got %v, %v, want %v", got, err, want)
+	}
+}
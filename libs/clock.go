@@ -0,0 +1,59 @@
+package libs
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock 現在時刻と待機
+// why: 時刻に依存する選択・待機を、テスト・模擬で再現するため
+type Clock interface {
+	Now() time.Time
+	// Sleep dだけ待機する ctxが終了した場合は中断し、ctxのエラーを返す
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// SystemClock 実際の時刻で待機するClock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) Sleep(ctx context.Context, d time.Duration) error {
+	return Sleep(ctx, d)
+}
+
+// Rand 乱数
+// why: 選択・待機・GUI操作の間隔を、seedを指定して再現するため
+type Rand interface {
+	// Intn [0,n)の乱数を返す
+	Intn(n int) int
+	// Float64 [0.0,1.0)の乱数を返す
+	Float64() float64
+}
+
+// NewRand seedで初期化した乱数を返す 並行して使用できる
+func NewRand(seed int64) Rand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+// lockedRand *rand.Randは並行して使用できないため、排他する
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
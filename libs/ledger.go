@@ -0,0 +1,271 @@
+package libs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// LedgerPosted 投稿した
+	LedgerPosted = "posted"
+	// LedgerSynced 投稿結果をSpreadsheetに書き込んだ
+	LedgerSynced = "synced"
+	// LedgerDeleted 投稿を削除した
+	LedgerDeleted = "deleted"
+
+	// ChannelAPI TwitterAPIで投稿
+	ChannelAPI = "api"
+	// ChannelGUI ブラウザ操作で投稿
+	ChannelGUI = "gui"
+	// ChannelThread TwitterAPIで返信の連鎖（スレッド）として投稿
+	ChannelThread = "thread"
+)
+
+// LedgerEntry 投稿履歴の1行
+// 投稿時にEvent: postedを、Spreadsheetへの書き込み完了時に同じIDでEvent: syncedを追記する
+// 投稿の削除時はEvent: deletedを追記する 削除のSpreadsheetへの書き込み完了も同じIDでEvent: syncedとする
+type LedgerEntry struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+
+	// 書き込み先（投稿したTweetを読み込んだSheet）
+	SheetRef
+
+	// 投稿内容
+	Account  string   `json:"account,omitempty"`
+	Index    int      `json:"index,omitempty"`
+	TextHash string   `json:"text_hash,omitempty"`
+	MediaIDs []string `json:"media_ids,omitempty"`
+	Channel  string   `json:"channel,omitempty"`
+
+	// 投稿結果
+	TweetID  string `json:"tweet_id,omitempty"`
+	TweetURL string `json:"tweet_url,omitempty"`
+	// スレッドで投稿した全てのTweetのID 先頭はTweetID
+	ThreadIDs []string `json:"thread_ids,omitempty"`
+	// 投稿後のCount（Spreadsheetへの書き込み値）
+	Count    int       `json:"count,omitempty"`
+	PostedAt time.Time `json:"posted_at,omitempty"`
+	// 投稿を削除する時刻 ゼロ値は削除しない
+	DeleteAt time.Time `json:"delete_at,omitempty"`
+
+	// 削除した投稿の投稿履歴ID（Event: deleted）
+	PostID    string    `json:"post_id,omitempty"`
+	DeletedAt time.Time `json:"deleted_at,omitempty"`
+
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Ledger 投稿履歴を追記のみで記録するJSONLファイル
+// why: Spreadsheetへの書き込みに失敗しても投稿の事実を失わず、重複投稿の防止・再書き込みに使うため
+type Ledger struct {
+	path string
+	mu   sync.Mutex
+
+	// 読み込み済みの投稿履歴と、読み込んだファイルの位置
+	entries []LedgerEntry
+	offset  int64
+}
+
+// OpenLedger 投稿履歴ファイルを開く。なければ作成する
+func OpenLedger(path string) (*Ledger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, SetError(err, "failed to create ledger directory")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, SetError(err, "failed to open ledger")
+	}
+	f.Close()
+
+	return &Ledger{path: path}, nil
+}
+
+// Append 投稿履歴を追記する
+// IDが空の場合は採番し、追記したEntryを返す
+func (l *Ledger) Append(e LedgerEntry) (LedgerEntry, error) {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if e.RecordedAt.IsZero() {
+		e.RecordedAt = time.Now()
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return e, SetError(err, "failed to marshal ledger entry")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return e, SetError(err, "failed to open ledger")
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return e, SetError(err, "failed to append ledger")
+	}
+	// 停止しても投稿履歴が残るように書き込みを確定する
+	if err := f.Sync(); err != nil {
+		return e, SetError(err, "failed to sync ledger")
+	}
+
+	return e, nil
+}
+
+// Entries 投稿履歴をすべて読み込む
+// 読み込み済みの行は保持し、前回から追記された行のみを読み込む why: 投稿のたびにファイル全体を読み直さないため
+// 途中で停止して壊れた行は読み飛ばす 書き込み途中（改行のない）末尾の行は次回に読み込む
+func (l *Ledger) Entries() ([]LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, SetError(err, "failed to open ledger")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, SetError(err, "failed to stat ledger")
+	}
+	if info.Size() < l.offset {
+		// ファイルが置き換えられた場合は読み直す
+		l.entries, l.offset = nil, 0
+	}
+	if _, err := f.Seek(l.offset, io.SeekStart); err != nil {
+		return nil, SetError(err, "failed to seek ledger")
+	}
+
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, SetError(err, "failed to read ledger")
+		}
+		l.offset += int64(len(line))
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var e LedgerEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			log.Warn().Str("function", "Ledger.Entries").Msgf("skip broken ledger line: %s", err)
+			continue
+		}
+		l.entries = append(l.entries, e)
+	}
+
+	return slices.Clone(l.entries), nil
+}
+
+// Unsynced Spreadsheetへの書き込みが完了していない投稿・削除を返す
+// 同じ行（書き込み先・アカウント・Index）に後の投稿・削除がある場合は、それぞれ最新のもののみを対象とする
+func (l *Ledger) Unsynced() ([]LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	type rowKey struct {
+		event, spreadID, sheetTitle, account string
+		index                                int
+	}
+	latest := make(map[rowKey]LedgerEntry)
+	var order []rowKey
+	synced := make(map[string]bool)
+	for _, e := range entries {
+		switch e.Event {
+		case LedgerPosted, LedgerDeleted:
+			k := rowKey{e.Event, e.SpreadID, e.SheetTitle, e.Account, e.Index}
+			if _, ok := latest[k]; !ok {
+				order = append(order, k)
+			}
+			latest[k] = e
+		case LedgerSynced:
+			synced[e.ID] = true
+		}
+	}
+
+	var unsynced []LedgerEntry
+	for _, k := range order {
+		if e := latest[k]; !synced[e.ID] {
+			unsynced = append(unsynced, e)
+		}
+	}
+
+	return unsynced, nil
+}
+
+// Deleted 削除済みの投稿の投稿履歴ID
+func Deleted(entries []LedgerEntry) map[string]bool {
+	deleted := make(map[string]bool)
+	for _, e := range entries {
+		if e.Event == LedgerDeleted {
+			deleted[e.PostID] = true
+		}
+	}
+	return deleted
+}
+
+// Expired 削除する時刻nowを過ぎ、削除していない投稿
+func Expired(entries []LedgerEntry, now time.Time) []LedgerEntry {
+	deleted := Deleted(entries)
+	var expired []LedgerEntry
+	for _, e := range entries {
+		if e.Event == LedgerPosted && !e.DeleteAt.IsZero() && !e.DeleteAt.After(now) && !deleted[e.ID] {
+			expired = append(expired, e)
+		}
+	}
+	return expired
+}
+
+// LatestPost 行（書き込み先・アカウント・Index）の最新の投稿 削除済みの場合はfalse
+func LatestPost(entries []LedgerEntry, ref SheetRef, account string, index int) (LedgerEntry, bool) {
+	var latest LedgerEntry
+	found := false
+	for _, e := range entries {
+		if e.Event == LedgerPosted && e.SheetRef.SameSheet(ref) && e.Account == account && e.Index == index {
+			latest, found = e, true
+		}
+	}
+	if !found || Deleted(entries)[latest.ID] {
+		return LedgerEntry{}, false
+	}
+	return latest, true
+}
+
+// MarkSynced 投稿結果のSpreadsheetへの書き込み完了を記録する
+func (l *Ledger) MarkSynced(posted LedgerEntry) error {
+	_, err := l.Append(LedgerEntry{
+		ID:    posted.ID,
+		Event: LedgerSynced,
+	})
+	return err
+}
+
+// TextHash 投稿文のハッシュ 投稿文そのものは履歴に残さない
+func TextHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,153 @@
+package libs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedgerUnsynced(t *testing.T) {
+	l, err := OpenLedger(filepath.Join(t.TempDir(), "ledger", "posts.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	first, err := l.Append(LedgerEntry{Event: LedgerPosted, SheetRef: SheetRef{SpreadID: "s", SheetTitle: "tweets"}, Account: "a", Index: 1, Count: 1, PostedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同じ行の後の投稿が最新となる
+	second, err := l.Append(LedgerEntry{Event: LedgerPosted, SheetRef: SheetRef{SpreadID: "s", SheetTitle: "tweets"}, Account: "a", Index: 1, Count: 2, PostedAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := l.Append(LedgerEntry{Event: LedgerPosted, SheetRef: SheetRef{SpreadID: "s", SheetTitle: "tweets"}, Account: "a", Index: 2, Count: 1, PostedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == "" || first.ID == second.ID {
+		t.Fatalf("ids: %q, %q", first.ID, second.ID)
+	}
+	if err := l.MarkSynced(other); err != nil {
+		t.Fatal(err)
+	}
+
+	unsynced, err := l.Unsynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unsynced) != 1 || unsynced[0].ID != second.ID || unsynced[0].Count != 2 {
+		t.Fatalf("unsynced: got %+v", unsynced)
+	}
+
+	// 壊れた行は読み飛ばす
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"broken`)
+	f.Close()
+
+	entries, err := l.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("entries: got %d, want 4", len(entries))
+	}
+	if !entries[0].PostedAt.Equal(now) {
+		t.Fatalf("posted at: got %v, want %v", entries[0].PostedAt, now)
+	}
+}
+
+// TestLedgerEntriesIncremental 読み込み済みの行を保持し、追記された行のみを読み込むこと
+func TestLedgerEntriesIncremental(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "posts.jsonl")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Append(LedgerEntry{Event: LedgerPosted, Account: "a", Index: 1}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := l.Entries()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("entries: got %d, %v", len(entries), err)
+	}
+	// 返却値を変更しても保持した投稿履歴は変わらない
+	entries[0].Index = 9
+
+	// 別のLedger（プロセス）からの追記、書き込み途中の行
+	other, err := OpenLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Append(LedgerEntry{Event: LedgerPosted, Account: "a", Index: 2}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"event":"posted","index":3`)
+	entries, err = l.Entries()
+	if err != nil || len(entries) != 2 || entries[0].Index != 1 || entries[1].Index != 2 {
+		t.Fatalf("entries: got %+v, %v", entries, err)
+	}
+
+	// 書き込みが完了した行は次回に読み込む
+	f.WriteString("}\n")
+	f.Close()
+	entries, err = l.Entries()
+	if err != nil || len(entries) != 3 || entries[2].Index != 3 {
+		t.Fatalf("entries: got %+v, %v", entries, err)
+	}
+}
+
+func TestLedgerLifecycle(t *testing.T) {
+	l, err := OpenLedger(filepath.Join(t.TempDir(), "posts.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	ref := SheetRef{SpreadID: "s", SheetTitle: "tweets"}
+	expired, _ := l.Append(LedgerEntry{Event: LedgerPosted, SheetRef: ref, Account: "a", Index: 1, TweetID: "1", DeleteAt: now.Add(-time.Minute)})
+	l.Append(LedgerEntry{Event: LedgerPosted, SheetRef: ref, Account: "a", Index: 2, TweetID: "2", DeleteAt: now.Add(time.Hour)})
+	kept, _ := l.Append(LedgerEntry{Event: LedgerPosted, SheetRef: ref, Account: "a", Index: 3, TweetID: "3"})
+
+	entries, err := l.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Expired(entries, now); len(got) != 1 || got[0].ID != expired.ID {
+		t.Fatalf("expired: %+v", got)
+	}
+	if got, ok := LatestPost(entries, ref, "a", 3); !ok || got.ID != kept.ID {
+		t.Fatalf("latest: %+v, %t", got, ok)
+	}
+
+	// 削除した投稿は削除の対象・前回の投稿としない
+	deleted, _ := l.Append(LedgerEntry{Event: LedgerDeleted, SheetRef: ref, Account: "a", Index: 1, TweetID: "1", PostID: expired.ID, DeletedAt: now})
+	entries, err = l.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Expired(entries, now); len(got) != 0 {
+		t.Fatalf("expired after delete: %+v", got)
+	}
+	if _, ok := LatestPost(entries, ref, "a", 1); ok {
+		t.Fatal("latest post must not be deleted one")
+	}
+
+	// 削除もSpreadsheetへの書き込みの対象とする
+	unsynced, err := l.Unsynced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unsynced) != 4 || unsynced[3].ID != deleted.ID {
+		t.Fatalf("unsynced: %+v", unsynced)
+	}
+}
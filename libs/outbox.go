@@ -0,0 +1,254 @@
+package libs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// 再試行の待機時間 失敗するごとに倍にする
+	OUTBOXBASEBACKOFF = 1 * time.Minute
+	OUTBOXMAXBACKOFF  = 1 * time.Hour
+	// 指定回数失敗した書き込みは滞留としてErrorログを出す
+	OUTBOXSTUCKATTEMPTS = 5
+)
+
+// PendingUpdate Spreadsheetへの書き込み待ち
+// 書き込み先の行はKeyColumn列の値がKeyである行とし、書き込み時に特定する
+type PendingUpdate struct {
+	// 書き込み先 RangeKeyは行を特定するために取得する範囲
+	SheetRef
+	KeyColumn string `json:"key_column"`
+	Key       string `json:"key"`
+	// 特定した行で一致しなければならない値（列名: 値）
+	Guard map[string]string `json:"guard,omitempty"`
+	// 書き込む値（列名: 値）
+	Values map[string]interface{} `json:"values"`
+	// 書き込む列がSheetにない場合は、書き込まずに完了とする
+	// why: 列が追加されるまで成功しない書き込みを、再試行し続けないため
+	Optional bool `json:"optional,omitempty"`
+
+	// 書き込み元の投稿履歴ID
+	LedgerID string `json:"ledger_id,omitempty"`
+
+	Attempts  int       `json:"attempts"`
+	NextAt    time.Time `json:"next_at"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// key 書き込み待ちを置き換える単位 書き込み先の行と、書き込む列
+// why: 同じ行でも列が異なる書き込み（投稿結果と削除日時）は、一方で他方を置き換えないため
+func (u PendingUpdate) key() string {
+	columns := make([]string, 0, len(u.Values))
+	for c := range u.Values {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	return u.SpreadID + "/" + u.SheetTitle + "/" + u.KeyColumn + "/" + u.Key + "/" + strings.Join(columns, ",")
+}
+
+// Apply 書き込み直前に行を特定し、書き込む
+// 戻り値は更新したDataframeの行番号（0始まり、Headerを除く） Optionalで書き込まなかった場合は-1
+func (u PendingUpdate) Apply(store SheetStore) (int, error) {
+	rowN, err := UpdateCellsByKey(store, u.SheetRef, u.KeyColumn, u.Key, u.Guard, u.Values)
+	if u.Optional && errors.Is(err, ErrColumnNotFound) {
+		log.Warn().Str("function", "PendingUpdate.Apply").Msgf("skip sheet update, %s > %s", u.key(), err)
+		return -1, nil
+	}
+	return rowN, err
+}
+
+// Outbox 失敗したSpreadsheetへの書き込みを保持し、次回以降に再試行する
+// 内容はファイルに保存し、再起動しても失われない
+// 同じ行・同じ列への書き込みは最新のもののみを保持する（書き込む値は絶対値のため、何度書き込んでも同じ結果になる）
+type Outbox struct {
+	path  string
+	mu    sync.Mutex
+	flush sync.Mutex
+	items []PendingUpdate
+
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
+	StuckAttempts int
+}
+
+// OpenOutbox 書き込み待ちファイルを開く。なければ作成する
+func OpenOutbox(path string) (*Outbox, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, SetError(err, "failed to create outbox directory")
+	}
+
+	o := &Outbox{
+		path:          path,
+		BaseBackoff:   OUTBOXBASEBACKOFF,
+		MaxBackoff:    OUTBOXMAXBACKOFF,
+		StuckAttempts: OUTBOXSTUCKATTEMPTS,
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, SetError(err, "failed to read outbox")
+	}
+	if len(b) != 0 {
+		if err := json.Unmarshal(b, &o.items); err != nil {
+			return nil, SetError(err, "failed to parse outbox")
+		}
+	}
+
+	return o, nil
+}
+
+// Enqueue 書き込み待ちに追加する
+// 同じ行・同じ列の書き込み待ちがあれば置き換える。同じ投稿履歴からの書き込み待ちであれば再試行の状態を保持する
+func (o *Outbox) Enqueue(u PendingUpdate) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+
+	for i := range o.items {
+		if o.items[i].key() != u.key() {
+			continue
+		}
+		if u.LedgerID != "" && o.items[i].LedgerID == u.LedgerID {
+			return nil
+		}
+		o.items[i] = u
+		return o.save()
+	}
+
+	o.items = append(o.items, u)
+	return o.save()
+}
+
+// Has 投稿履歴IDの書き込み待ちがあるか
+func (o *Outbox) Has(ledgerID string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, u := range o.items {
+		if u.LedgerID == ledgerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Len 書き込み待ちの件数
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.items)
+}
+
+// Flush 再試行の時刻に達した書き込み待ちを書き込む
+// 成功したものは取り除いて返し、失敗したものは待機時間を延ばして残す
+// 他で実行中の場合は何もしない
+func (o *Outbox) Flush(store SheetStore, now time.Time) []PendingUpdate {
+	if !o.flush.TryLock() {
+		return nil
+	}
+	defer o.flush.Unlock()
+
+	o.mu.Lock()
+	due := make([]PendingUpdate, 0, len(o.items))
+	for _, u := range o.items {
+		if !u.NextAt.After(now) {
+			due = append(due, u)
+		}
+	}
+	o.mu.Unlock()
+
+	var (
+		done   []PendingUpdate
+		failed = make(map[string]PendingUpdate)
+	)
+	for _, u := range due {
+		if _, err := u.Apply(store); err != nil {
+			u.Attempts++
+			u.LastError = err.Error()
+			u.NextAt = now.Add(o.backoff(u.Attempts))
+			failed[u.key()] = u
+
+			if u.Attempts >= o.StuckAttempts {
+				log.Error().Str("function", "Outbox.Flush").Msgf("stuck sheet update, %s, attempts: %d, since: %s > %s", u.key(), u.Attempts, u.CreatedAt.Format(time.RFC3339), u.LastError)
+			} else {
+				log.Warn().Str("function", "Outbox.Flush").Msgf("failed sheet update, %s, attempts: %d, next: %s > %s", u.key(), u.Attempts, u.NextAt.Format(time.RFC3339), u.LastError)
+			}
+			continue
+		}
+		done = append(done, u)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// 書き込み中に置き換えられた書き込み待ちは残す
+	items := o.items[:0]
+	for _, u := range o.items {
+		if f, ok := failed[u.key()]; ok && f.LedgerID == u.LedgerID && f.CreatedAt.Equal(u.CreatedAt) {
+			items = append(items, f)
+			continue
+		}
+		if containsUpdate(done, u) {
+			continue
+		}
+		items = append(items, u)
+	}
+	o.items = items
+
+	if err := o.save(); err != nil {
+		log.Error().Err(err).Str("function", "Outbox.Flush").Msg("failed to save outbox")
+	}
+
+	return done
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.BaseBackoff
+	for i := 1; i < attempts && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d
+}
+
+func containsUpdate(list []PendingUpdate, u PendingUpdate) bool {
+	for _, d := range list {
+		if d.key() == u.key() && d.LedgerID == u.LedgerID && d.CreatedAt.Equal(u.CreatedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// save 一時ファイルに書き込んでから置き換える
+func (o *Outbox) save() error {
+	b, err := json.MarshalIndent(o.items, "", "  ")
+	if err != nil {
+		return SetError(err, "failed to marshal outbox")
+	}
+
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return SetError(err, "failed to write outbox")
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return SetError(err, "failed to replace outbox")
+	}
+
+	return nil
+}
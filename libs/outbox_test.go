@@ -0,0 +1,134 @@
+package libs
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// failingStore 指定回数UpdateCellsに失敗するSheetStore
+type failingStore struct {
+	*MemorySheetStore
+	fails int
+}
+
+func (s *failingStore) UpdateCells(spreadID, sheetTitle string, cells []Cell) error {
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("sheet unavailable")
+	}
+	return s.MemorySheetStore.UpdateCells(spreadID, sheetTitle, cells)
+}
+
+func TestOutboxFlush(t *testing.T) {
+	mem := NewMemorySheetStore()
+	mem.SetSheet("spread", "tweets", [][]string{
+		{"index", "twitter_id", "count"},
+		{"1", "user", "0"},
+	})
+	store := &failingStore{MemorySheetStore: mem, fails: 2}
+
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	o, err := OpenOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := PendingUpdate{
+		SheetRef:  SheetRef{SpreadID: "spread", SheetTitle: "tweets", RangeKey: "A1:Z"},
+		KeyColumn: "index", Key: "1",
+		Guard:    map[string]string{"twitter_id": "user"},
+		Values:   map[string]interface{}{"count": 1},
+		LedgerID: "ledger-1",
+	}
+	if err := o.Enqueue(u); err != nil {
+		t.Fatal(err)
+	}
+	// 同じ投稿履歴からの追加は重複させない
+	if err := o.Enqueue(u); err != nil {
+		t.Fatal(err)
+	}
+	if o.Len() != 1 {
+		t.Fatalf("len: got %d, want 1", o.Len())
+	}
+
+	now := time.Now()
+	if done := o.Flush(store, now); len(done) != 0 {
+		t.Fatalf("first flush: got %d done", len(done))
+	}
+
+	// 再起動しても書き込み待ちは失われない
+	o, err = OpenOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Len() != 1 {
+		t.Fatalf("reopened len: got %d, want 1", o.Len())
+	}
+
+	// 待機時間中は再試行しない
+	if done := o.Flush(store, now.Add(30*time.Second)); len(done) != 0 || store.fails != 1 {
+		t.Fatalf("backoff flush: got %d done, fails %d", len(done), store.fails)
+	}
+	// 待機時間は倍になる
+	if done := o.Flush(store, now.Add(OUTBOXBASEBACKOFF)); len(done) != 0 {
+		t.Fatalf("second flush: got %d done", len(done))
+	}
+	if done := o.Flush(store, now.Add(2*OUTBOXBASEBACKOFF)); len(done) != 0 {
+		t.Fatalf("early flush: got %d done", len(done))
+	}
+	done := o.Flush(store, now.Add(3*OUTBOXBASEBACKOFF))
+	if len(done) != 1 || done[0].LedgerID != "ledger-1" {
+		t.Fatalf("third flush: got %+v", done)
+	}
+	if o.Len() != 0 {
+		t.Fatalf("len after success: got %d", o.Len())
+	}
+	if rows := mem.Sheet("spread", "tweets"); rows[1][2] != "1" {
+		t.Fatalf("count: got %v", rows)
+	}
+}
+
+// TestOutboxColumns 同じ行でも列が異なる書き込み待ちは置き換えず、別々に書き込むこと
+// 列がない任意の書き込みは、書き込まずに完了とすること
+func TestOutboxColumns(t *testing.T) {
+	// deleted_dateの列がないSheet
+	store := NewMemorySheetStore()
+	store.SetSheet("spread", "tweets", [][]string{
+		{"index", "twitter_id", "count"},
+		{"1", "user", "0"},
+	})
+	o, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := SheetRef{SpreadID: "spread", SheetTitle: "tweets", RangeKey: "A1:Z"}
+	for _, u := range []PendingUpdate{
+		{SheetRef: ref, KeyColumn: "index", Key: "1", Values: map[string]interface{}{"count": 1}, LedgerID: "posted-1"},
+		{SheetRef: ref, KeyColumn: "index", Key: "1", Values: map[string]interface{}{"deleted_date": "2024/01/01 00:00:00"}, Optional: true, LedgerID: "deleted-1"},
+		{SheetRef: ref, KeyColumn: "index", Key: "1", Values: map[string]interface{}{"tweet_url": "https://x.com/user/status/1"}, LedgerID: "posted-0"},
+		// 同じ列は最新に置き換える
+		{SheetRef: ref, KeyColumn: "index", Key: "1", Values: map[string]interface{}{"count": 2}, LedgerID: "posted-2"},
+	} {
+		if err := o.Enqueue(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if o.Len() != 3 {
+		t.Fatalf("len: got %d, want 3", o.Len())
+	}
+
+	// 列がない任意の書き込みは完了とし、任意でない書き込みは再試行する
+	done := o.Flush(store, time.Now())
+	if len(done) != 2 || done[0].LedgerID != "posted-2" || done[1].LedgerID != "deleted-1" {
+		t.Fatalf("flush: got %+v", done)
+	}
+	if o.Len() != 1 || !o.Has("posted-0") {
+		t.Fatalf("pending: got %d", o.Len())
+	}
+	if rows := store.Sheet("spread", "tweets"); rows[1][2] != "2" {
+		t.Fatalf("count: got %v", rows)
+	}
+}
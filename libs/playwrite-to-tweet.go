@@ -1,9 +1,9 @@
 package libs
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
@@ -19,21 +19,39 @@ const (
 	TWITTER    = "https://twitter.com"
 	TWITTERPRO = "https://pro.twitter.com"
 
-	// ファイルアップロード待ち時間
-	// Important! : インスタンスやネットワークの状況によって変更してください
-	MAXWAITFORUPLOAD = 120
+	// ファイルアップロード待ち時間の既定値
+	// Important! : インスタンスやネットワークの状況によってGUIOptions.MaxWaitForUploadで変更してください
+	DEFAULTMAXWAITFORUPLOAD = 120
 
 	is_debug = false
 )
 
+// GUIOptions GUI投稿の設定
+type GUIOptions struct {
+	// ファイルアップロード待ち時間の上限（秒） 0以下の場合は既定値
+	MaxWaitForUpload int
+	// 入力・操作の間隔の乱数 nilの場合は現在時刻で初期化する
+	Rand Rand
+}
+
+func (o GUIOptions) maxWaitForUpload() int {
+	if o.MaxWaitForUpload <= 0 {
+		return DEFAULTMAXWAITFORUPLOAD
+	}
+	return o.MaxWaitForUpload
+}
+
 // TweetsToGUI Login & Tweet
 // Two-step verification is not supported.
 // - newPage()
 // - login()
 // - post()
-func TweetsToGUI(is_post, with_files bool, accountID, password, postMessage string, fileAbsolutePaths interface{}) error {
-	s := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(s)
+// ctxが終了した場合は各操作の間で中断する。ただし投稿ボタンを押した後は中断しない
+func TweetsToGUI(ctx context.Context, opts GUIOptions, is_post, with_files bool, accountID, password, postMessage string, fileAbsolutePaths interface{}) error {
+	r := opts.Rand
+	if r == nil {
+		r = NewRand(time.Now().UnixNano())
+	}
 
 	// create new page with context
 	pw, browser, page, err := newPage(is_post)
@@ -141,7 +159,7 @@ func TweetsToGUI(is_post, with_files bool, accountID, password, postMessage stri
 
 	// ログインセクション
 	// input UserID/TwitterID/TEL/Email
-	if err := login(page, accountID, password, r); err != nil {
+	if err := login(ctx, page, accountID, password, r); err != nil {
 		return SetError(err, "could not twitter login")
 	}
 
@@ -166,13 +184,15 @@ func TweetsToGUI(is_post, with_files bool, accountID, password, postMessage stri
 		return SetError(err, "could not goto "+u.String())
 	}
 
-	time.Sleep(time.Millisecond * time.Duration(millisec(r)))
+	if err := Sleep(ctx, time.Millisecond*time.Duration(millisec(r))); err != nil {
+		return SetError(err, "canceled before post")
+	}
 
 	// 投稿セクション
 	if !is_post {
 		return fmt.Errorf("[定数設定] not post for gui, program constants limit posting privileges, request, %v", postMessage)
 	}
-	if err := post(with_files, page, postMessage, fileAbsolutePaths.([]string), r); err != nil {
+	if err := post(ctx, opts, with_files, page, postMessage, fileAbsolutePaths.([]string), r); err != nil {
 		return SetError(err, "could not post")
 	}
 
@@ -182,7 +202,7 @@ func TweetsToGUI(is_post, with_files bool, accountID, password, postMessage stri
 }
 
 // login ログインセクション: GUIや仕様が変わった場合はこの関数を変更してください
-func login(page playwright.Page, accountID, password string, r *rand.Rand) error {
+func login(ctx context.Context, page playwright.Page, accountID, password string, r Rand) error {
 	// if err := Screenshot(page, "login-id.png"); err != nil {
 	// 	return SetError(err, "could not screenshot")
 	// }
@@ -191,7 +211,9 @@ func login(page playwright.Page, accountID, password string, r *rand.Rand) error
 		return SetError(err, "could not fill to account input")
 	}
 
-	time.Sleep(time.Millisecond * time.Duration(millisec(r)))
+	if err := Sleep(ctx, time.Millisecond*time.Duration(millisec(r))); err != nil {
+		return SetError(err, "canceled to login")
+	}
 
 	if err := page.Locator(`xpath=//span[text()='次へ']`).Tap(); err != nil {
 		return SetError(err, "could not click to 次へ button")
@@ -206,31 +228,39 @@ func login(page playwright.Page, accountID, password string, r *rand.Rand) error
 		return SetError(err, "could not fill to password input")
 	}
 
-	time.Sleep(time.Millisecond * time.Duration(millisec(r)))
+	if err := Sleep(ctx, time.Millisecond*time.Duration(millisec(r))); err != nil {
+		return SetError(err, "canceled to login")
+	}
 
 	if err := page.Locator("[data-testid='LoginForm_Login_Button']").Nth(0).Tap(); err != nil {
 		return SetError(err, "could not click to login button")
 	}
 
-	time.Sleep(time.Millisecond * time.Duration(millisec(r)))
+	if err := Sleep(ctx, time.Millisecond*time.Duration(millisec(r))); err != nil {
+		return SetError(err, "canceled to login")
+	}
 
 	return nil
 }
 
 // post 投稿セクション: GUIや仕様が変わった場合はこの関数を変更してください
-func post(with_files bool, page playwright.Page, msg string, files []string, r *rand.Rand) error {
+func post(ctx context.Context, opts GUIOptions, with_files bool, page playwright.Page, msg string, files []string, r Rand) error {
 	// if err := Screenshot(page, "post-start.png"); err != nil {
 	// 	return SetError(err, "could not screenshot")
 	// }
 
-	time.Sleep(time.Millisecond * time.Duration(millisec(r)))
+	if err := Sleep(ctx, time.Millisecond*time.Duration(millisec(r))); err != nil {
+		return SetError(err, "canceled to post")
+	}
 	// contenteditable属性を持つ要素にテキストを入力
 	isVisible, err := page.Locator("[data-testid='tweetTextarea_0']").IsVisible()
 	if err != nil {
 		return SetError(err, "could not check the element is visible")
 	}
 
-	time.Sleep(10 * time.Second)
+	if err := Sleep(ctx, 10*time.Second); err != nil {
+		return SetError(err, "canceled to post")
+	}
 
 	if !isVisible {
 		// 入力画面がなければ入力画面表示ボタンをタップ
@@ -249,7 +279,7 @@ func post(with_files bool, page playwright.Page, msg string, files []string, r *
 	// }
 
 	// ファイルをアップロード
-	if err := uploadFiles(r, page, with_files, files); err != nil {
+	if err := uploadFiles(ctx, opts, r, page, with_files, files); err != nil {
 		return SetError(err, "could not upload files")
 	}
 
@@ -258,6 +288,10 @@ func post(with_files bool, page playwright.Page, msg string, files []string, r *
 	// }
 
 	// ツイートボタンをクリック
+	// 以降は投稿済みの可能性があるため中断しない
+	if err := ctx.Err(); err != nil {
+		return SetError(err, "canceled before click to post button")
+	}
 	if err := page.Locator(`xpath=//span[text()='ポストする']`).Tap(); err != nil {
 		return SetError(err, "could not click to post button")
 	}
@@ -268,13 +302,15 @@ func post(with_files bool, page playwright.Page, msg string, files []string, r *
 }
 
 // uploadFiles ファイルをアップロードする
-func uploadFiles(r *rand.Rand, page playwright.Page, with_files bool, files []string) error {
+func uploadFiles(ctx context.Context, opts GUIOptions, r Rand, page playwright.Page, with_files bool, files []string) error {
 	if len(files) == 0 {
 		log.Debug().Msgf("no files to upload, files: %v", files)
 		return nil
 	}
 
-	time.Sleep(time.Millisecond * time.Duration(millisec(r)))
+	if err := Sleep(ctx, time.Millisecond*time.Duration(millisec(r))); err != nil {
+		return SetError(err, "canceled to upload files")
+	}
 	// if err := Screenshot(page, "screenshot-before.png"); err != nil {
 	// 	return SetError(err, "could not screenshot")
 	// }
@@ -326,7 +362,7 @@ func uploadFiles(r *rand.Rand, page playwright.Page, with_files bool, files []st
 	// ファイルのアップロード待ち
 	// time.Sleep(1 * time.Minute)
 	var (
-		maxWaitSec = MAXWAITFORUPLOAD
+		maxWaitSec = opts.maxWaitForUpload()
 		isOK       bool
 	)
 	for i := 0; i < maxWaitSec; i++ {
@@ -338,11 +374,13 @@ func uploadFiles(r *rand.Rand, page playwright.Page, with_files bool, files []st
 		// 投稿画像及び動画が表示された
 		if isThere {
 			isOK = true
-			log.Debug().Int("gui upload wait sec", MAXWAITFORUPLOAD-i).Msg("ok or could not upload file")
+			log.Debug().Int("gui upload wait sec", maxWaitSec-i).Msg("ok or could not upload file")
 			break
 		}
 
-		time.Sleep(time.Second)
+		if err := Sleep(ctx, time.Second); err != nil {
+			return SetError(err, "canceled to wait upload files")
+		}
 	}
 	if with_files { // ファイル必須ならば、ファイルの表示を確認してから判断する
 		if !isOK {
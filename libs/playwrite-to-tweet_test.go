@@ -1,6 +1,7 @@
 package libs
 
 import (
+	"context"
 	"testing"
 )
 
@@ -28,7 +29,7 @@ func TestLogin(t *testing.T) {
 
 	// fmt.Printf("%#v", info)
 	with_files := true
-	if err := TweetsToGUI(IS_TWITTER_POST, with_files, accountID, password, POSTMSG, files); err != nil {
+	if err := TweetsToGUI(context.Background(), GUIOptions{}, IS_TWITTER_POST, with_files, accountID, password, POSTMSG, files); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -0,0 +1,430 @@
+package libs
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-gota/gota/dataframe"
+)
+
+// SheetStore Spreadsheetの読み書き先を抽象化する
+// ‐ GoogleSheetStore: Google Spreadsheet（本番）
+// ‐ CSVSheetStore: ローカルディレクトリのCSVファイル（ステージング・オフライン）
+// ‐ MemorySheetStore: メモリ上のSheet（テスト）
+type SheetStore interface {
+	// GetSheet Sheetを取得し、bindListにBindする
+	// 必ずSheetTitle・RangeKeyを指定すること
+	GetSheet(spreadID, sheetTitle, rangeKey string, bindList any) (dataframe.DataFrame, error)
+	// UpdateRow RangeKey（例: "sheet!A2:K2"）で指定した行を更新する
+	UpdateRow(spreadID, sheetTitle, rangeKey string, row []interface{}) error
+	// UpdateCells 指定セルのみを更新する
+	UpdateCells(spreadID, sheetTitle string, cells []Cell) error
+}
+
+// SheetRef 読み書きするSheetの参照
+// 読み込み元と書き込み先を一つにまとめて持ち回る
+// why: 読み込んだSheetとは別のSheetに書き込まないため
+type SheetRef struct {
+	SpreadID   string `json:"spread_id"`
+	SheetTitle string `json:"sheet_title"`
+	// 取得範囲 例: "A1:Z"
+	RangeKey string `json:"range_key,omitempty"`
+}
+
+func (r SheetRef) String() string {
+	return fmt.Sprintf("%s/%s!%s", r.SpreadID, r.SheetTitle, r.RangeKey)
+}
+
+// SameSheet 同じSpreadsheetの同じSheetか 取得範囲は比較しない
+func (r SheetRef) SameSheet(o SheetRef) bool {
+	return r.SpreadID == o.SpreadID && r.SheetTitle == o.SheetTitle
+}
+
+// Get Sheetを取得し、bindListにBindする
+func (r SheetRef) Get(store SheetStore, bindList any) (dataframe.DataFrame, error) {
+	return store.GetSheet(r.SpreadID, r.SheetTitle, r.RangeKey, bindList)
+}
+
+// GoogleSheetStore Google Spreadsheet APIを使用するSheetStore
+type GoogleSheetStore struct {
+	cred []byte
+}
+
+func NewGoogleSheetStore(cred []byte) *GoogleSheetStore {
+	return &GoogleSheetStore{cred: cred}
+}
+
+func (s *GoogleSheetStore) GetSheet(spreadID, sheetTitle, rangeKey string, bindList any) (dataframe.DataFrame, error) {
+	return GetSheet(s.cred, spreadID, sheetTitle, rangeKey, bindList)
+}
+
+func (s *GoogleSheetStore) UpdateRow(spreadID, sheetTitle, rangeKey string, row []interface{}) error {
+	return UpdateRow(s.cred, spreadID, sheetTitle, rangeKey, row)
+}
+
+func (s *GoogleSheetStore) UpdateCells(spreadID, sheetTitle string, cells []Cell) error {
+	return UpdateCells(s.cred, spreadID, sheetTitle, cells)
+}
+
+// CSVSheetStore ローカルディレクトリのCSVファイルをSpreadsheetとして扱うSheetStore
+// ファイル配置: <Dir>/<SpreadID>/<SheetTitle>.csv
+// why: Google Spreadsheetを使わずにオフライン・ステージングで一連の処理を実行するため
+type CSVSheetStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+func NewCSVSheetStore(dir string) *CSVSheetStore {
+	return &CSVSheetStore{Dir: dir}
+}
+
+func (s *CSVSheetStore) path(spreadID, sheetTitle string) string {
+	return filepath.Join(s.Dir, spreadID, sheetTitle+".csv")
+}
+
+func (s *CSVSheetStore) GetSheet(spreadID, sheetTitle, rangeKey string, bindList any) (dataframe.DataFrame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := readCSV(s.path(spreadID, sheetTitle))
+	if err != nil {
+		return dataframe.DataFrame{}, SetError(err, "get csv sheet "+spreadID+"/"+sheetTitle+" error")
+	}
+
+	rows, err = sliceRange(rows, rangeKey)
+	if err != nil {
+		return dataframe.DataFrame{}, err
+	}
+
+	return recordsToDataframe(rows, bindList)
+}
+
+func (s *CSVSheetStore) UpdateRow(spreadID, sheetTitle, rangeKey string, row []interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.path(spreadID, sheetTitle)
+	rows, err := readCSV(p)
+	if err != nil {
+		return SetError(err, "get csv sheet "+spreadID+"/"+sheetTitle+" error")
+	}
+
+	rows, err = writeRow(rows, sheetTitle, rangeKey, row)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCSV(p, rows); err != nil {
+		return SetError(err, "update csv sheet "+rangeKey+" error")
+	}
+
+	return nil
+}
+
+func (s *CSVSheetStore) UpdateCells(spreadID, sheetTitle string, cells []Cell) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.path(spreadID, sheetTitle)
+	rows, err := readCSV(p)
+	if err != nil {
+		return SetError(err, "get csv sheet "+spreadID+"/"+sheetTitle+" error")
+	}
+
+	rows, err = writeCells(rows, cells)
+	if err != nil {
+		return err
+	}
+	if err := writeCSV(p, rows); err != nil {
+		return SetError(err, "update csv sheet cells "+sheetTitle+" error")
+	}
+
+	return nil
+}
+
+// MemorySheetStore メモリ上にSheetを保持するSheetStore
+// テストやPlanなど、Spreadsheetを変更せずに処理を確認する場合に使用する
+type MemorySheetStore struct {
+	mu     sync.Mutex
+	sheets map[string][][]string
+}
+
+func NewMemorySheetStore() *MemorySheetStore {
+	return &MemorySheetStore{sheets: make(map[string][][]string)}
+}
+
+func memoryKey(spreadID, sheetTitle string) string {
+	return spreadID + "/" + sheetTitle
+}
+
+// SetSheet Sheetの内容を設定する 1行目はHeaderであること
+func (s *MemorySheetStore) SetSheet(spreadID, sheetTitle string, rows [][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sheets[memoryKey(spreadID, sheetTitle)] = copyRows(rows)
+}
+
+// Sheet Sheetの内容を返す 存在しない場合はnil
+func (s *MemorySheetStore) Sheet(spreadID, sheetTitle string) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows, ok := s.sheets[memoryKey(spreadID, sheetTitle)]
+	if !ok {
+		return nil
+	}
+	return copyRows(rows)
+}
+
+func (s *MemorySheetStore) GetSheet(spreadID, sheetTitle, rangeKey string, bindList any) (dataframe.DataFrame, error) {
+	s.mu.Lock()
+	rows, ok := s.sheets[memoryKey(spreadID, sheetTitle)]
+	rows = copyRows(rows)
+	s.mu.Unlock()
+
+	if !ok {
+		return dataframe.DataFrame{}, fmt.Errorf("spreadsheet has no sheet: %s", sheetTitle)
+	}
+
+	rows, err := sliceRange(rows, rangeKey)
+	if err != nil {
+		return dataframe.DataFrame{}, err
+	}
+
+	return recordsToDataframe(rows, bindList)
+}
+
+func (s *MemorySheetStore) UpdateRow(spreadID, sheetTitle, rangeKey string, row []interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey(spreadID, sheetTitle)
+	rows, ok := s.sheets[key]
+	if !ok {
+		return fmt.Errorf("spreadsheet has no sheet: %s", sheetTitle)
+	}
+
+	rows, err := writeRow(rows, sheetTitle, rangeKey, row)
+	if err != nil {
+		return err
+	}
+	s.sheets[key] = rows
+
+	return nil
+}
+
+func (s *MemorySheetStore) UpdateCells(spreadID, sheetTitle string, cells []Cell) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey(spreadID, sheetTitle)
+	rows, ok := s.sheets[key]
+	if !ok {
+		return fmt.Errorf("spreadsheet has no sheet: %s", sheetTitle)
+	}
+	rows, err := writeCells(rows, cells)
+	if err != nil {
+		return err
+	}
+	s.sheets[key] = rows
+
+	return nil
+}
+
+// recordsToDataframe 取得した配列をDataframeに読み込み、指定の型にBindする
+// bindListがnilの場合はBindしない
+func recordsToDataframe(rows [][]string, bindList any) (dataframe.DataFrame, error) {
+	df := dataframe.DataFrame{}
+	if len(rows) == 0 {
+		return df, errors.New("no rows in sheet")
+	}
+
+	// 末尾の空セルは返却されないため、Headerの列数に揃える
+	rows = padRows(rows, len(rows[0]))
+
+	// LoadRecordsで配列をDataframeに読み込む
+	df = dataframe.LoadRecords(rows)
+	if df.Err != nil {
+		return df, SetError(df.Err, "failed to load records")
+	}
+	if bindList == nil {
+		return df, nil
+	}
+
+	// 指定の型にBingする
+	if err := ToStruct(df.Records(), bindList); err != nil {
+		return df, SetError(err, "failed to bind list")
+	}
+
+	return df, nil
+}
+
+// a1Pattern A1形式の範囲指定 例: "A1:Z", "A2:K2", "sheet!A2:K2"
+var a1Pattern = regexp.MustCompile(`^(?:.*!)?([A-Z]+)(\d*)(?::([A-Z]+)(\d*))?$`)
+
+// parseA1Range A1形式の範囲を列・行番号（1始まり）に変換する
+// 行・終端列が省略された場合は0を返す
+func parseA1Range(rangeKey string) (startCol, startRow, endCol, endRow int, err error) {
+	m := a1Pattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(rangeKey)))
+	if m == nil {
+		return 0, 0, 0, 0, fmt.Errorf("invalid range key: %s", rangeKey)
+	}
+
+	startCol = FromAlphabet(m[1])
+	startRow, _ = strconv.Atoi(m[2])
+	endCol = FromAlphabet(m[3])
+	endRow, _ = strconv.Atoi(m[4])
+
+	return startCol, startRow, endCol, endRow, nil
+}
+
+// FromAlphabet アルファベットを数値に変換する ToAlphabetの逆変換
+func FromAlphabet(columnName string) int {
+	var columnIndex int
+	for _, r := range columnName {
+		columnIndex = columnIndex*26 + int(r-'A') + 1
+	}
+	return columnIndex
+}
+
+// sliceRange Google Spreadsheet APIと同様に、範囲指定でSheetを切り出す
+func sliceRange(rows [][]string, rangeKey string) ([][]string, error) {
+	startCol, startRow, endCol, endRow, err := parseA1Range(rangeKey)
+	if err != nil {
+		return nil, err
+	}
+	if startRow == 0 {
+		startRow = 1
+	}
+
+	var result [][]string
+	for i := startRow - 1; i < len(rows); i++ {
+		if endRow != 0 && i >= endRow {
+			break
+		}
+		row := rows[i]
+		var cells []string
+		for j := startCol - 1; j < len(row); j++ {
+			if endCol != 0 && j >= endCol {
+				break
+			}
+			cells = append(cells, strings.TrimSpace(row[j]))
+		}
+		result = append(result, cells)
+	}
+
+	return result, nil
+}
+
+// writeRow RangeKeyで指定した行に値を書き込む
+func writeRow(rows [][]string, sheetTitle, rangeKey string, row []interface{}) ([][]string, error) {
+	if i := strings.Index(rangeKey, "!"); i >= 0 && rangeKey[:i] != sheetTitle {
+		return nil, fmt.Errorf("range key %s is not for sheet: %s", rangeKey, sheetTitle)
+	}
+
+	startCol, startRow, _, _, err := parseA1Range(rangeKey)
+	if err != nil {
+		return nil, err
+	}
+	if startRow == 0 {
+		return nil, fmt.Errorf("range key has no row: %s", rangeKey)
+	}
+
+	for len(rows) < startRow {
+		rows = append(rows, []string{})
+	}
+	target := rows[startRow-1]
+	for len(target) < startCol-1+len(row) {
+		target = append(target, "")
+	}
+	for j, v := range row {
+		target[startCol-1+j] = fmt.Sprintf("%v", v)
+	}
+	rows[startRow-1] = target
+
+	return padRows(rows, len(rows[0])), nil
+}
+
+// writeCells 指定セルに値を書き込む
+// 行・列は1以上 範囲外のセルがある場合は書き込まない
+func writeCells(rows [][]string, cells []Cell) ([][]string, error) {
+	for _, c := range cells {
+		if c.Row < 1 || c.Column < 1 {
+			return nil, fmt.Errorf("invalid cell: row %d, column %d", c.Row, c.Column)
+		}
+	}
+	if len(rows) == 0 && len(cells) == 0 {
+		return rows, nil
+	}
+	for _, c := range cells {
+		for len(rows) < c.Row {
+			rows = append(rows, []string{})
+		}
+		for len(rows[c.Row-1]) < c.Column {
+			rows[c.Row-1] = append(rows[c.Row-1], "")
+		}
+		rows[c.Row-1][c.Column-1] = fmt.Sprintf("%v", c.Value)
+	}
+	return padRows(rows, len(rows[0])), nil
+}
+
+// padRows 各行の列数をn以上に揃える
+func padRows(rows [][]string, n int) [][]string {
+	for i := range rows {
+		for len(rows[i]) < n {
+			rows[i] = append(rows[i], "")
+		}
+	}
+	return rows
+}
+
+func copyRows(rows [][]string) [][]string {
+	if rows == nil {
+		return nil
+	}
+	c := make([][]string, len(rows))
+	for i := range rows {
+		c[i] = append([]string(nil), rows[i]...)
+	}
+	return c
+}
+
+func readCSV(p string) ([][]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	// 行ごとの列数の違いを許容する
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// writeCSV 一時ファイルに書き込んでから置き換える
+// why: 書き込み途中で停止してもSheetが壊れないため
+func writeCSV(p string, rows [][]string) error {
+	tmp := p + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
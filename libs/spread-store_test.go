@@ -0,0 +1,148 @@
+package libs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type storeRow struct {
+	Index int    `csv:"index"`
+	Text  string `csv:"text"`
+	Count int    `csv:"count"`
+}
+
+var storeRows = [][]string{
+	{"index", "text", "count"},
+	{"1", "first", "0"},
+	{"2", "second", "3"},
+}
+
+func testSheetStore(t *testing.T, store SheetStore) {
+	t.Helper()
+
+	var list []storeRow
+	df, err := store.GetSheet("spread", "tweets", "A1:Z", &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rN, _ := df.Dims(); rN != 2 {
+		t.Fatalf("rows: got %d, want 2", rN)
+	}
+	want := []storeRow{{1, "first", 0}, {2, "second", 3}}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("bind: got %+v, want %+v", list, want)
+	}
+
+	if err := store.UpdateRow("spread", "tweets", "tweets!A3:C3", []interface{}{2, "second", 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	list = nil
+	if _, err := store.GetSheet("spread", "tweets", "A1:Z", &list); err != nil {
+		t.Fatal(err)
+	}
+	if list[1].Count != 4 || list[0].Count != 0 {
+		t.Fatalf("update: got %+v", list)
+	}
+
+	// 範囲外の列は取得しない
+	df, err = store.GetSheet("spread", "tweets", "A1:B", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, cN := df.Dims(); cN != 2 {
+		t.Fatalf("cols: got %d, want 2", cN)
+	}
+
+	if _, err := store.GetSheet("spread", "missing", "A1:Z", nil); err == nil {
+		t.Fatal("expected error for missing sheet")
+	}
+}
+
+func TestMemorySheetStore(t *testing.T) {
+	store := NewMemorySheetStore()
+	store.SetSheet("spread", "tweets", storeRows)
+	testSheetStore(t, store)
+}
+
+func TestCSVSheetStore(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "spread"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCSV(filepath.Join(dir, "spread", "tweets.csv"), storeRows); err != nil {
+		t.Fatal(err)
+	}
+	testSheetStore(t, NewCSVSheetStore(dir))
+}
+
+func TestParseA1Range(t *testing.T) {
+	cases := []struct {
+		in                                 string
+		startCol, startRow, endCol, endRow int
+	}{
+		{"A1:Z", 1, 1, 26, 0},
+		{"sheet!B2:AA2", 2, 2, 27, 2},
+		{"C", 3, 0, 0, 0},
+	}
+	for _, c := range cases {
+		sc, sr, ec, er, err := parseA1Range(c.in)
+		if err != nil {
+			t.Fatalf("%s: %v", c.in, err)
+		}
+		if sc != c.startCol || sr != c.startRow || ec != c.endCol || er != c.endRow {
+			t.Fatalf("%s: got %d,%d,%d,%d", c.in, sc, sr, ec, er)
+		}
+	}
+}
+
+// TestWriteCells 範囲外のセル・空のシートでpanicせず、エラーを返すこと
+func TestWriteCells(t *testing.T) {
+	cases := []struct {
+		name    string
+		rows    [][]string
+		cells   []Cell
+		want    [][]string
+		wantErr bool
+	}{
+		{"update", [][]string{{"a", "b"}, {"1"}}, []Cell{{Row: 2, Column: 2, Value: 2}}, [][]string{{"a", "b"}, {"1", "2"}}, false},
+		{"append row", [][]string{{"a", "b"}}, []Cell{{Row: 3, Column: 1, Value: "x"}}, [][]string{{"a", "b"}, {"", ""}, {"x", ""}}, false},
+		{"empty sheet", nil, []Cell{{Row: 1, Column: 2, Value: "x"}}, [][]string{{"", "x"}}, false},
+		{"empty sheet no cells", nil, nil, nil, false},
+		{"row 0", [][]string{{"a"}}, []Cell{{Row: 0, Column: 1, Value: "x"}}, nil, true},
+		{"column 0", [][]string{{"a"}}, []Cell{{Row: 1, Column: 0, Value: "x"}}, nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := writeCells(c.rows, c.cells)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err: %v, wantErr: %v", err, c.wantErr)
+			}
+			if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+// TestToStructExtra 対応するフィールドのない列を"*"のフィールドに格納すること
+func TestToStructExtra(t *testing.T) {
+	type row struct {
+		Index int               `csv:"index"`
+		Extra map[string]string `csv:"*"`
+	}
+	var list []row
+	data := [][]string{
+		{"index", "campaign", "url"},
+		{"1", "spring", "https://example.com"},
+	}
+	if err := ToStruct(data, &list); err != nil {
+		t.Fatal(err)
+	}
+	want := []row{{1, map[string]string{"campaign": "spring", "url": "https://example.com"}}}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("got %+v, want %+v", list, want)
+	}
+}
@@ -3,12 +3,211 @@ package libs
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 
 	"github.com/go-gota/gota/dataframe"
 	"github.com/rs/zerolog/log"
 	ss "google.golang.org/api/sheets/v4"
 )
 
+var (
+	// ErrRowNotFound 指定キーの行が存在しない（削除・キー変更された）
+	ErrRowNotFound = errors.New("row not found by key")
+	// ErrRowDuplicated 指定キーの行が複数存在し、更新対象を特定できない
+	ErrRowDuplicated = errors.New("row key is duplicated")
+	// ErrColumnNotFound 書き込む列がSheetにない
+	ErrColumnNotFound = errors.New("sheet has no column")
+)
+
+// FindRowByKey keyColumn列の値がkeyである行を探し、Dataframeの行番号（0始まり、Headerを除く）を返す
+// why: 取得から書き込みまでの間に並べ替え・挿入が行われても、行番号ではなくキーで更新対象を特定するため
+func FindRowByKey(df dataframe.DataFrame, keyColumn, key string) (int, error) {
+	var hasColumn bool
+	for _, name := range df.Names() {
+		if name == keyColumn {
+			hasColumn = true
+			break
+		}
+	}
+	if !hasColumn {
+		return 0, fmt.Errorf("sheet has no key column: %s", keyColumn)
+	}
+
+	rowN := -1
+	records := df.Col(keyColumn).Records()
+	for i := 0; i < len(records); i++ {
+		if Trim(records[i]) != key {
+			continue
+		}
+		if rowN != -1 {
+			return 0, SetError(ErrRowDuplicated, fmt.Sprintf("%s: %s", keyColumn, key))
+		}
+		rowN = i
+	}
+	if rowN == -1 {
+		return 0, SetError(ErrRowNotFound, fmt.Sprintf("%s: %s", keyColumn, key))
+	}
+
+	return rowN, nil
+}
+
+// Cell 更新対象のセル
+// Row・ColumnはHeaderを含むSpreadsheet上の番号（1始まり）
+type Cell struct {
+	Row    int
+	Column int
+	Value  interface{}
+}
+
+// RangeKey セルのA1形式の範囲 例: "sheet!C5"
+func (c Cell) RangeKey(sheetTitle string) string {
+	return fmt.Sprintf("%s!%s%d", sheetTitle, ToAlphabet(c.Column), c.Row)
+}
+
+// UpdateCells Google spreadsheetの指定セルのみを更新する
+// 行全体を上書きしないため、対象外の列の数式・書式は保持される
+// 値はSpreadsheetで入力した場合と同様に解釈する（USER_ENTERED） why: 日付を文字列ではなく日付として書き込むため
+func UpdateCells(credByte []byte, spreadID, sheetTitle string, cells []Cell) error {
+	if len(cells) == 0 {
+		return nil
+	}
+
+	serv, err := NewSpreadClient(credByte)
+	if err != nil {
+		return SetError(err, errors.New("create spread client error"))
+	}
+
+	data := make([]*ss.ValueRange, 0, len(cells))
+	for _, c := range cells {
+		data = append(data, &ss.ValueRange{
+			Range:          c.RangeKey(sheetTitle),
+			MajorDimension: "ROWS",
+			Values:         [][]interface{}{{c.Value}},
+		})
+	}
+
+	if _, err := serv.Spreadsheets.Values.BatchUpdate(spreadID, &ss.BatchUpdateValuesRequest{
+		Data:             data,
+		ValueInputOption: "USER_ENTERED",
+	}).Do(); err != nil {
+		return SetError(err, errors.New("update spreadsheet cells "+sheetTitle+" error"))
+	}
+
+	return nil
+}
+
+// TagValues 構造体からcsvタグで指定したフィールドの値を取得する
+// ‐ ToStructと同じcsvタグで読み書きの列を対応させる
+func TagValues(src any, tags ...string) (map[string]interface{}, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errors.New("src must be a struct or a pointer to a struct")
+	}
+
+	fields := make(map[string]int)
+	for i := 0; i < v.NumField(); i++ {
+		fields[v.Type().Field(i).Tag.Get("csv")] = i
+	}
+
+	values := make(map[string]interface{}, len(tags))
+	for _, tag := range tags {
+		i, ok := fields[tag]
+		if !ok {
+			return nil, fmt.Errorf("no field tagged csv:%q", tag)
+		}
+		values[tag] = v.Field(i).Interface()
+	}
+
+	return values, nil
+}
+
+// CellsByHeader Header名から列を特定し、更新するセルを返す
+// rangeKeyはSheetの取得範囲（HeaderがrangeKeyの先頭行・先頭列から始まる） rowNはDataframeの行番号（0始まり、Headerを除く）
+// why: 列の追加・並べ替えがあっても、列名で書き込み先を特定するため
+func CellsByHeader(rangeKey string, headers []string, rowN int, values map[string]interface{}) ([]Cell, error) {
+	startCol, startRow, err := rangeOrigin(rangeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(headers))
+	for i, h := range headers {
+		columns[h] = startCol + i
+	}
+
+	var cells []Cell
+	for name, value := range values {
+		col, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrColumnNotFound, name)
+		}
+		cells = append(cells, Cell{
+			// 範囲の先頭行にはColumn_Nameが入っているため+1
+			Row:    startRow + rowN + 1,
+			Column: col,
+			Value:  value,
+		})
+	}
+	sort.Slice(cells, func(i, j int) bool { return cells[i].Column < cells[j].Column })
+
+	return cells, nil
+}
+
+// rangeOrigin 取得範囲の先頭の列・行（1始まり） 範囲・行の指定がない場合は1
+func rangeOrigin(rangeKey string) (col, row int, err error) {
+	if rangeKey == "" {
+		return 1, 1, nil
+	}
+	col, row, _, _, err = parseA1Range(rangeKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	if row == 0 {
+		row = 1
+	}
+	return col, row, nil
+}
+
+// UpdateCellsByKey keyColumn列の値がkeyである行を書き込み直前に再取得して特定し、values（列名: 値）のセルのみを更新する
+// guard（列名: 値）が指定された場合、特定した行の値が一致しなければ上書きしない
+// 戻り値は更新したDataframeの行番号（0始まり、Headerを除く）
+func UpdateCellsByKey(store SheetStore, ref SheetRef, keyColumn, key string, guard map[string]string, values map[string]interface{}) (int, error) {
+	df, err := ref.Get(store, nil)
+	if err != nil {
+		return 0, SetError(err, "failed to re-read sheet")
+	}
+
+	rowN, err := FindRowByKey(df, keyColumn, key)
+	if err != nil {
+		return 0, SetError(err, "refuse to update, row vanished or ambiguous")
+	}
+
+	for col, want := range guard {
+		cells := df.Col(col)
+		if cells.Err != nil {
+			return 0, SetError(cells.Err, "refuse to update, no guard column "+col)
+		}
+		if got := Trim(cells.Records()[rowN]); got != want {
+			return 0, fmt.Errorf("refuse to update, %s: %s has %s %q, want %q", keyColumn, key, col, got, want)
+		}
+	}
+
+	cells, err := CellsByHeader(ref.RangeKey, df.Names(), rowN, values)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := store.UpdateCells(ref.SpreadID, ref.SheetTitle, cells); err != nil {
+		return 0, err
+	}
+
+	return rowN, nil
+}
+
 // UpdateRow Google spreadsheetの指定行を更新する
 // 必ずSheetTitle・RangeKeyを指定すること
 // SubsetToUpdateRowWithRangeKeyを使い、RangeKeyとRowを抽出するこことを推奨
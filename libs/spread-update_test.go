@@ -1,8 +1,11 @@
 package libs
 
 import (
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/go-gota/gota/dataframe"
 )
 
 // func TestUpdateCell(t *testing.T) error {
@@ -45,3 +48,94 @@ func TestUpload(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFindRowByKey(t *testing.T) {
+	df := dataframe.LoadRecords([][]string{
+		{"index", "text"},
+		{"3", "c"},
+		{"1", "a"},
+		{"2", "b"},
+		{"2", "b-copy"},
+	})
+
+	rowN, err := FindRowByKey(df, "index", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowN != 1 {
+		t.Fatalf("row: got %d, want 1", rowN)
+	}
+
+	if _, err := FindRowByKey(df, "index", "9"); err == nil || !strings.Contains(err.Error(), ErrRowNotFound.Error()) {
+		t.Fatalf("vanished row: got %v", err)
+	}
+	if _, err := FindRowByKey(df, "index", "2"); err == nil || !strings.Contains(err.Error(), ErrRowDuplicated.Error()) {
+		t.Fatalf("duplicated row: got %v", err)
+	}
+	if _, err := FindRowByKey(df, "id", "1"); err == nil {
+		t.Fatal("expected error for missing key column")
+	}
+}
+
+func TestUpdateCellsByKey(t *testing.T) {
+	store := NewMemorySheetStore()
+	store.SetSheet("spread", "tweets", [][]string{
+		{"index", "twitter_id", "count", "last_date", "note"},
+		{"2", "user", "1", "", "=A2"},
+		{"1", "user", "0", "", "memo"},
+	})
+
+	ref := SheetRef{SpreadID: "spread", SheetTitle: "tweets", RangeKey: "A1:Z"}
+	values, err := TagValues(storeRow{Index: 1, Text: "first", Count: 5}, "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rowN, err := UpdateCellsByKey(store, ref, "index", "1", map[string]string{"twitter_id": "user"}, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowN != 1 {
+		t.Fatalf("row: got %d, want 1", rowN)
+	}
+
+	rows := store.Sheet("spread", "tweets")
+	if rows[2][2] != "5" || rows[1][2] != "1" {
+		t.Fatalf("count: got %v", rows)
+	}
+	// 対象外の列は変更しない
+	if rows[1][4] != "=A2" || rows[2][4] != "memo" {
+		t.Fatalf("note: got %v", rows)
+	}
+
+	// 別アカウントの行は上書きしない
+	if _, err := UpdateCellsByKey(store, ref, "index", "1", map[string]string{"twitter_id": "other"}, values); err == nil {
+		t.Fatal("expected error for guard mismatch")
+	}
+	// 存在しない列は書き込まない
+	if _, err := UpdateCellsByKey(store, ref, "index", "1", nil, map[string]interface{}{"tweet_url": "x"}); err == nil {
+		t.Fatal("expected error for missing column")
+	}
+}
+
+func TestCellsByHeader(t *testing.T) {
+	cases := []struct {
+		rangeKey string
+		want     [2]string
+	}{
+		{"A1:Z", [2]string{"tweets!B5", "tweets!D5"}},
+		{"", [2]string{"tweets!B5", "tweets!D5"}},
+		{"A:Z", [2]string{"tweets!B5", "tweets!D5"}},
+		// 範囲がA1から始まらない場合は、範囲の先頭からの位置
+		{"B3:Z", [2]string{"tweets!C7", "tweets!E7"}},
+		{"tweets!C10:Z", [2]string{"tweets!D14", "tweets!F14"}},
+	}
+	for _, c := range cases {
+		cells, err := CellsByHeader(c.rangeKey, []string{"index", "count", "note", "last_date"}, 3, map[string]interface{}{"last_date": "d", "count": 1})
+		if err != nil {
+			t.Fatalf("%s: %v", c.rangeKey, err)
+		}
+		if len(cells) != 2 || cells[0].RangeKey("tweets") != c.want[0] || cells[1].RangeKey("tweets") != c.want[1] {
+			t.Fatalf("%s: got %+v", c.rangeKey, cells)
+		}
+	}
+}
@@ -58,12 +58,6 @@ func GetSheet(credByte []byte, spreadID, sheetTitle, rangekey string, bindList a
 	}
 	log.Debug().Msgf("len(rows/row): %d/%d, last row: %s", len(rows), len(rows[len(rows)-1]), rows[len(rows)-1])
 
-	// LoadRecordsで配列をDataframeに読み込む
-	df = dataframe.LoadRecords(rows)
-	// 指定の型にBingする
-	if err := ToStruct(df.Records(), bindList); err != nil {
-		return df, SetError(err, "failed to bind list")
-	}
-
-	return df, nil
+	// LoadRecordsで配列をDataframeに読み込み、指定の型にBindする
+	return recordsToDataframe(rows, bindList)
 }
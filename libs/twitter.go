@@ -9,8 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/michimani/gotwi"
@@ -19,6 +19,9 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// ErrTweetNotFound 削除するTweetが存在しない（削除済みなど）
+var ErrTweetNotFound = errors.New("tweet not found")
+
 type Box interface {
 	Keys() (id, consumerKey, consumerSecret, accessToken, accessTokenSecret string)
 }
@@ -37,27 +40,42 @@ func (a TwitterAccount) Keys() (id, consumerKey, consumerSecret, accessToken, ac
 
 // LoggingInterceptor リクエスト前後に処理を追加する
 // ‐ ヘッダー情報を取得する
+// ‐ アカウントごとのクライアント（Clients）でリクエストする
+// 複数のgoroutineから同時に使用できる
 type LoggingInterceptor struct {
 	Transport http.RoundTripper
+	Clients   *TwitterClients
+
+	mu        sync.Mutex
 	XLimit    int
 	XResetSec int
 }
 
 func NewLoggingInterceptor() *LoggingInterceptor {
-	return &LoggingInterceptor{
+	li := &LoggingInterceptor{
 		Transport: http.DefaultTransport,
 		XLimit:    10,
 		XResetSec: 15 * 60,
 	}
+	// トランスポートを設定しリクエスト前後に処理を追加する
+	li.Clients = NewTwitterClients(li)
+	return li
 }
 
 func (li *LoggingInterceptor) RoundTrip(req *http.Request) (*http.Response, error) {
 	// リクエスト前のロジック
 	// API レートリミットでリクエストを制限する
 	// API Limitが少ないときにエラーを出し続けると、API Limitが復活するための情報を得られないため、
-	if li.XLimit != 0 && li.XLimit <= 1 {
+	li.mu.Lock()
+	limited := li.XLimit != 0 && li.XLimit <= 1
+	li.mu.Unlock()
+	if limited {
 		// 待機し過ぎにならないように、リクエストを制限する
-		time.Sleep(time.Duration(15) * time.Second)
+		if err := Sleep(req.Context(), time.Duration(15)*time.Second); err != nil {
+			return nil, err
+		}
+		li.mu.Lock()
+		defer li.mu.Unlock()
 		li.XResetSec -= 15
 		if li.XResetSec <= 0 {
 			// リセット時間が過ぎた場合は、リミットをリセットする
@@ -74,45 +92,26 @@ func (li *LoggingInterceptor) RoundTrip(req *http.Request) (*http.Response, erro
 	}
 
 	// HeaderからAPI レートリミット情報を取得する
-	s := resp.Header.Get("x-rate-limit-remaining")
-	li.XLimit, _ = strconv.Atoi(s)
-	s = resp.Header.Get("x-rate-limit-reset")
-	li.XResetSec, _ = strconv.Atoi(s)
-	log.Info().Msgf("x-rate-limit-remaining: %d, x-rate-limit-reset: %d", li.XLimit, li.XResetSec)
+	limit, _ := strconv.Atoi(resp.Header.Get("x-rate-limit-remaining"))
+	reset, _ := strconv.Atoi(resp.Header.Get("x-rate-limit-reset"))
+	li.mu.Lock()
+	li.XLimit, li.XResetSec = limit, reset
+	li.mu.Unlock()
+	log.Info().Msgf("x-rate-limit-remaining: %d, x-rate-limit-reset: %d", limit, reset)
 
 	return resp, nil
 }
 
-func (li *LoggingInterceptor) Tweeting(is_post bool, account Box, req *mtypes.CreateInput) (*mtypes.CreateOutput, error) {
-	id, consumersurKey, consumersurSecret, accessToken, accessTokenSecret := account.Keys()
-	if err := os.Setenv("GOTWI_API_KEY", consumersurKey); err != nil {
-		return nil, SetError(err, errors.New("failed to set env GOTWI_API_KEY"))
-	}
-	if err := os.Setenv("GOTWI_API_KEY_SECRET", consumersurSecret); err != nil {
-		return nil, SetError(err, errors.New("failed to set env GOTWI_API_KEY_SECRET"))
-	}
-
-	in := &gotwi.NewClientInput{
-		AuthenticationMethod: gotwi.AuthenMethodOAuth1UserContext,
-		OAuthToken:           accessToken,
-		OAuthTokenSecret:     accessTokenSecret,
-	}
-
-	fmt.Printf("---------\napi key: %s, secret: %s, access token: %s, access secret: %s\n----------\n", os.Getenv("GOTWI_API_KEY"), os.Getenv("GOTWI_API_KEY_SECRET"), accessToken, accessTokenSecret)
-
-	c, err := gotwi.NewClient(in)
+func (li *LoggingInterceptor) Tweeting(ctx context.Context, is_post bool, account Box, req *mtypes.CreateInput) (*mtypes.CreateOutput, error) {
+	id, _, _, _, _ := account.Keys()
+	c, err := li.Clients.V2(account)
 	if err != nil {
-		return nil, SetError(err, errors.New("failed to create a new client"))
+		return nil, err
 	}
 
-	// トランスポートを設定しリクエスト前後に処理を追加する
-	// ‐ ヘッダー情報を取得する
-	c.Client.Transport = li
-
 	if !is_post {
 		return nil, fmt.Errorf("[定数設定] not post, program constants limit posting privileges, request, %s -> %s", id, *req.Text)
 	}
-	ctx := context.Background()
 	res, err := managetweet.Create(ctx, c, req)
 	if err != nil {
 		return nil, SetError(err, errors.New("failed to tweet"))
@@ -123,30 +122,25 @@ func (li *LoggingInterceptor) Tweeting(is_post bool, account Box, req *mtypes.Cr
 	return res, nil
 }
 
-func Delete(account Box, req *mtypes.DeleteInput) error {
-	id, consumersurKey, consumersurSecret, accessToken, accessTokenSecret := account.Keys()
-	if err := os.Setenv("GOTWI_API_KEY", consumersurKey); err != nil {
-		return SetError(err, errors.New("failed to set env GOTWI_API_KEY"))
-	}
-	if err := os.Setenv("GOTWI_API_KEY_SECRET", consumersurSecret); err != nil {
-		return SetError(err, errors.New("failed to set env GOTWI_API_KEY_SECRET"))
-	}
-
-	in := &gotwi.NewClientInput{
-		AuthenticationMethod: gotwi.AuthenMethodOAuth1UserContext,
-		OAuthToken:           accessToken,
-		OAuthTokenSecret:     accessTokenSecret,
-	}
-
-	c, err := gotwi.NewClient(in)
+// Delete Clientsのクライアントで、TwitterAPIでTweetを削除する
+// Tweetが存在しない場合はErrTweetNotFoundを返す why: 削除済みのTweetを削除した場合と区別するため
+func (li *LoggingInterceptor) Delete(ctx context.Context, account Box, req *mtypes.DeleteInput) error {
+	id, _, _, _, _ := account.Keys()
+	c, err := li.Clients.V2(account)
 	if err != nil {
-		return SetError(err, errors.New("failed to create a new client"))
+		return err
 	}
 
-	ctx := context.Background()
 	res, err := managetweet.Delete(ctx, c, req)
 	if err != nil {
-		return SetError(err, errors.New("failed to tweet"))
+		var gerr *gotwi.GotwiError
+		if errors.As(err, &gerr) && gerr.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %s", ErrTweetNotFound, req.ID)
+		}
+		return SetError(err, errors.New("failed to delete tweet"))
+	}
+	if res.Data.Deleted == nil || !*res.Data.Deleted {
+		return fmt.Errorf("tweet not deleted: %s", req.ID)
 	}
 
 	log.Debug().Msgf("account: %s -> deleted success: %t", id, *res.Data.Deleted)
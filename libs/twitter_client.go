@@ -0,0 +1,129 @@
+package libs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+	"github.com/michimani/gotwi"
+)
+
+// TWITTERTIMEOUT TwitterAPIのリクエストの待機時間の上限
+const TWITTERTIMEOUT = 30 * time.Second
+
+// defaultTwitterClients LoggingInterceptorを使わない処理（v1.1 API）のクライアント
+var defaultTwitterClients = NewTwitterClients(nil)
+
+// TwitterClients アカウントごとのTwitterAPIクライアントを作成し、再利用する
+// why: gotwiは環境変数、anacondaはパッケージの変数からConsumer Keyを読むため、
+// 並行して投稿すると別のアカウントのConsumer Keyで署名されることがある
+// ‐ Consumer Key・Access Tokenを明示してOAuth1で署名し、環境変数・パッケージの変数を使わない
+// ‐ アカウントのキーが変わった場合は作り直す 古いv1.1のクライアントは使用中の処理が終わってから閉じる
+// 複数のgoroutineから同時に使用できる
+type TwitterClients struct {
+	transport http.RoundTripper
+
+	mu      sync.Mutex
+	clients map[string]*twitterClient
+}
+
+// twitterClient 1アカウントのクライアント
+type twitterClient struct {
+	keys [4]string
+	v2   *gotwi.Client
+	v1   *anaconda.TwitterApi
+	// v1を使用中の処理の数と、置き換えられたか TwitterClients.muで保護する
+	// why: anacondaのクライアントは閉じるまで処理（goroutine）が残るため、使用中でなくなってから閉じる
+	users    int
+	replaced bool
+}
+
+// NewTwitterClients transportでリクエストするクライアントを作成する nilの場合はhttp.DefaultTransport
+func NewTwitterClients(transport http.RoundTripper) *TwitterClients {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &TwitterClients{transport: transport, clients: make(map[string]*twitterClient)}
+}
+
+// V2 アカウントのTwitter API v2のクライアント
+func (c *TwitterClients) V2(account Box) (*gotwi.Client, error) {
+	tc, err := c.get(account, false)
+	if err != nil {
+		return nil, err
+	}
+	return tc.v2, nil
+}
+
+// V1 アカウントのTwitter API v1.1のクライアント
+// 使用後にreleaseを呼び出すこと キーが変わって置き換えられたクライアントは、全てのreleaseの後に閉じる
+func (c *TwitterClients) V1(account Box) (id string, api *anaconda.TwitterApi, release func(), err error) {
+	tc, err := c.get(account, true)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	id, _, _, _, _ = account.Keys()
+	release = sync.OnceFunc(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		tc.users--
+		if tc.replaced && tc.users == 0 {
+			tc.v1.Close()
+		}
+	})
+	return id, tc.v1, release, nil
+}
+
+// get アカウントのクライアント 作成済みでキーが同じ場合は再利用する
+// useV1の場合はv1を使用中として数える
+func (c *TwitterClients) get(account Box, useV1 bool) (*twitterClient, error) {
+	id, consumerKey, consumerSecret, accessToken, accessTokenSecret := account.Keys()
+	keys := [4]string{consumerKey, consumerSecret, accessToken, accessTokenSecret}
+	for _, k := range keys {
+		if k == "" {
+			return nil, fmt.Errorf("missing consumer key or access token, %s", id)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, ok := c.clients[id]
+	if ok && old.keys == keys {
+		if useV1 {
+			old.users++
+		}
+		return old, nil
+	}
+
+	v2 := &gotwi.Client{Client: &http.Client{Transport: c.transport, Timeout: TWITTERTIMEOUT}}
+	v2.SetAuthenticationMethod(gotwi.AuthenMethodOAuth1UserContext)
+	v2.SetOAuthConsumerKey(consumerKey)
+	v2.SetOAuthToken(accessToken)
+	v2.SetSigningKey(url.QueryEscape(consumerSecret) + "&" + url.QueryEscape(accessTokenSecret))
+	if !v2.IsReady() {
+		return nil, SetError(errors.New("client is not ready"), fmt.Sprintf("failed to create a new client, %s", id))
+	}
+
+	v1 := anaconda.NewTwitterApiWithCredentials(accessToken, accessTokenSecret, consumerKey, consumerSecret)
+	v1.HttpClient = &http.Client{Transport: c.transport, Timeout: TWITTERTIMEOUT}
+
+	// キーが変わった場合は置き換え、古いクライアントは使用中でなければ閉じる
+	// why: 他のgoroutineが使用中のクライアントを閉じると、実行中の処理がpanicする
+	if ok {
+		old.replaced = true
+		if old.users == 0 {
+			old.v1.Close()
+		}
+	}
+
+	tc := &twitterClient{keys: keys, v2: v2, v1: v1}
+	if useV1 {
+		tc.users++
+	}
+	c.clients[id] = tc
+	return tc, nil
+}
@@ -0,0 +1,220 @@
+package libs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+	mtypes "github.com/michimani/gotwi/tweet/managetweet/types"
+)
+
+// rewriteTransport api.twitter.comへのリクエストをテスト用のサーバーに送る
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// oauthParams Authorizationヘッダーのパラメータ
+func oauthParams(header string) map[string]string {
+	params := make(map[string]string)
+	for _, kv := range strings.Split(strings.TrimPrefix(header, "OAuth "), ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		v, _ = url.QueryUnescape(strings.Trim(v, `"`))
+		params[k] = v
+	}
+	return params
+}
+
+// oauthSignature OAuth1（HMAC-SHA1）の署名 JSONのリクエストのため、Bodyは署名に含めない
+func oauthSignature(method, endpoint string, params map[string]string, consumerSecret, tokenSecret string) string {
+	var pairs []string
+	for k, v := range params {
+		if k != "oauth_signature" {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	base := method + "&" + url.QueryEscape(endpoint) + "&" + url.QueryEscape(strings.Join(pairs, "&"))
+	mac := hmac.New(sha1.New, []byte(url.QueryEscape(consumerSecret)+"&"+url.QueryEscape(tokenSecret)))
+	mac.Write([]byte(base))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestTwitterClientsConcurrent(t *testing.T) {
+	accounts := map[string]TwitterAccount{
+		"token-a": {ID: "a", ConsumerKey: "key-a", ConsumerSecret: "secret-a", AccessToken: "token-a", AccessTokenSecret: "token-secret-a"},
+		"token-b": {ID: "b", ConsumerKey: "key-b", ConsumerSecret: "secret-b", AccessToken: "token-b", AccessTokenSecret: "token-secret-b"},
+	}
+
+	var (
+		mu     sync.Mutex
+		errs   []string
+		counts = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		params := oauthParams(r.Header.Get("Authorization"))
+		account, ok := accounts[params["oauth_token"]]
+
+		mu.Lock()
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("unknown token: %q", params["oauth_token"]))
+		case !strings.HasPrefix(body.Text, account.ID+":"):
+			errs = append(errs, fmt.Sprintf("token of %s, text: %q", account.ID, body.Text))
+		case params["oauth_consumer_key"] != account.ConsumerKey:
+			errs = append(errs, fmt.Sprintf("consumer key of %s: %q", account.ID, params["oauth_consumer_key"]))
+		case params["oauth_signature"] != oauthSignature(r.Method, "https://api.twitter.com"+r.URL.Path, params, account.ConsumerSecret, account.AccessTokenSecret):
+			errs = append(errs, fmt.Sprintf("invalid signature of %s: %q", account.ID, body.Text))
+		default:
+			counts[account.ID]++
+		}
+		mu.Unlock()
+
+		w.Header().Set("x-rate-limit-remaining", "100")
+		w.Header().Set("x-rate-limit-reset", "900")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"data":{"id":"1","text":%q}}`, body.Text)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	li := NewLoggingInterceptor()
+	li.Transport = rewriteTransport{target: target}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for _, account := range accounts {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(account TwitterAccount, i int) {
+				defer wg.Done()
+				text := fmt.Sprintf("%s: %d", account.ID, i)
+				if _, err := li.Tweeting(context.Background(), true, account, &mtypes.CreateInput{Text: &text}); err != nil {
+					t.Error(err)
+				}
+			}(account, i)
+		}
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Fatalf("signed with another account's keys:\n%s", strings.Join(errs, "\n"))
+	}
+	if counts["a"] != n || counts["b"] != n {
+		t.Fatalf("got %v, want %d each", counts, n)
+	}
+}
+
+func TestTwitterClientsCache(t *testing.T) {
+	clients := NewTwitterClients(nil)
+	a := TwitterAccount{ID: "a", ConsumerKey: "key-a", ConsumerSecret: "secret-a", AccessToken: "token-a", AccessTokenSecret: "token-secret-a"}
+	b := TwitterAccount{ID: "b", ConsumerKey: "key-b", ConsumerSecret: "secret-b", AccessToken: "token-b", AccessTokenSecret: "token-secret-b"}
+
+	a1, err := clients.V2(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a2, _ := clients.V2(a); a2 != a1 {
+		t.Fatal("client of the same account is not reused")
+	}
+	if b1, _ := clients.V2(b); b1 == a1 || b1.OAuthConsumerKey() != "key-b" || b1.SigningKey() != "secret-b&token-secret-b" {
+		t.Fatalf("client of another account is shared or has wrong keys: %q", b1.OAuthConsumerKey())
+	}
+	_, v1, release, err := clients.V1(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if v1.Credentials.Token != "token-b" {
+		t.Fatalf("v1 token: %q", v1.Credentials.Token)
+	}
+
+	// キーが変わった場合は作り直す
+	a.AccessToken = "token-a2"
+	if a3, _ := clients.V2(a); a3 == a1 || a3.OAuthToken() != "token-a2" {
+		t.Fatal("client is not recreated after keys changed")
+	}
+
+	// キーが空の場合はエラー
+	if _, err := clients.V2(TwitterAccount{ID: "c", ConsumerKey: "key-c"}); err == nil {
+		t.Fatal("want error for missing keys")
+	}
+}
+
+// closed anacondaのクライアントが閉じられたか 閉じたクライアントでリクエストするとpanicする
+func closed(api *anaconda.TwitterApi) (ok bool) {
+	defer func() { ok = recover() != nil }()
+	api.GetSelf(nil)
+	return false
+}
+
+// TestTwitterClientsReplace キーが変わっても、古いクライアントを使用中の処理は続けられ、
+// 全ての使用が終わってから古いクライアントを閉じること
+func TestTwitterClientsReplace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id_str":"1"}`)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	clients := NewTwitterClients(rewriteTransport{target: target})
+	a := TwitterAccount{ID: "a", ConsumerKey: "key-a", ConsumerSecret: "secret-a", AccessToken: "token-a", AccessTokenSecret: "token-secret-a"}
+	_, old, releaseOld, err := clients.V1(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.AccessToken = "token-a2"
+	_, v1, release, err := clients.V1(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if v1 == old || v1.Credentials.Token != "token-a2" {
+		t.Fatal("client is not recreated after keys changed")
+	}
+	// 使用中の古いクライアントは閉じない
+	if u, err := old.GetSelf(nil); err != nil || u.IdStr != "1" {
+		t.Fatalf("old client: %+v, %v", u, err)
+	}
+
+	// 使用が終わると閉じる releaseを繰り返し呼び出しても1回のみ数える
+	releaseOld()
+	releaseOld()
+	if !closed(old) {
+		t.Fatal("old client is not closed after release")
+	}
+	if closed(v1) {
+		t.Fatal("current client is closed")
+	}
+
+	// 使用中でなければ、置き換えた時点で閉じる
+	a.AccessToken = "token-a3"
+	release()
+	if _, err := clients.V2(a); err != nil {
+		t.Fatal(err)
+	}
+	if !closed(v1) {
+		t.Fatal("unused client is not closed after keys changed")
+	}
+}
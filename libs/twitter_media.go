@@ -1,6 +1,7 @@
 package libs
 
 import (
+	"context"
 	"encoding/base64"
 	"io"
 	"os"
@@ -13,18 +14,28 @@ import (
 
 // TweetUpload メディアアップロード -> メディアIDを返す
 // Twitter v1.1 API
-func TweetUpload(account Box, files []string) []string {
+// ctxが終了した場合は残りのファイルをアップロードしない
+func TweetUpload(ctx context.Context, account Box, files []string) []string {
 	log.Debug().Str("function", "TweetUpload").Msgf("get files: %dfiles, %v", len(files), files)
 	if len(files) == 0 {
 		return nil
 	}
 
-	_, api := newClientV1(account)
+	_, api, release, err := defaultTwitterClients.V1(account)
+	if err != nil {
+		log.Err(err).Str("function", "TweetUpload").Msg("failed to create a client")
+		return nil
+	}
+	defer release()
 
 	var (
 		medias []string
 	)
 	for i := 0; i < len(files); i++ {
+		if err := ctx.Err(); err != nil {
+			log.Err(err).Msgf("canceled to upload media, %s", files[i])
+			break
+		}
 		// メディアファイルのみを抽出
 		if strings.HasSuffix(files[i], ".jpg") ||
 			strings.HasSuffix(files[i], ".png") ||
@@ -45,7 +56,7 @@ func TweetUpload(account Box, files []string) []string {
 		} else if strings.HasSuffix(files[i], ".mp4") ||
 			strings.HasSuffix(files[i], ".mov") {
 			// Video upload
-			media, err := UploadVideo(*api, files[i])
+			media, err := UploadVideo(ctx, *api, files[i])
 			if err != nil {
 				log.Err(err).Msgf("failed to upload video, %s", files[i])
 				continue
@@ -74,7 +85,7 @@ func ToBase64(filename string) (string, error) {
 	return base64.StdEncoding.EncodeToString(b), nil
 }
 
-func UploadVideo(api anaconda.TwitterApi, filename string) (string, error) {
+func UploadVideo(ctx context.Context, api anaconda.TwitterApi, filename string) (string, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return "", err
@@ -104,6 +115,9 @@ func UploadVideo(api anaconda.TwitterApi, filename string) (string, error) {
 	var segmentIndex int
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return "", SetError(err, "canceled to upload video append")
+		}
 		bytesRead, err := f.Read(buffer)
 		if err != nil && err != io.EOF {
 			return "", SetError(err, "failed to read file")
@@ -124,7 +138,9 @@ func UploadVideo(api anaconda.TwitterApi, filename string) (string, error) {
 		return "", SetError(err, "failed to upload video finalize")
 	}
 
-	time.Sleep(10 * time.Second)
+	if err := Sleep(ctx, 10*time.Second); err != nil {
+		return "", SetError(err, "canceled to wait video processing")
+	}
 	log.Debug().Msgf("video uploaded to twitter, %s", media.MediaIDString)
 	log.Debug().Msgf("%v, %d", result.Video.VideoType, result.Size)
 
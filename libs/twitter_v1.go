@@ -6,19 +6,13 @@ import (
 	"github.com/ChimeraCoder/anaconda"
 )
 
-func newClientV1(account Box) (string, *anaconda.TwitterApi) {
-	twitterID, consumerKey, consumerSecret, accessToken, accessTokenSecret := account.Keys()
-
-	anaconda.SetConsumerKey(consumerKey)
-	anaconda.SetConsumerSecret(consumerSecret)
-	api := anaconda.NewTwitterApi(accessToken, accessTokenSecret)
-
-	return twitterID, api
-}
-
 // GetTweets Twitterのユーザータイムラインを取得
 func GetTweets(account Box) ([]anaconda.Tweet, error) {
-	twitterID, api := newClientV1(account)
+	twitterID, api, release, err := defaultTwitterClients.V1(account)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	u := url.Values{}
 	u.Add("screen_name", twitterID)
@@ -0,0 +1,311 @@
+/*
+Package twittertext Xの投稿の重み付き文字数（twitter-text v2・v3互換）
+
+  - 文字ごとの重み: Rangesの範囲（ラテン文字・記号など）は1、それ以外（日本語など）は2
+  - URLは長さにかかわらず23
+  - 絵文字は結合（ZWJ・肌の色・国旗・キーキャップ）を含めた1つを2 V2ではコードポイントごとに数える
+  - NFC正規化した後に数える
+  - 上限は280 日本語のみの場合は140文字
+
+URLはscheme（http://・https://）のあるものと、schemeのないもの（example.com）を数える
+schemeのないURLは、TLDがPublic Suffix ListのICANNの項目にあるドメインに限る
+‐ twitter-textと同様に、パスのない「ドメイン1つ.国別TLD」（example.jp）はURLとしない（.co・.tvを除く）
+*/
+package twittertext
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Range 重みがConfig.DefaultWeightと異なる文字の範囲（コードポイント、両端を含む）
+type Range struct {
+	Start  rune
+	End    rune
+	Weight int
+}
+
+// Config 重み付き文字数の設定
+type Config struct {
+	// 重み付き文字数の上限
+	MaxWeightedTweetLength int
+	// 重みの単位 重み/Scaleが1文字
+	Scale int
+	// Rangesに含まれない文字・絵文字の重み
+	DefaultWeight int
+	// URL1つの文字数
+	TransformedURLLength int
+	// 絵文字を結合を含めた1つとして数える falseの場合はコードポイントごとに数える
+	EmojiParsingEnabled bool
+	Ranges              []Range
+}
+
+var (
+	// V2 twitter-text v2の設定 絵文字をコードポイントごとに数える
+	V2 = Config{
+		MaxWeightedTweetLength: 280,
+		Scale:                  100,
+		DefaultWeight:          200,
+		TransformedURLLength:   23,
+		Ranges:                 v2Ranges,
+	}
+	// V3 twitter-text v3の設定 Xの現在の数え方
+	V3 = Config{
+		MaxWeightedTweetLength: 280,
+		Scale:                  100,
+		DefaultWeight:          200,
+		TransformedURLLength:   23,
+		EmojiParsingEnabled:    true,
+		Ranges:                 v2Ranges,
+	}
+
+	v2Ranges = []Range{
+		{Start: 0, End: 4351, Weight: 100},
+		{Start: 8192, End: 8205, Weight: 100},
+		{Start: 8208, End: 8223, Weight: 100},
+		{Start: 8242, End: 8247, Weight: 100},
+	}
+)
+
+// Result 文字数の計算結果
+type Result struct {
+	// 重み付き文字数
+	WeightedLength int `json:"weighted_length" yaml:"weightedLength"`
+	// 上限に対する割合（千分率）
+	Permillage int `json:"permillage" yaml:"permillage"`
+	// 空でなく、上限以内で、使用できない文字を含まない
+	Valid bool `json:"valid" yaml:"valid"`
+}
+
+// Parse V3で文字数を計算する
+func Parse(text string) Result {
+	return V3.Parse(text)
+}
+
+// WeightedLength V3での重み付き文字数
+func WeightedLength(text string) int {
+	return V3.Parse(text).WeightedLength
+}
+
+// Parse 文字数を計算する
+func (c Config) Parse(text string) Result {
+	text = norm.NFC.String(text)
+
+	urls := findURLs(text)
+	weight := 0
+	invalid := false
+	rs := []rune(text)
+	offset := 0 // rs[i]のtextでの位置
+	for i := 0; i < len(rs); {
+		if len(urls) > 0 && offset >= urls[0][0] {
+			// URLの末尾まで進める
+			weight += c.TransformedURLLength * c.Scale
+			for i < len(rs) && offset < urls[0][1] {
+				offset += utf8.RuneLen(rs[i])
+				i++
+			}
+			urls = urls[1:]
+			continue
+		}
+
+		n := 0
+		if c.EmojiParsingEnabled {
+			n = emojiLen(rs, i)
+		}
+		if n > 0 {
+			weight += c.DefaultWeight
+		} else {
+			n = 1
+			weight += c.weightOf(rs[i])
+			invalid = invalid || isInvalid(rs[i])
+		}
+		for ; n > 0; n-- {
+			offset += utf8.RuneLen(rs[i])
+			i++
+		}
+	}
+
+	length := weight / c.Scale
+	return Result{
+		WeightedLength: length,
+		Permillage:     length * 1000 / c.MaxWeightedTweetLength,
+		Valid:          length > 0 && length <= c.MaxWeightedTweetLength && !invalid,
+	}
+}
+
+// weightOf 文字の重み
+func (c Config) weightOf(r rune) int {
+	for _, rg := range c.Ranges {
+		if rg.Start <= r && r <= rg.End {
+			return rg.Weight
+		}
+	}
+	return c.DefaultWeight
+}
+
+// isInvalid 投稿に使用できない文字
+func isInvalid(r rune) bool {
+	switch {
+	case r == 0xFFFE, r == 0xFEFF, r == 0xFFFF:
+		return true
+	case 0x202A <= r && r <= 0x202E: // 書字方向の制御文字
+		return true
+	}
+	return false
+}
+
+var (
+	urlPattern = regexp.MustCompile(`(?i)(?:^|[^A-Za-z0-9@$#＃＠_/.])(https?://[A-Za-z0-9\-._~:/?#\[\]@!$&'()*+,;=%]+)`)
+	// schemeのないURL ホスト（1）・ポートとパス（2）
+	domainPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9@$#＃＠_/.\-])([A-Za-z0-9][A-Za-z0-9\-_]*(?:\.[A-Za-z0-9\-_]+)+)((?::[0-9]+)?(?:/[A-Za-z0-9\-._~:/?#\[\]@!$&'()*+,;=%]*)?)`)
+	// パスがなくてもURLとする国別TLD
+	specialCCTLDs = map[string]bool{"co": true, "tv": true}
+)
+
+// findURLs textのURLの位置（バイト）
+// 末尾の句読点・対応しない)はURLに含めない ドメインに.がないものはURLとしない
+func findURLs(text string) [][2]int {
+	var urls [][2]int
+	for _, m := range urlPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[2], trimURL(text, m[2], m[3])
+		rest := text[start:end]
+		rest = rest[strings.Index(rest, "://")+3:]
+		host, _, _ := strings.Cut(rest, "/")
+		if i := strings.LastIndexByte(host, '.'); i <= 0 || i == len(host)-1 {
+			continue
+		}
+		urls = append(urls, [2]int{start, end})
+	}
+
+	// schemeのないURL schemeのあるURLの一部（パス・クエリ）は除く
+	withScheme := urls
+	for _, m := range domainPattern.FindAllStringSubmatchIndex(text, -1) {
+		// ホストは英数字・-・_で終わるため、末尾の句読点を除いてもホストは残る
+		start, end := m[2], trimURL(text, m[2], m[5])
+		if !isURLHost(text[m[2]:m[3]], end > m[3]) || overlaps(withScheme, start, end) {
+			continue
+		}
+		urls = append(urls, [2]int{start, end})
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i][0] < urls[j][0] })
+	return urls
+}
+
+// trimURL 末尾の句読点・対応しない)を除いたURLの終了位置
+func trimURL(text string, start, end int) int {
+	for end > start {
+		last := text[end-1]
+		if strings.IndexByte(".,;:!?'", last) >= 0 {
+			end--
+			continue
+		}
+		if last == ')' && strings.Count(text[start:end], "(") < strings.Count(text[start:end], ")") {
+			end--
+			continue
+		}
+		break
+	}
+	return end
+}
+
+// isURLHost schemeのないURLのホストとして扱うか hasPathはポート・パスがある場合
+// ‐ ラベルが空・-で始まる、終わるものは除く
+// ‐ TLDがPublic Suffix ListのICANNの項目にある
+// ‐ パスのない「ドメイン1つ.国別TLD」は除く（.co・.tvを除く）
+func isURLHost(host string, hasPath bool) bool {
+	labels := strings.Split(strings.ToLower(host), ".")
+	for _, l := range labels {
+		if l == "" || l[0] == '-' || l[len(l)-1] == '-' {
+			return false
+		}
+	}
+	tld := labels[len(labels)-1]
+	if suffix, icann := publicsuffix.PublicSuffix("a." + tld); !icann || suffix != tld {
+		return false
+	}
+	if !hasPath && len(labels) == 2 && len(tld) == 2 && !specialCCTLDs[tld] {
+		return false
+	}
+	return true
+}
+
+// overlaps [start, end)がurlsのいずれかと重なるか
+func overlaps(urls [][2]int, start, end int) bool {
+	for _, u := range urls {
+		if start < u[1] && u[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// emojiLen rs[i]から始まる絵文字のコードポイント数 絵文字でなければ0
+func emojiLen(rs []rune, i int) int {
+	r := rs[i]
+	switch {
+	case isRegionalIndicator(r):
+		// 2つで国旗
+		if i+1 < len(rs) && isRegionalIndicator(rs[i+1]) {
+			return 2
+		}
+		return 1
+	case r == '#' || r == '*' || ('0' <= r && r <= '9'):
+		// キーキャップ 例: 1️⃣
+		j := i + 1
+		if j < len(rs) && rs[j] == 0xFE0F {
+			j++
+		}
+		if j < len(rs) && rs[j] == 0x20E3 {
+			return j + 1 - i
+		}
+		return 0
+	case !isPictographic(r):
+		return 0
+	}
+
+	j := skipModifiers(rs, i+1)
+	// ©・®などラテン文字の範囲の記号は異体字セレクタ（FE0F）がある場合のみ絵文字
+	if r < 0x1100 && j == i+1 {
+		return 0
+	}
+	for j+1 < len(rs) && rs[j] == 0x200D && isPictographic(rs[j+1]) {
+		j = skipModifiers(rs, j+2)
+	}
+	// タグ（地域の旗） 例: 🏴󠁧󠁢󠁥󠁮󠁧󠁿
+	for j < len(rs) && 0xE0020 <= rs[j] && rs[j] <= 0xE007F {
+		j++
+	}
+	return j - i
+}
+
+// skipModifiers 異体字セレクタ・肌の色を読み飛ばした位置
+func skipModifiers(rs []rune, j int) int {
+	for j < len(rs) && (rs[j] == 0xFE0F || (0x1F3FB <= rs[j] && rs[j] <= 0x1F3FF)) {
+		j++
+	}
+	return j
+}
+
+func isRegionalIndicator(r rune) bool {
+	return 0x1F1E6 <= r && r <= 0x1F1FF
+}
+
+// isPictographic 絵文字として表示される記号
+func isPictographic(r rune) bool {
+	switch {
+	case 0x1F000 <= r && r <= 0x1FAFF:
+		return true
+	case 0x2190 <= r && r <= 0x21FF, 0x2300 <= r && r <= 0x23FF, 0x25A0 <= r && r <= 0x27BF, 0x2B00 <= r && r <= 0x2BFF:
+		return true
+	}
+	switch r {
+	case 0x00A9, 0x00AE, 0x203C, 0x2049, 0x2122, 0x2139, 0x24C2, 0x2934, 0x2935, 0x3030, 0x303D, 0x3297, 0x3299:
+		return true
+	}
+	return false
+}
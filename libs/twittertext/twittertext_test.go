@@ -0,0 +1,53 @@
+package twittertext
+
+import (
+	"os"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// conformance twitter-text conformanceのvalidate.ymlの形式
+// 項目ごとにexpectedの形式が異なるため、確認する項目のみ読み込む
+type conformance struct {
+	Tests map[string]yaml.Node `yaml:"tests"`
+}
+
+// conformanceCase 重み付き文字数の項目のテストケース
+type conformanceCase struct {
+	Description string `yaml:"description"`
+	Text        string `yaml:"text"`
+	Expected    Result `yaml:"expected"`
+}
+
+func TestConformance(t *testing.T) {
+	b, err := os.ReadFile("testdata/validate.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c conformance
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []struct {
+		name   string
+		config Config
+	}{
+		{"WeightedTweetsCounterTest", V2},
+		{"WeightedTweetsWithDiscountedEmojiCounterTest", V3},
+	} {
+		var cases []conformanceCase
+		node := c.Tests[s.name]
+		if err := node.Decode(&cases); err != nil || len(cases) == 0 {
+			t.Fatalf("%s: no test case: %v", s.name, err)
+		}
+		for _, tc := range cases {
+			t.Run(s.name+"/"+tc.Description, func(t *testing.T) {
+				if got := s.config.Parse(tc.Text); got != tc.Expected {
+					t.Errorf("Parse(%q): got %+v, want %+v", tc.Text, got, tc.Expected)
+				}
+			})
+		}
+	}
+}
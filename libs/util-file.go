@@ -58,7 +58,7 @@ func CleanDir(dir string) error {
 }
 
 // GetDriveFile GoogleDriveAPIを使用してファイルをダウンロードする
-func GetDriveFile(cred []byte, fileID string) ([]byte, error) {
+func GetDriveFile(ctx context.Context, cred []byte, fileID string) ([]byte, error) {
 	// GoogelDriveAPI ファイルを取得
 	config, err := google.JWTConfigFromJSON(cred, drive.DriveScope)
 	if err != nil {
@@ -66,14 +66,13 @@ func GetDriveFile(cred []byte, fileID string) ([]byte, error) {
 	}
 
 	// google clientを作成
-	ctx := context.Background()
 	client := config.Client(ctx)
 	srv, err := drive.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return nil, SetError(err, "failed to create google drive service")
 	}
 
-	file, err := srv.Files.Get(fileID).Download()
+	file, err := srv.Files.Get(fileID).Context(ctx).Download()
 	if err != nil {
 		return nil, SetError(err, "failed to get file")
 	}
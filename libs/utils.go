@@ -5,11 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/playwright-community/playwright-go"
 	"github.com/rs/zerolog/log"
@@ -81,6 +81,7 @@ func ToAlphabet(columnIndex int) string {
 }
 
 // ToStruct Dataframeが出力した[][]stringを指定の型にBindする
+// csvタグ"*"のmap[string]stringフィールドには、他のフィールドに対応しない列を列名で格納する
 func ToStruct(data [][]string, bindList any) error {
 	// Reflect on the bindList to verify it's a pointer to a slice of structs.
 	bindListVal := reflect.ValueOf(bindList)
@@ -99,9 +100,14 @@ func ToStruct(data [][]string, bindList any) error {
 
 	// Create a map from headers (column names) to struct field indexes.
 	fieldMap := make(map[string]int)
+	extraField := -1
 	for i := 0; i < structType.NumField(); i++ {
 		field := structType.Field(i)
 		tag := field.Tag.Get("csv")
+		if tag == "*" && field.Type == reflect.TypeOf(map[string]string(nil)) {
+			extraField = i
+			continue
+		}
 		for _, h := range headers {
 			if h == tag {
 				fieldMap[h] = i
@@ -113,9 +119,17 @@ func ToStruct(data [][]string, bindList any) error {
 	// Iterate over data rows, starting from 1 as we assume 0 is header.
 	for _, row := range data[1:] {
 		newStructPtr := reflect.New(structType).Elem()
+		var extra map[string]string
 		for col, value := range row {
 			fieldIndex, exists := fieldMap[headers[col]]
 			if !exists {
+				// 対応するフィールドがない列は"*"のフィールドに格納する
+				if extraField >= 0 && headers[col] != "" {
+					if extra == nil {
+						extra = make(map[string]string)
+					}
+					extra[headers[col]] = value
+				}
 				continue // Skip if no matching struct field
 			}
 			fieldVal := newStructPtr.Field(fieldIndex)
@@ -131,6 +145,9 @@ func ToStruct(data [][]string, bindList any) error {
 				// Add more type handlers as necessary.
 			}
 		}
+		if extra != nil {
+			newStructPtr.Field(extraField).Set(reflect.ValueOf(extra))
+		}
 		bindListVal.Elem().Set(reflect.Append(bindListVal.Elem(), newStructPtr))
 	}
 	return nil
@@ -190,6 +207,20 @@ func pwClose(pw *playwright.Playwright, page playwright.Page) {
 	pw.Stop()
 }
 
-func millisec(r *rand.Rand) int {
+// Sleep 指定時間待機する
+// ctxが終了した場合は待機を中断し、ctxのエラーを返す
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func millisec(r Rand) int {
 	return r.Intn(2000) + 1000
 }
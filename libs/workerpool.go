@@ -0,0 +1,273 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrPoolClosed 停止したWorkerPoolにJobを追加した
+	ErrPoolClosed = errors.New("worker pool is closed")
+	// ErrQueueFull 実行待ちが上限に達している
+	ErrQueueFull = errors.New("worker pool queue is full")
+	// ErrJobExpired 開始期限までに実行できなかった
+	ErrJobExpired = errors.New("job deadline exceeded")
+	// ErrJobPanicked 実行中にpanicした
+	ErrJobPanicked = errors.New("job panicked")
+)
+
+// Job WorkerPoolで実行する処理
+type Job struct {
+	// 同じKeyのJobは同時に実行しない（例: Twitterアカウント）
+	Key string
+	// 開始期限 過ぎたJobは実行せず取り除く。ゼロ値は期限なし
+	Deadline time.Time
+	Run      func()
+	// 実行しなかった場合・実行中にpanicした場合に呼び出す（任意） Runと合わせて、Jobの終了を待つために使用する
+	Drop func(err error)
+}
+
+// WorkerPool 同時実行数を制限してJobを実行する
+// ‐ 同じKeyのJobが実行中の場合、後のJobは実行中のJobが終わるまで待たせる（他のKeyのJobを先に実行する）
+// ‐ 開始期限を過ぎたJobは実行せず、OnDropに渡す 実行待ちのJobの期限に合わせてWorkerを起こす
+// why: 投稿時刻が重なってもブラウザの起動数を抑え、同じアカウントから同時に投稿しないため
+type WorkerPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []Job
+	running map[string]bool
+	closed  bool
+	wg      sync.WaitGroup
+	// 実行待ちのJobの最も早い開始期限にWorkerを起こすタイマー
+	timer   *time.Timer
+	timerAt time.Time
+
+	maxQueue int
+
+	// 実行しなかったJobを受け取る 既定はWarnログを出力する
+	OnDrop func(j Job, err error)
+	// 現在時刻 テストで差し替える
+	Now func() time.Time
+}
+
+// NewWorkerPool workers個のWorkerを起動する
+// maxQueue: 実行待ちの上限 0以下の場合は上限なし
+func NewWorkerPool(workers, maxQueue int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &WorkerPool{
+		running:  make(map[string]bool),
+		maxQueue: maxQueue,
+		OnDrop: func(j Job, err error) {
+			log.Warn().Str("function", "WorkerPool").Msgf("drop job, key: %s, deadline: %s > %s", j.Key, j.Deadline.Format(time.RFC3339), err)
+		},
+		Now: time.Now,
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Submit Jobを実行待ちに追加する
+func (p *WorkerPool) Submit(j Job) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+	if p.maxQueue > 0 && len(p.queue) >= p.maxQueue {
+		return ErrQueueFull
+	}
+
+	p.queue = append(p.queue, j)
+	p.cond.Signal()
+	return nil
+}
+
+// Pending 実行待ちの件数
+func (p *WorkerPool) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue)
+}
+
+// Close 新しいJobの追加を止め、実行待ちのJobがすべて終わるまで待つ
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	p.stopTimer()
+}
+
+// Shutdown 新しいJobの追加を止め、実行中のJobが終わるまでctxの終了を上限に待つ
+// 開始していないJobは実行せず、OnDropに渡す
+// ctxが先に終了した場合はctxのエラーを返す
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	dropped := p.queue
+	p.queue = nil
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.stopTimer()
+
+	for _, j := range dropped {
+		p.drop(j, ErrPoolClosed)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *WorkerPool) worker() {
+	defer p.wg.Done()
+
+	for {
+		p.mu.Lock()
+		j, dropped, ok := p.next()
+		for !ok && len(dropped) == 0 && !(p.closed && len(p.queue) == 0) {
+			// 同じKeyの実行中に待たせたJobが期限を過ぎた場合に、実行中のJobの終了を待たずに取り除くため
+			p.armTimer()
+			p.cond.Wait()
+			j, dropped, ok = p.next()
+		}
+		if ok {
+			p.running[j.Key] = true
+		}
+		p.mu.Unlock()
+
+		// 取り除いたJobは待たずに通知する
+		for _, d := range dropped {
+			p.drop(d, ErrJobExpired)
+		}
+		if !ok {
+			if len(dropped) != 0 {
+				continue
+			}
+			return
+		}
+
+		p.run(j)
+
+		p.mu.Lock()
+		delete(p.running, j.Key)
+		// 待たせていた同じKeyのJobを実行できるようにする
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}
+}
+
+// next 実行待ちから開始できるJobを取り出す。期限を過ぎたJobは取り除いて返す
+// p.muを取得して呼び出すこと
+func (p *WorkerPool) next() (Job, []Job, bool) {
+	now := p.Now()
+
+	var (
+		next    Job
+		found   bool
+		dropped []Job
+	)
+	queue := p.queue[:0]
+	for _, j := range p.queue {
+		if !found && !j.Deadline.IsZero() && now.After(j.Deadline) {
+			dropped = append(dropped, j)
+			continue
+		}
+		if !found && !p.running[j.Key] {
+			next, found = j, true
+			continue
+		}
+		queue = append(queue, j)
+	}
+
+	// 取り出したJob・取り除いたJobの分を詰める
+	for i := len(queue); i < len(p.queue); i++ {
+		p.queue[i] = Job{}
+	}
+	p.queue = queue
+
+	return next, dropped, found
+}
+
+// armTimer 実行待ちのJobの最も早い開始期限を過ぎたらWorkerを起こす
+// p.muを取得して呼び出すこと
+func (p *WorkerPool) armTimer() {
+	var earliest time.Time
+	for _, j := range p.queue {
+		if !j.Deadline.IsZero() && (earliest.IsZero() || j.Deadline.Before(earliest)) {
+			earliest = j.Deadline
+		}
+	}
+	if earliest.IsZero() || (p.timer != nil && !p.timerAt.After(earliest)) {
+		return
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timerAt = earliest
+	// 期限を過ぎたか（After）で判定するため、期限の直後に起こす
+	var t *time.Timer
+	t = time.AfterFunc(earliest.Sub(p.Now())+time.Millisecond, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.timer == t {
+			p.timer = nil
+		}
+		p.cond.Broadcast()
+	})
+	p.timer = t
+}
+
+// stopTimer 停止後にWorkerを起こさないよう、タイマーを止める
+func (p *WorkerPool) stopTimer() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
+
+// drop 実行しなかったJobを通知する
+func (p *WorkerPool) drop(j Job, err error) {
+	if j.Drop != nil {
+		j.Drop(err)
+	}
+	p.OnDrop(j, err)
+}
+
+// run Jobを実行する。Job内のpanicでWorkerを止めない
+// panicした場合はErrJobPanickedでDropを呼び出す why: Jobの終了を待つ処理を終わらせるため
+func (p *WorkerPool) run(j Job) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Error().Str("function", "WorkerPool").Msgf("panic in job, key: %s > %v", j.Key, rec)
+			p.drop(j, fmt.Errorf("%w: %v", ErrJobPanicked, rec))
+		}
+	}()
+	j.Run()
+}
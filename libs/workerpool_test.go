@@ -0,0 +1,214 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolLimit(t *testing.T) {
+	p := NewWorkerPool(2, 0)
+
+	var (
+		active, peak int32
+		mu           sync.Mutex
+		perKey       = make(map[string]int)
+		keyOverlap   bool
+	)
+	for i := 0; i < 12; i++ {
+		key := []string{"a", "b", "c"}[i%3]
+		err := p.Submit(Job{Key: key, Run: func() {
+			mu.Lock()
+			perKey[key]++
+			if perKey[key] > 1 {
+				keyOverlap = true
+			}
+			mu.Unlock()
+
+			n := atomic.AddInt32(&active, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+
+			mu.Lock()
+			perKey[key]--
+			mu.Unlock()
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+
+	if peak > 2 {
+		t.Fatalf("concurrency exceeded: %d", peak)
+	}
+	if keyOverlap {
+		t.Fatal("same key ran concurrently")
+	}
+	if err := p.Submit(Job{Run: func() {}}); err != ErrPoolClosed {
+		t.Fatalf("got %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestWorkerPoolDeadline(t *testing.T) {
+	p := NewWorkerPool(1, 2)
+
+	var dropped []string
+	var mu sync.Mutex
+	p.OnDrop = func(j Job, err error) {
+		mu.Lock()
+		dropped = append(dropped, j.Key)
+		mu.Unlock()
+	}
+
+	// 同じKeyの実行中に待たせたJobが期限を過ぎる
+	release := make(chan struct{})
+	started := make(chan struct{})
+	if err := p.Submit(Job{Key: "a", Run: func() { close(started); <-release }}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ran := false
+	if err := p.Submit(Job{Key: "a", Deadline: time.Now().Add(10 * time.Millisecond), Run: func() { ran = true }}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(Job{Key: "b", Run: func() {}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(Job{Key: "c", Run: func() {}}); err != ErrQueueFull {
+		t.Fatalf("got %v, want ErrQueueFull", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	p.Close()
+
+	if ran {
+		t.Fatal("expired job ran")
+	}
+	if len(dropped) != 1 || dropped[0] != "a" {
+		t.Fatalf("dropped: %v", dropped)
+	}
+}
+
+// TestWorkerPoolDropWaiting 同じKeyの実行中に待たせたJobは、実行中のJobの終了を待たずに期限で取り除くこと
+func TestWorkerPoolDropWaiting(t *testing.T) {
+	p := NewWorkerPool(2, 0)
+	release := make(chan struct{})
+	defer func() {
+		close(release)
+		p.Close()
+	}()
+
+	started := make(chan struct{})
+	if err := p.Submit(Job{Key: "a", Run: func() { close(started); <-release }}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	dropped := make(chan error, 1)
+	err := p.Submit(Job{Key: "a", Deadline: time.Now().Add(20 * time.Millisecond), Run: func() { t.Error("expired job ran") }, Drop: func(err error) { dropped <- err }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-dropped:
+		if err != ErrJobExpired {
+			t.Fatalf("got %v, want ErrJobExpired", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting job was not dropped at its deadline")
+	}
+}
+
+// TestWorkerPoolPanic panicしたJobはDropに通知し、Workerは次のJobを実行すること
+func TestWorkerPoolPanic(t *testing.T) {
+	p := NewWorkerPool(1, 0)
+
+	var wg sync.WaitGroup
+	var got error
+	wg.Add(2)
+	if err := p.Submit(Job{Key: "a", Run: func() { panic("boom") }, Drop: func(err error) { got = err; wg.Done() }}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(Job{Key: "a", Run: func() { wg.Done() }}); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	p.Close()
+
+	if !errors.Is(got, ErrJobPanicked) {
+		t.Fatalf("got %v, want ErrJobPanicked", got)
+	}
+}
+
+func TestWorkerPoolDropIdle(t *testing.T) {
+	p := NewWorkerPool(1, 0)
+	defer p.Close()
+
+	// 実行中のJobがなくても、期限を過ぎたJobはすぐに通知する
+	dropped := make(chan error, 1)
+	err := p.Submit(Job{Key: "a", Deadline: time.Now().Add(-time.Second), Run: func() { t.Error("expired job ran") }, Drop: func(err error) { dropped <- err }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-dropped:
+		if err != ErrJobExpired {
+			t.Fatalf("got %v, want ErrJobExpired", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expired job was not dropped")
+	}
+}
+
+func TestWorkerPoolShutdown(t *testing.T) {
+	p := NewWorkerPool(1, 0)
+
+	var dropped []string
+	p.OnDrop = func(j Job, err error) {
+		if err == ErrPoolClosed {
+			dropped = append(dropped, j.Key)
+		}
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	finished := false
+	if err := p.Submit(Job{Key: "a", Run: func() { close(started); <-release; finished = true }}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := p.Submit(Job{Key: "b", Run: func() { t.Error("queued job ran after shutdown") }}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 実行中のJobが終わらなければ期限で戻る
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+
+	// 実行中のJobは最後まで実行する
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !finished {
+		t.Fatal("in-flight job did not finish")
+	}
+	if len(dropped) != 1 || dropped[0] != "b" {
+		t.Fatalf("dropped: %v", dropped)
+	}
+}